@@ -2,20 +2,77 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/juancortelezzi/gogsd/pkg/cli"
+	"github.com/juancortelezzi/gogsd/pkg/config"
 	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
 	"github.com/juancortelezzi/gogsd/pkg/server"
 )
 
+const usage = `usage:
+  gogsd [flags]                     serve gogsd, SIGHUP reloads the configuration
+  gogsd config print [flags]        print the effective configuration, secrets redacted
+  gogsd <command> [flags] [args]    manage todos, commands are listed by gogsd help
+
+flags are listed by gogsd -h.
+`
+
 func main() {
+	args := os.Args[1:]
+
+	if len(args) > 0 && cli.IsCommand(args[0]) {
+		os.Exit(cli.Run(context.Background(), args, os.Stdout, os.Stderr, os.LookupEnv))
+	}
+
+	if len(args) > 0 && args[0] == "config" {
+		if len(args) < 2 || args[1] != "print" {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+
+		cfg := loadConfig(args[2:])
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg := loadConfig(args)
+
 	ctx := context.Background()
-	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelInfo)
+	var level slog.LevelVar
+	configured, _ := cfg.LogLevel()
+	level.Set(configured)
+	logger := gsdlogger.NewLogger(os.Stdout, &level)
 
-	if err := server.Run(ctx, logger, os.LookupEnv); err != nil {
+	// SIGHUP reads the same file, environment and flags again.
+	reload := server.WithReload(func() (config.Config, error) {
+		return config.Load(args, os.LookupEnv)
+	})
+
+	if err := server.Run(ctx, logger, cfg, reload, server.WithLogLevel(&level)); err != nil {
 		logger.ErrorContext(ctx, "error in top level", "err", err)
 		os.Exit(1)
 	}
 }
+
+// loadConfig exits listing every problem with the configuration when it is
+// not valid.
+func loadConfig(args []string) config.Config {
+	cfg, err := config.Load(args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	return cfg
+}
@@ -0,0 +1,60 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/juancortelezzi/gogsd/pkg/requestid"
+)
+
+// codes shared by every endpoint answering with Write.
+const (
+	CodeUnauthenticated   = "unauthenticated"
+	CodeForbidden         = "forbidden"
+	CodeRateLimited       = "rate_limited"
+	CodeWorkspaceNotFound = "workspace_not_found"
+	CodeQuotaExceeded     = "quota_exceeded"
+	CodeRequestTooLarge   = "request_too_large"
+)
+
+// codes Error answers with for the statuses handlers use most.
+const (
+	CodeBadRequest = "bad_request"
+	CodeNotFound   = "not_found"
+	CodeConflict   = "conflict"
+	CodeInternal   = "internal_server_error"
+)
+
+type detail struct {
+	Code      string
+	Message   string
+	RequestID string
+}
+
+// Write answers with status and a JSON body of the form
+// {"Error": {"Code": "...", "Message": "...", "RequestID": "..."}}, so
+// clients can tell errors apart by code instead of parsing messages. The
+// request ID is the one requestid.Middleware put in the response headers.
+func Write(w http.ResponseWriter, status int, code, message string) {
+	body, err := json.Marshal(struct{ Error detail }{detail{
+		Code:      code,
+		Message:   message,
+		RequestID: w.Header().Get(requestid.Header),
+	}})
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Error answers like http.Error does, but through Write with a code named
+// after status, such as not_found, so errors without a code of their own
+// still carry the request ID.
+func Error(w http.ResponseWriter, message string, status int) {
+	Write(w, status, strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")), message)
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+// API keys look like gsd_<prefix>_<secret>. The prefix is 12 hex characters
+// stored in the clear to find the key, the secret is only stored hashed.
+const (
+	apiKeyTag          = "gsd_"
+	apiKeyPrefixLength = 12
+	apiKeyMinSecret    = 16
+)
+
+// apiKeyTouchInterval is how stale last_used_at may get before a request
+// writes it again, so busy keys do not cost a write per request.
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyAuthenticator accepts API keys sent as a bearer token or in the
+// X-API-Key header.
+type APIKeyAuthenticator struct {
+	logger  gsdlogger.Logger
+	queries *database.Queries
+}
+
+func NewAPIKeyAuthenticator(logger gsdlogger.Logger, queries *database.Queries) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{logger: logger, queries: queries}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Identity, error) {
+	key := r.Header.Get("X-API-Key")
+	if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found && key == "" {
+		key = bearer
+	}
+
+	if !strings.HasPrefix(key, apiKeyTag) {
+		return Identity{}, ErrNoCredentials
+	}
+
+	prefix, secret, err := parseAPIKey(key)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	apiKey, err := a.queries.GetAPIKeyByPrefix(r.Context(), prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Identity{}, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+
+	hash := hashAPIKeySecret(apiKey.Salt, secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(apiKey.Hash)) != 1 {
+		return Identity{}, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+	}
+
+	if apiKey.ExpiresAt.Valid && !time.Now().Before(apiKey.ExpiresAt.Time) {
+		return Identity{}, fmt.Errorf("%w: api key expired", ErrInvalidCredentials)
+	}
+
+	user, err := a.queries.GetUser(r.Context(), apiKey.UserID)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	// last_used_at is only informational, so failing to write it does not
+	// fail the request.
+	if !apiKey.LastUsedAt.Valid || time.Since(apiKey.LastUsedAt.Time) >= apiKeyTouchInterval {
+		if err := a.queries.TouchAPIKey(r.Context(), apiKey.ID); err != nil {
+			a.logger.ErrorContext(r.Context(), "could not touch api key", "id", apiKey.ID, "err", err)
+		}
+	}
+
+	return Identity{User: user, Scopes: strings.Fields(apiKey.Scopes)}, nil
+}
+
+// NewAPIKey generates a key and returns it together with the parameters to
+// store it, which only hold its hash. The key can not be recovered later.
+func NewAPIKey(userID int64, name string, scopes []string, expiresAt sql.NullTime) (string, database.CreateAPIKeyParams, error) {
+	random := make([]byte, apiKeyPrefixLength/2+32)
+	if _, err := rand.Read(random); err != nil {
+		return "", database.CreateAPIKeyParams{}, err
+	}
+
+	prefix := hex.EncodeToString(random[:apiKeyPrefixLength/2])
+	secret := base64.RawURLEncoding.EncodeToString(random[apiKeyPrefixLength/2:])
+	key := apiKeyTag + prefix + "_" + secret
+
+	params, err := apiKeyParams(userID, name, key, scopes, expiresAt)
+	return key, params, err
+}
+
+// EnsureAPIKey stores key for the named user of the default workspace, so
+// operators and tests can start a server with a key they already know. A key
+// already stored is left alone, but one with the same prefix and another
+// secret is an error rather than a key that silently does not work.
+//
+// Keys are only ever added: one removed from the configuration keeps working
+// until it is deleted through DELETE /api-keys/{id}.
+func EnsureAPIKey(ctx context.Context, queries *database.Queries, userName, key string, scopes []string) error {
+	prefix, secret, err := parseAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	stored, err := queries.GetAPIKeyByPrefix(ctx, prefix)
+	if err == nil {
+		hash := hashAPIKeySecret(stored.Salt, secret)
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(stored.Hash)) != 1 {
+			return fmt.Errorf("api key %s%s is already stored with another secret", apiKeyTag, prefix)
+		}
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	user, err := queries.GetUserByName(ctx, database.GetUserByNameParams{
+		WorkspaceID: workspace.DefaultID,
+		Name:        userName,
+	})
+	if err != nil {
+		return fmt.Errorf("could not get user %s: %w", userName, err)
+	}
+
+	params, err := apiKeyParams(user.ID, "bootstrap", key, scopes, sql.NullTime{})
+	if err != nil {
+		return err
+	}
+
+	_, err = queries.CreateAPIKey(ctx, params)
+	return err
+}
+
+func apiKeyParams(userID int64, name, key string, scopes []string, expiresAt sql.NullTime) (database.CreateAPIKeyParams, error) {
+	prefix, secret, err := parseAPIKey(key)
+	if err != nil {
+		return database.CreateAPIKeyParams{}, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return database.CreateAPIKeyParams{}, err
+	}
+
+	return database.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Salt:      hex.EncodeToString(salt),
+		Hash:      hashAPIKeySecret(hex.EncodeToString(salt), secret),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func parseAPIKey(key string) (prefix, secret string, err error) {
+	rest, found := strings.CutPrefix(key, apiKeyTag)
+	if !found {
+		return "", "", fmt.Errorf("%w: api keys start with %s", ErrInvalidCredentials, apiKeyTag)
+	}
+
+	prefix, secret, found = strings.Cut(rest, "_")
+	if _, err := hex.DecodeString(prefix); !found || err != nil || len(prefix) != apiKeyPrefixLength {
+		return "", "", fmt.Errorf("%w: malformed api key", ErrInvalidCredentials)
+	}
+
+	if len(secret) < apiKeyMinSecret {
+		return "", "", fmt.Errorf("%w: malformed api key", ErrInvalidCredentials)
+	}
+
+	return prefix, secret, nil
+}
+
+func hashAPIKeySecret(salt, secret string) string {
+	hash := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(hash[:])
+}
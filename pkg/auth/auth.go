@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+// scopes an identity can be granted. Admin implies every other scope.
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+	ScopeAdmin      = "admin"
+)
+
+// Scopes lists every scope in the order they are documented.
+var Scopes = []string{ScopeTodosRead, ScopeTodosWrite, ScopeAdmin}
+
+// Identity is who a request was made by and what it is allowed to do.
+type Identity struct {
+	User   database.User
+	Scopes []string
+}
+
+// HasScope reports whether the identity was granted scope. The empty scope
+// is granted to everyone.
+func (i Identity) HasScope(scope string) bool {
+	return scope == "" || slices.Contains(i.Scopes, scope) || slices.Contains(i.Scopes, ScopeAdmin)
+}
+
+type identityContextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the identity a request was
+// made by.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity stored by WithIdentity, if any.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(Identity)
+	return identity, ok
+}
+
+// UserFromContext returns the user of the identity stored by WithIdentity,
+// if any.
+func UserFromContext(ctx context.Context) (database.User, bool) {
+	identity, ok := IdentityFromContext(ctx)
+	return identity.User, ok
+}
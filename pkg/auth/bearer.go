@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/requestid"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+// JWTConfig is which tokens a JWTAuthenticator accepts, where it finds the
+// keys to check them with and the slug of the only workspace it accepts
+// them in. Exactly one of JWKSURL and JWKSFile is set.
+type JWTConfig struct {
+	Issuer    string
+	Audience  string
+	JWKSURL   string
+	JWKSFile  string
+	ClockSkew time.Duration
+	Workspace string
+}
+
+// scopeList is the scp claim, which is either a space separated string like
+// the scope claim or a list of scopes.
+type scopeList []string
+
+func (s *scopeList) UnmarshalJSON(data []byte) error {
+	var joined string
+	if err := json.Unmarshal(data, &joined); err == nil {
+		*s = strings.Fields(joined)
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+type bearerClaims struct {
+	registeredClaims
+	Scope string
+	Scp   scopeList
+}
+
+// JWTAuthenticator accepts RS256, ES256 and EdDSA signed JWTs sent as a
+// bearer token to the workspace of its config. The subject is mapped to a
+// local user of that workspace through the same links OpenID Connect logins
+// use, creating it on first sight, and the scope or scp claim to the scopes
+// of the identity. Unknown scopes are ignored.
+type JWTAuthenticator struct {
+	queries *database.Queries
+	config  JWTConfig
+	keys    keySet
+}
+
+func NewJWTAuthenticator(queries *database.Queries, config JWTConfig) (*JWTAuthenticator, error) {
+	var keys keySet
+	if config.JWKSFile != "" {
+		fileKeys, err := NewFileJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = fileKeys
+	} else {
+		keys = NewRemoteJWKS(&http.Client{Timeout: oidcHTTPTimeout, Transport: requestid.Transport{}}, config.JWKSURL)
+	}
+
+	return &JWTAuthenticator{queries: queries, config: config, keys: keys}, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (Identity, error) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || strings.Count(token, ".") != 2 {
+		return Identity{}, ErrNoCredentials
+	}
+
+	payload, err := verifyJWT(r.Context(), token, a.keys, []string{"RS256", "ES256", "EdDSA"})
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var claims bearerClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Identity{}, fmt.Errorf("%w: malformed claims: %v", errInvalidToken, err)
+	}
+
+	if err := claims.validate(a.config.Issuer, a.config.Audience, a.config.ClockSkew); err != nil {
+		return Identity{}, err
+	}
+
+	if claims.Sub == "" {
+		return Identity{}, fmt.Errorf("%w: no subject", errInvalidToken)
+	}
+
+	ws, ok := workspace.FromContext(r.Context())
+	if !ok {
+		return Identity{}, ErrNoWorkspace
+	}
+
+	// users are created on first sight, so a token accepted anywhere would
+	// get a user in every workspace it is sent to.
+	if ws.Slug != a.config.Workspace {
+		return Identity{}, fmt.Errorf("%w: tokens are only accepted in the %s workspace", ErrInvalidCredentials, a.config.Workspace)
+	}
+
+	user, err := LinkedUser(r.Context(), a.queries, ws.ID, claims.Iss, claims.Sub, claims.Sub, "jwt:"+claims.Sub)
+	if errors.Is(err, ErrNoFreeName) {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var scopes []string
+	for _, scope := range append(strings.Fields(claims.Scope), claims.Scp...) {
+		if slices.Contains(Scopes, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return Identity{User: user, Scopes: scopes}, nil
+}
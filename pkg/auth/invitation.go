@@ -0,0 +1,17 @@
+package auth
+
+// NewInvitationToken returns a random token to hand to the person invited to
+// a list and the hash it is stored under, so a leaked database does not leak
+// usable invitations.
+func NewInvitationToken() (token, hash string, err error) {
+	token, err = randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashInvitationToken(token), nil
+}
+
+// HashInvitationToken returns the hash an invitation token is stored under.
+func HashInvitationToken(token string) string {
+	return hashSessionToken(token)
+}
@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long fetched keys are used when the response does not say, and how
+// often they may be fetched again, whether the last fetch worked or not.
+const (
+	jwksDefaultMaxAge  = time.Hour
+	jwksRefetchBackoff = time.Minute
+)
+
+var errUnknownKey = fmt.Errorf("%w: unknown signing key", errInvalidToken)
+
+// jwk is one JSON Web Key as in RFC 7517.
+type jwk struct {
+	Kty string
+	Kid string
+	Use string
+	Crv string
+	N   string
+	E   string
+	X   string
+	Y   string
+}
+
+// RemoteJWKS is a JSON Web Key Set fetched from a URL. Keys are cached for
+// the max-age of the response and fetched again early when a token names a
+// key id the cache does not know, which is how issuers rotate keys.
+//
+// A single fetch runs at a time and concurrent callers wait for it. When it
+// fails the keys fetched before keep being served, and nothing is fetched
+// again until jwksRefetchBackoff has passed.
+type RemoteJWKS struct {
+	client *http.Client
+	url    string
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	expires     time.Time
+	attemptedAt time.Time
+	fetchErr    error
+	// fetching is closed when the fetch in flight finishes, nil when none is.
+	fetching chan struct{}
+}
+
+func NewRemoteJWKS(client *http.Client, url string) *RemoteJWKS {
+	return &RemoteJWKS{client: client, url: url}
+}
+
+func (j *RemoteJWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	now := time.Now()
+	_, err := pickKey(j.keys, kid)
+	wanted := now.After(j.expires) || errors.Is(err, errUnknownKey)
+	if wanted && j.fetching == nil && now.Sub(j.attemptedAt) >= jwksRefetchBackoff {
+		j.attemptedAt = now
+		j.fetching = make(chan struct{})
+		// the fetch is shared, so it must not end with the request that
+		// happened to start it. The client's timeout bounds it instead.
+		go j.refresh(context.WithoutCancel(ctx), j.fetching)
+	}
+	fetching := j.fetching
+	j.mu.Unlock()
+
+	if wanted && fetching != nil {
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key, err := pickKey(j.keys, kid)
+	if errors.Is(err, errUnknownKey) && j.keys == nil && j.fetchErr != nil {
+		return nil, j.fetchErr
+	}
+	return key, err
+}
+
+// refresh fetches the keys and closes done, keeping the old keys when the
+// fetch fails.
+func (j *RemoteJWKS) refresh(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	keys, age, err := j.fetch(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.fetching = nil
+	j.fetchErr = err
+	if err != nil {
+		return
+	}
+
+	j.keys = keys
+	j.expires = time.Now().Add(age)
+}
+
+func (j *RemoteJWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, time.Duration, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := j.client.Do(request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("could not fetch jwks: status %d", resp.StatusCode)
+	}
+
+	keys, err := decodeJWKS(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return keys, maxAge(resp.Header.Get("Cache-Control")), nil
+}
+
+// FileJWKS is a JSON Web Key Set read from a file. The file is read again
+// whenever its modification time changes, so keys are rotated by replacing
+// it.
+type FileJWKS struct {
+	path string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	modTime time.Time
+}
+
+// NewFileJWKS reads the key set at path, failing early on a missing or
+// malformed file.
+func NewFileJWKS(path string) (*FileJWKS, error) {
+	j := &FileJWKS{path: path}
+	if _, err := j.Key(context.Background(), ""); err != nil && !errors.Is(err, errUnknownKey) {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *FileJWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info, err := os.Stat(j.path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read jwks: %w", err)
+	}
+
+	if j.keys == nil || !info.ModTime().Equal(j.modTime) {
+		file, err := os.Open(j.path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read jwks: %w", err)
+		}
+		defer file.Close()
+
+		keys, err := decodeJWKS(file)
+		if err != nil {
+			return nil, err
+		}
+
+		j.keys = keys
+		j.modTime = info.ModTime()
+	}
+
+	return pickKey(j.keys, kid)
+}
+
+// pickKey finds kid in keys. Tokens without a key id are accepted only when
+// there is a single key to choose from.
+func pickKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, error) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+
+	key, found := keys[kid]
+	if !found {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// decodeJWKS turns the signing keys of a set into public keys by key id,
+// skipping keys of types we can not verify with.
+func decodeJWKS(r io.Reader) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk
+	}
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, fmt.Errorf("could not decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+var errUnsupportedKey = errors.New("unsupported key type")
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent is too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, errUnsupportedKey
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errUnsupportedKey
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("ed25519 key has the wrong size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errUnsupportedKey
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// maxAge reads max-age from a Cache-Control header. A max-age of 0 makes the
+// keys stale right away, so they are fetched again once the backoff allows.
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		value, found := strings.CutPrefix(strings.TrimSpace(directive), "max-age=")
+		if !found {
+			continue
+		}
+
+		seconds, err := strconv.Atoi(value)
+		if err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return jwksDefaultMaxAge
+}
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errInvalidToken is wrapped by every reason a JWT is rejected for.
+var errInvalidToken = fmt.Errorf("%w: invalid token", ErrInvalidCredentials)
+
+// keySet finds the public key a JWT was signed with by its key id.
+type keySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+type jwtHeader struct {
+	Alg string
+	Kid string
+}
+
+// audience is the aud claim, which is either one string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// registeredClaims are the claims of RFC 7519 a token is validated against.
+type registeredClaims struct {
+	Iss string
+	Sub string
+	Aud audience
+	Exp *numericDate
+	Nbf *numericDate
+	Iat *numericDate
+}
+
+type numericDate struct {
+	time.Time
+}
+
+func (d *numericDate) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return err
+	}
+	d.Time = time.Unix(0, int64(seconds*float64(time.Second)))
+	return nil
+}
+
+// validate checks the issuer, the audience and the validity window of the
+// claims, allowing skew of difference between our clock and the issuer's.
+func (c registeredClaims) validate(issuer, audience string, skew time.Duration) error {
+	if c.Iss != issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", errInvalidToken, c.Iss)
+	}
+
+	if !slices.Contains(c.Aud, audience) {
+		return fmt.Errorf("%w: not issued for %q", errInvalidToken, audience)
+	}
+
+	now := time.Now()
+	if c.Exp == nil || !now.Before(c.Exp.Add(skew)) {
+		return fmt.Errorf("%w: expired", errInvalidToken)
+	}
+
+	if c.Nbf != nil && now.Add(skew).Before(c.Nbf.Time) {
+		return fmt.Errorf("%w: not valid yet", errInvalidToken)
+	}
+
+	return nil
+}
+
+// verifyJWT checks the signature of a compact JWS against keys, only
+// accepting the algorithms in algs, and returns its payload. The claims in
+// the payload are left for the caller to validate.
+func verifyJWT(ctx context.Context, token string, keys keySet, algs []string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", errInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(algs, header.Alg) {
+		return nil, fmt.Errorf("%w: algorithm %q is not allowed", errInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", errInvalidToken)
+	}
+
+	key, err := keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if err := verifySignature(header.Alg, key, signed, signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", errInvalidToken)
+	}
+
+	return payload, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	errSignature := fmt.Errorf("%w: bad signature", errInvalidToken)
+
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: key does not match algorithm %s", errInvalidToken, alg)
+		}
+
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errSignature
+		}
+		return nil
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve.Params().BitSize != 256 {
+			return fmt.Errorf("%w: key does not match algorithm %s", errInvalidToken, alg)
+		}
+
+		if len(signature) != 64 {
+			return errSignature
+		}
+
+		digest := sha256.Sum256(signed)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return errSignature
+		}
+		return nil
+	case "EdDSA":
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: key does not match algorithm %s", errInvalidToken, alg)
+		}
+
+		if !ed25519.Verify(edKey, signed, signature) {
+			return errSignature
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: algorithm %q is not supported", errInvalidToken, alg)
+	}
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed", errInvalidToken)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed: %v", errInvalidToken, err)
+	}
+
+	return nil
+}
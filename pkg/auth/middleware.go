@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request
+	// carries no credentials it understands, so the next one can try.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is wrapped by an Authenticator when the request
+	// carries credentials it understands but does not accept.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrNoWorkspace is returned when a request reaches authentication
+	// before its workspace was resolved.
+	ErrNoWorkspace = errors.New("request has no workspace")
+)
+
+// Authenticator finds out who made a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+// Require returns a middleware that lets requests through once one of the
+// authenticators accepts them and the identity belongs to the workspace of
+// the request and has scope, storing the identity in the request context.
+// Other requests are answered with 401 or 403 through apierror, as are
+// requests failing a CSRF check.
+func Require(logger gsdlogger.Logger, scope string, authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := workspace.FromContext(r.Context()); !ok {
+				logger.ErrorContext(r.Context(), "could not authenticate request", "err", ErrNoWorkspace)
+				apierror.Error(w, "could not authenticate request", http.StatusInternalServerError)
+				return
+			}
+
+			identity, err := authenticate(r, authenticators)
+			if errors.Is(err, ErrNoCredentials) || errors.Is(err, ErrInvalidCredentials) {
+				logger.DebugContext(r.Context(), "could not authenticate request", "err", err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="gogsd"`)
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthenticated, err.Error())
+				return
+			}
+
+			if errors.Is(err, ErrCSRF) {
+				logger.DebugContext(r.Context(), "could not authenticate request", "err", err)
+				apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, err.Error())
+				return
+			}
+
+			if err != nil {
+				logger.ErrorContext(r.Context(), "could not authenticate request", "err", err)
+				apierror.Error(w, "could not authenticate request", http.StatusInternalServerError)
+				return
+			}
+
+			// credentials never carry over to another workspace, even for users
+			// sharing a name.
+			if ws, _ := workspace.FromContext(r.Context()); identity.User.WorkspaceID != ws.ID {
+				logger.DebugContext(r.Context(), "identity from another workspace", "user", identity.User.ID, "workspace", ws.ID)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="gogsd"`)
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthenticated, ErrInvalidCredentials.Error())
+				return
+			}
+
+			if !identity.HasScope(scope) {
+				logger.DebugContext(r.Context(), "missing scope", "user", identity.User.ID, "scope", scope)
+				apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, fmt.Sprintf("missing scope %s", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+func authenticate(r *http.Request, authenticators []Authenticator) (Identity, error) {
+	for _, authenticator := range authenticators {
+		identity, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return identity, err
+	}
+
+	return Identity{}, ErrNoCredentials
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/requestid"
+)
+
+const (
+	// OIDCStateCookie binds a login to the browser that started it, so a
+	// callback can not be replayed into someone else's browser.
+	OIDCStateCookie = "__Host-gogsd_oidc_state"
+
+	oidcLoginTTL    = 10 * time.Minute
+	oidcClockSkew   = time.Minute
+	oidcHTTPTimeout = 10 * time.Second
+)
+
+// ErrOIDCLogin is wrapped when a callback does not belong to a login we
+// started, or the provider sent the user back with an error.
+var ErrOIDCLogin = errors.New("oidc login failed")
+
+// OIDCConfig is how gogsd is registered with an OpenID Connect provider.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// PostLoginURL is where the browser is sent once logged in.
+	PostLoginURL string
+}
+
+// OIDCClaims are the claims of a validated ID token gogsd uses.
+type OIDCClaims struct {
+	Issuer            string
+	Subject           string
+	PreferredUsername string
+	Email             string
+}
+
+type idTokenClaims struct {
+	registeredClaims
+	Nonce             string
+	Azp               string
+	PreferredUsername string `json:"preferred_username"`
+	Email             string
+}
+
+type oidcLogin struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+// OIDCProvider runs the authorization code flow with PKCE against one
+// provider. Logins in progress are kept in memory for oidcLoginTTL.
+type OIDCProvider struct {
+	config        OIDCConfig
+	client        *http.Client
+	authEndpoint  string
+	tokenEndpoint string
+	keys          *RemoteJWKS
+
+	mu     sync.Mutex
+	logins map[string]oidcLogin
+}
+
+// NewOIDCProvider reads the discovery document of the issuer.
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	client := &http.Client{Timeout: oidcHTTPTimeout, Transport: requestid.Transport{}}
+
+	discoveryURL := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch oidc discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch oidc discovery document: status %d", resp.StatusCode)
+	}
+
+	var discovery struct {
+		Issuer                string
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JwksURI               string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("could not decode oidc discovery document: %w", err)
+	}
+
+	if discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("oidc discovery document is for issuer %q instead of %q", discovery.Issuer, config.Issuer)
+	}
+
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, fmt.Errorf("oidc discovery document is missing endpoints")
+	}
+
+	return &OIDCProvider{
+		config:        config,
+		client:        client,
+		authEndpoint:  discovery.AuthorizationEndpoint,
+		tokenEndpoint: discovery.TokenEndpoint,
+		keys:          NewRemoteJWKS(client, discovery.JwksURI),
+		logins:        make(map[string]oidcLogin),
+	}, nil
+}
+
+// PostLoginURL is where the browser is sent once logged in.
+func (p *OIDCProvider) PostLoginURL() string {
+	return p.config.PostLoginURL
+}
+
+// Begin starts a login and returns its state, which the caller binds to the
+// browser, and the URL of the provider to send the browser to.
+func (p *OIDCProvider) Begin() (state, authURL string, err error) {
+	state, err = randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	for key, login := range p.logins {
+		if now.After(login.expires) {
+			delete(p.logins, key)
+		}
+	}
+	p.logins[state] = oidcLogin{nonce: nonce, verifier: verifier, expires: now.Add(oidcLoginTTL)}
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {"openid profile email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		separator = "&"
+	}
+
+	return state, p.authEndpoint + separator + query.Encode(), nil
+}
+
+// Finish completes the login of a callback. boundState is the state the
+// browser was bound to by Begin and callback holds the query the provider
+// sent the browser back with.
+func (p *OIDCProvider) Finish(ctx context.Context, boundState string, callback url.Values) (OIDCClaims, error) {
+	if providerErr := callback.Get("error"); providerErr != "" {
+		return OIDCClaims{}, fmt.Errorf("%w: provider answered %s", ErrOIDCLogin, providerErr)
+	}
+
+	state := callback.Get("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(boundState)) != 1 {
+		return OIDCClaims{}, fmt.Errorf("%w: state does not match", ErrOIDCLogin)
+	}
+
+	p.mu.Lock()
+	login, found := p.logins[state]
+	delete(p.logins, state)
+	p.mu.Unlock()
+
+	if !found || time.Now().After(login.expires) {
+		return OIDCClaims{}, fmt.Errorf("%w: unknown or expired state", ErrOIDCLogin)
+	}
+
+	idToken, err := p.exchange(ctx, callback.Get("code"), login.verifier)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	return p.verifyIDToken(ctx, idToken, login.nonce)
+}
+
+func (p *OIDCProvider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("could not exchange oidc code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("%w: provider rejected the code with status %d", ErrOIDCLogin, resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not exchange oidc code: status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("could not decode oidc token response: %w", err)
+	}
+
+	if token.IDToken == "" {
+		return "", fmt.Errorf("%w: token response has no id token", ErrOIDCLogin)
+	}
+
+	return token.IDToken, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, idToken, nonce string) (OIDCClaims, error) {
+	payload, err := verifyJWT(ctx, idToken, p.keys, []string{"RS256", "ES256"})
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return OIDCClaims{}, fmt.Errorf("%w: malformed claims: %v", errInvalidToken, err)
+	}
+
+	if err := claims.validate(p.config.Issuer, p.config.ClientID, oidcClockSkew); err != nil {
+		return OIDCClaims{}, err
+	}
+
+	if len(claims.Aud) > 1 && claims.Azp != p.config.ClientID {
+		return OIDCClaims{}, fmt.Errorf("%w: authorized party is %q", errInvalidToken, claims.Azp)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return OIDCClaims{}, fmt.Errorf("%w: nonce does not match", errInvalidToken)
+	}
+
+	if claims.Sub == "" {
+		return OIDCClaims{}, fmt.Errorf("%w: no subject", errInvalidToken)
+	}
+
+	return OIDCClaims{
+		Issuer:            claims.Iss,
+		Subject:           claims.Sub,
+		PreferredUsername: claims.PreferredUsername,
+		Email:             claims.Email,
+	}, nil
+}
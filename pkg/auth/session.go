@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+// The __Host- prefix makes browsers refuse the cookies unless they are
+// Secure, have no Domain and have Path=/, so no subdomain can plant them.
+const (
+	SessionCookie = "__Host-gogsd_session"
+	// CSRFCookie holds the CSRF token of the session where scripts of the
+	// page can read it and send it back in CSRFHeader.
+	CSRFCookie = "__Host-gogsd_csrf"
+	CSRFHeader = "X-CSRF-Token"
+
+	sessionTTL = 7 * 24 * time.Hour
+)
+
+// ErrCSRF is returned by Sessions for a state changing request whose CSRF
+// header does not match its session. Require answers it with 403.
+var ErrCSRF = errors.New("missing or invalid csrf token")
+
+// Sessions are cookie based logins for browsers. Session tokens are only
+// stored hashed. Sessions grant reading and writing todos but not admin.
+type Sessions struct {
+	queries *database.Queries
+}
+
+func NewSessions(queries *database.Queries) *Sessions {
+	return &Sessions{queries: queries}
+}
+
+func (s *Sessions) Authenticate(r *http.Request) (Identity, error) {
+	session, err := s.session(r)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if !isSafeMethod(r.Method) {
+		token := r.Header.Get(CSRFHeader)
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(session.CsrfToken)) != 1 {
+			return Identity{}, ErrCSRF
+		}
+	}
+
+	user, err := s.queries.GetUser(r.Context(), session.UserID)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{User: user, Scopes: []string{ScopeTodosRead, ScopeTodosWrite}}, nil
+}
+
+// Start logs userID in with a new session and sets its cookies. A session
+// the request already carried is deleted first, so a session id planted
+// before login is never the one that ends up authenticated.
+func (s *Sessions) Start(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64) (database.Session, error) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		if err := s.queries.DeleteSessionByTokenHash(ctx, hashSessionToken(cookie.Value)); err != nil {
+			return database.Session{}, err
+		}
+	}
+
+	now := time.Now().UTC()
+	err := s.queries.DeleteExpiredUserSessions(ctx, database.DeleteExpiredUserSessionsParams{
+		UserID:    userID,
+		ExpiresAt: now,
+	})
+	if err != nil {
+		return database.Session{}, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return database.Session{}, err
+	}
+
+	csrfToken, err := randomToken()
+	if err != nil {
+		return database.Session{}, err
+	}
+
+	session, err := s.queries.CreateSession(ctx, database.CreateSessionParams{
+		UserID:    userID,
+		TokenHash: hashSessionToken(token),
+		CsrfToken: csrfToken,
+		ExpiresAt: now.Add(sessionTTL),
+	})
+	if err != nil {
+		return database.Session{}, err
+	}
+
+	setSessionCookies(w, token, csrfToken, session.ExpiresAt)
+	return session, nil
+}
+
+// Sweep deletes the sessions of every user that expired, which Start only
+// does for the user logging in.
+func (s *Sessions) Sweep(ctx context.Context) (int64, error) {
+	return s.queries.DeleteExpiredSessions(ctx, time.Now().UTC())
+}
+
+// End deletes the session the request carries, if any, and clears its
+// cookies.
+func (s *Sessions) End(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		if err := s.queries.DeleteSessionByTokenHash(ctx, hashSessionToken(cookie.Value)); err != nil {
+			return err
+		}
+	}
+
+	setSessionCookies(w, "", "", time.Unix(0, 0))
+	return nil
+}
+
+func (s *Sessions) session(r *http.Request) (database.Session, error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return database.Session{}, ErrNoCredentials
+	}
+
+	session, err := s.queries.GetSessionByTokenHash(r.Context(), hashSessionToken(cookie.Value))
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Session{}, fmt.Errorf("%w: unknown session", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return database.Session{}, err
+	}
+
+	if !time.Now().Before(session.ExpiresAt) {
+		return database.Session{}, fmt.Errorf("%w: session expired", ErrInvalidCredentials)
+	}
+
+	return session, nil
+}
+
+// VerifyPassword checks password against the hash of user. Users without a
+// password never match, but take as long to check as users with one so the
+// time a login takes does not tell which names exist.
+func VerifyPassword(user database.User, password string) (bool, error) {
+	if !user.PasswordHash.Valid {
+		CheckPassword(dummyPasswordHash(), password)
+		return false, nil
+	}
+
+	return CheckPassword(user.PasswordHash.String, password)
+}
+
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := HashPassword("gogsd")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+func setSessionCookies(w http.ResponseWriter, token, csrfToken string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func randomToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+func hashSessionToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginThrottle locks keys, such as a user name or a client address, out of
+// logging in once they failed too many times within a window. The lockout
+// lasts until the window of the first failure ends.
+type LoginThrottle struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[string]loginFailures
+}
+
+type loginFailures struct {
+	count int
+	since time.Time
+}
+
+func NewLoginThrottle(max int, window time.Duration) *LoginThrottle {
+	return &LoginThrottle{
+		max:      max,
+		window:   window,
+		failures: make(map[string]loginFailures),
+	}
+}
+
+// Wait returns how long the longest locked out of keys has to wait before
+// trying again, or zero when none of them is locked out.
+func (t *LoginThrottle) Wait(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		failures, found := t.failures[key]
+		if !found || failures.count < t.max {
+			continue
+		}
+
+		if left := failures.since.Add(t.window).Sub(now); left > wait {
+			wait = left
+		}
+	}
+
+	return wait
+}
+
+// Fail records a failed login for every key.
+func (t *LoginThrottle) Fail(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for key, failures := range t.failures {
+		if !now.Before(failures.since.Add(t.window)) {
+			delete(t.failures, key)
+		}
+	}
+
+	for _, key := range keys {
+		failures, found := t.failures[key]
+		if !found {
+			failures.since = now
+		}
+		failures.count++
+		t.failures[key] = failures
+	}
+}
+
+// Reset forgets the failures of keys after a successful login.
+func (t *LoginThrottle) Reset(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		delete(t.failures, key)
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+// ErrNoFreeName is returned by LinkedUser when every name a new user could
+// get is taken.
+var ErrNoFreeName = errors.New("every name for the user is already taken")
+
+// LinkedUser returns the user of workspace linked to subject at issuer.
+// Subjects seen for the first time get a new user named after the first of
+// names that is still free in the workspace. Users are never linked by name,
+// which would let an issuer take over accounts.
+func LinkedUser(ctx context.Context, queries *database.Queries, workspaceID int64, issuer, subject string, names ...string) (database.User, error) {
+	var user database.User
+	err := queries.ExecTx(ctx, func(q *database.Queries) error {
+		var err error
+		user, err = q.GetUserByIdentity(ctx, database.GetUserByIdentityParams{
+			WorkspaceID: workspaceID,
+			Issuer:      issuer,
+			Subject:     subject,
+		})
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+
+			_, err := q.GetUserByName(ctx, database.GetUserByNameParams{
+				WorkspaceID: workspaceID,
+				Name:        name,
+			})
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			user, err = q.CreateUser(ctx, database.CreateUserParams{
+				WorkspaceID: workspaceID,
+				Name:        name,
+			})
+			if err != nil {
+				return err
+			}
+
+			return q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+				WorkspaceID: workspaceID,
+				UserID:      user.ID,
+				Issuer:      issuer,
+				Subject:     subject,
+			})
+		}
+
+		return ErrNoFreeName
+	})
+
+	return user, err
+}
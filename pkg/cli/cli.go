@@ -0,0 +1,234 @@
+// Package cli is the gogsd command line client. Its commands call a running
+// server through pkg/client, or with -offline open the server's SQLite
+// database and serve the same routes in process.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/juancortelezzi/gogsd/pkg/client"
+)
+
+// command is a subcommand of gogsd. setup adds the flags of the command and
+// returns what runs it once they are parsed.
+type command struct {
+	name    string
+	args    string
+	summary string
+	setup   func(flags *flag.FlagSet) func(ctx context.Context, s *session, args []string) error
+}
+
+// commands are listed by help in this order. They are set in init because
+// completion lists them.
+var commands []command
+
+func init() {
+	commands = []command{
+		addCommand,
+		lsCommand,
+		searchCommand,
+		doneCommand,
+		editCommand,
+		tagCommand,
+		rmCommand,
+		completionCommand,
+	}
+}
+
+func lookup(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// IsCommand reports whether name is a command of the client, or help.
+func IsCommand(name string) bool {
+	_, ok := lookup(name)
+	return ok || name == "help"
+}
+
+// usageError is returned by commands called with the wrong arguments, which
+// exit with 2 after printing the usage of the command.
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+func usageErrorf(format string, args ...any) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// session is what a command runs with. The client is only made when a
+// command asks for it, so commands that do not call the server never fail
+// because of how it is configured.
+type session struct {
+	cfg    Config
+	stdout io.Writer
+
+	client *client.Client
+	close  func() error
+}
+
+func (s *session) Client(ctx context.Context) (*client.Client, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	if s.cfg.Offline {
+		transport, close, err := openOffline(ctx, s.cfg.Database, s.cfg.User)
+		if err != nil {
+			return nil, err
+		}
+		s.close = close
+
+		// the offline transport never fails the way retries help with.
+		s.client, err = client.New(offlineURL, client.WithTransport(transport), client.WithRetries(0, 0, 0))
+		return s.client, err
+	}
+
+	var opts []client.Option
+	if s.cfg.APIKey != "" {
+		opts = append(opts, client.WithTransport(&client.BearerTransport{Token: s.cfg.APIKey}))
+	}
+	if s.cfg.Workspace != "" {
+		opts = append(opts, client.WithWorkspace(s.cfg.Workspace))
+	}
+
+	var err error
+	s.client, err = client.New(s.cfg.Server, opts...)
+	return s.client, err
+}
+
+// Run runs the command named by args[0] with the rest of args and returns
+// the status the process should exit with: 0 when the command worked, 1
+// when it failed and 2 when it was called wrong.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer, lookupEnv func(string) (string, bool)) int {
+	if len(args) == 0 || args[0] == "help" {
+		if len(args) > 1 {
+			if cmd, ok := lookup(args[1]); ok {
+				flags, _, _, _ := newFlagSet(cmd, stdout)
+				flags.Usage()
+				return 0
+			}
+		}
+		printUsage(stdout)
+		return 0
+	}
+
+	cmd, ok := lookup(args[0])
+	if !ok {
+		fmt.Fprintf(stderr, "gogsd: unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return 2
+	}
+
+	flags, settings, flagged, run := newFlagSet(cmd, stderr)
+	positional, err := parseArgs(flags, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(flags, settings, *flagged, lookupEnv)
+	if err != nil {
+		fmt.Fprintf(stderr, "gogsd: invalid configuration: %v\n", err)
+		return 2
+	}
+
+	s := &session{cfg: cfg, stdout: stdout}
+	err = run(ctx, s, positional)
+	if s.close != nil {
+		if closeErr := s.close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	var usage usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(stderr, "gogsd %s: %v\n", cmd.name, usage)
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gogsd %s: %v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+// newFlagSet returns the flags of cmd, which are its own and the ones of the
+// configuration parsed into flagged, and what runs cmd once they are parsed.
+func newFlagSet(cmd command, output io.Writer) (*flag.FlagSet, *settings, *Config, func(context.Context, *session, []string) error) {
+	flags := flag.NewFlagSet("gogsd "+cmd.name, flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.Usage = func() {
+		fmt.Fprintf(output, "usage: gogsd %s [flags] %s\n\n%s\n\nflags:\n", cmd.name, cmd.args, cmd.summary)
+		flags.PrintDefaults()
+	}
+
+	run := cmd.setup(flags)
+	flagged := defaultConfig()
+	settings := newSettings(&flagged)
+	settings.register(flags)
+	return flags, settings, &flagged, run
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: gogsd <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "gogsd help <command> lists the flags of a command.")
+}
+
+// parseArgs parses flags wherever they are among args, unlike
+// flag.FlagSet.Parse which stops at the first argument that is not one.
+// Everything after -- is an argument.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := flags.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// parseIDs parses every argument as the id of a todo.
+func parseIDs(args []string) ([]int64, error) {
+	ids := make([]int64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, usageErrorf("%q is not the id of a todo", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
@@ -0,0 +1,361 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	"github.com/juancortelezzi/gogsd/pkg/client"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+// pageSize is how many todos listing commands fetch at a time.
+const pageSize = 100
+
+var addCommand = command{
+	name:    "add",
+	args:    "<description>",
+	summary: "add a todo",
+	setup: func(flags *flag.FlagSet) func(context.Context, *session, []string) error {
+		done := flags.Bool("done", false, "add the todo as done")
+		list := flags.Int64("list", 0, "id of the list to add the todo to")
+
+		return func(ctx context.Context, s *session, args []string) error {
+			if len(args) == 0 {
+				return usageErrorf("missing description")
+			}
+
+			params := client.TodoParams{Description: strings.Join(args, " "), Done: *done}
+			if *list != 0 {
+				params.ListID = list
+			}
+
+			c, err := s.Client(ctx)
+			if err != nil {
+				return err
+			}
+
+			todo, err := c.CreateTodo(ctx, params)
+			if err != nil {
+				return err
+			}
+			return s.print(ctx, c, todo)
+		}
+	},
+}
+
+// filter picks the todos listing commands print.
+type filter struct {
+	open, done bool
+	list       int64
+	tags       []string
+	text       string
+}
+
+func (f *filter) register(flags *flag.FlagSet) {
+	flags.BoolVar(&f.open, "open", false, "only list todos that are not done")
+	flags.BoolVar(&f.done, "done", false, "only list done todos")
+	flags.Int64Var(&f.list, "list", 0, "only list the todos of the list with this id")
+	flags.Func("tag", "only list todos tagged with this, may be repeated", func(raw string) error {
+		tag, err := parseTag(raw)
+		if err != nil {
+			return err
+		}
+		f.tags = append(f.tags, tag)
+		return nil
+	})
+}
+
+func (f *filter) match(todo client.Todo) bool {
+	if f.open && todo.Done || f.done && !todo.Done {
+		return false
+	}
+	if f.list != 0 && (!todo.ListID.Valid || todo.ListID.Int64 != f.list) {
+		return false
+	}
+	for _, tag := range f.tags {
+		if !hasTag(todo.Description, tag) {
+			return false
+		}
+	}
+	return strings.Contains(strings.ToLower(todo.Description), strings.ToLower(f.text))
+}
+
+// print prints every todo matching f, fetched a page at a time, or only
+// the todos of its list when it has one.
+func (f *filter) print(ctx context.Context, s *session) error {
+	if f.open && f.done {
+		return usageErrorf("-open and -done can not be used together")
+	}
+
+	c, err := s.Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	var todos []client.Todo
+	if f.list != 0 {
+		inList, err := c.ListListTodos(ctx, f.list)
+		if err != nil {
+			return err
+		}
+
+		listed, err := withRoles(ctx, c, inList)
+		if err != nil {
+			return err
+		}
+		for _, todo := range listed {
+			if f.match(todo) {
+				todos = append(todos, todo)
+			}
+		}
+		return printTodos(s.stdout, s.cfg.Output, todos)
+	}
+
+	it := c.Todos(ctx, pageSize)
+	for it.Next() {
+		if f.match(it.Todo()) {
+			todos = append(todos, it.Todo())
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return printTodos(s.stdout, s.cfg.Output, todos)
+}
+
+var lsCommand = command{
+	name:    "ls",
+	summary: "list todos",
+	setup: func(flags *flag.FlagSet) func(context.Context, *session, []string) error {
+		var f filter
+		f.register(flags)
+
+		return func(ctx context.Context, s *session, args []string) error {
+			if len(args) > 0 {
+				return usageErrorf("unexpected arguments: %s", strings.Join(args, " "))
+			}
+			return f.print(ctx, s)
+		}
+	},
+}
+
+var searchCommand = command{
+	name:    "search",
+	args:    "<text>",
+	summary: "list todos with descriptions containing text, ignoring case",
+	setup: func(flags *flag.FlagSet) func(context.Context, *session, []string) error {
+		var f filter
+		f.register(flags)
+
+		return func(ctx context.Context, s *session, args []string) error {
+			if len(args) == 0 {
+				return usageErrorf("missing text to search for")
+			}
+			f.text = strings.Join(args, " ")
+			return f.print(ctx, s)
+		}
+	},
+}
+
+var doneCommand = command{
+	name:    "done",
+	args:    "<id>...",
+	summary: "mark todos as done",
+	setup: func(flags *flag.FlagSet) func(context.Context, *session, []string) error {
+		undo := flags.Bool("undo", false, "mark the todos as not done instead")
+		force := flags.Bool("force", false, "mark todos done even when they are blocked by open todos")
+
+		return func(ctx context.Context, s *session, args []string) error {
+			done := !*undo
+			return patchEach(ctx, s, args, func(context.Context, *client.Client, int64) (client.TodoPatch, error) {
+				return client.TodoPatch{Done: &done}, nil
+			}, *force)
+		}
+	},
+}
+
+var editCommand = command{
+	name:    "edit",
+	args:    "<id> [description]",
+	summary: "change the description of a todo or move it to another list",
+	setup: func(flags *flag.FlagSet) func(context.Context, *session, []string) error {
+		list := flags.Int64("list", 0, "id of the list to move the todo to")
+
+		return func(ctx context.Context, s *session, args []string) error {
+			if len(args) == 0 {
+				return usageErrorf("missing id")
+			}
+
+			var patch client.TodoPatch
+			if len(args) > 1 {
+				description := strings.Join(args[1:], " ")
+				patch.Description = &description
+			}
+			if *list != 0 {
+				patch.ListID = list
+			}
+			if patch.Description == nil && patch.ListID == nil {
+				return usageErrorf("nothing to change, give a description or -list")
+			}
+
+			return patchEach(ctx, s, args[:1], func(context.Context, *client.Client, int64) (client.TodoPatch, error) {
+				return patch, nil
+			}, false)
+		}
+	},
+}
+
+var tagCommand = command{
+	name:    "tag",
+	args:    "<id> <tag>...",
+	summary: "tag a todo, tags are #words of its description",
+	setup: func(flags *flag.FlagSet) func(context.Context, *session, []string) error {
+		remove := flags.Bool("remove", false, "remove the tags instead")
+
+		return func(ctx context.Context, s *session, args []string) error {
+			if len(args) < 2 {
+				return usageErrorf("missing id or tags")
+			}
+
+			tags := make([]string, len(args)-1)
+			for i, arg := range args[1:] {
+				tag, err := parseTag(arg)
+				if err != nil {
+					return err
+				}
+				tags[i] = tag
+			}
+
+			return patchEach(ctx, s, args[:1], func(ctx context.Context, c *client.Client, id int64) (client.TodoPatch, error) {
+				todo, err := c.GetTodo(ctx, id)
+				if err != nil {
+					return client.TodoPatch{}, err
+				}
+
+				description := addTags(todo.Description, tags)
+				if *remove {
+					description = removeTags(todo.Description, tags)
+				}
+				// a todo changed since it was read conflicts instead of losing
+				// the change.
+				return client.TodoPatch{Description: &description, Version: &todo.Version}, nil
+			}, false)
+		}
+	},
+}
+
+var rmCommand = command{
+	name:    "rm",
+	args:    "<id>...",
+	summary: "delete todos",
+	setup: func(flags *flag.FlagSet) func(context.Context, *session, []string) error {
+		return func(ctx context.Context, s *session, args []string) error {
+			ids, err := parseIDs(args)
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return usageErrorf("missing id")
+			}
+
+			c, err := s.Client(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, id := range ids {
+				if err := c.DeleteTodo(ctx, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	},
+}
+
+// patchEach patches every todo in args with the patch change returns for
+// it, and prints the patched todos. It stops at the first todo that fails,
+// the ones before it stay patched.
+func patchEach(
+	ctx context.Context,
+	s *session,
+	args []string,
+	change func(ctx context.Context, c *client.Client, id int64) (client.TodoPatch, error),
+	force bool,
+) error {
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return usageErrorf("missing id")
+	}
+
+	c, err := s.Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	patched := make([]database.Todo, 0, len(ids))
+	for _, id := range ids {
+		var patch client.TodoPatch
+		patch, err = change(ctx, c, id)
+		if err != nil {
+			break
+		}
+
+		var todo database.Todo
+		todo, err = c.PatchTodo(ctx, id, patch, force)
+		if err != nil {
+			break
+		}
+		patched = append(patched, todo)
+	}
+
+	// the todos patched before one failed are printed all the same.
+	if len(patched) > 0 || err == nil {
+		if printErr := s.print(ctx, c, patched...); err == nil {
+			err = printErr
+		}
+	}
+	return err
+}
+
+// print prints todos the commands changed as listing commands would, with
+// the caller's role in them.
+func (s *session) print(ctx context.Context, c *client.Client, todos ...database.Todo) error {
+	printed, err := withRoles(ctx, c, todos)
+	if err != nil {
+		return err
+	}
+	return printTodos(s.stdout, s.cfg.Output, printed)
+}
+
+// withRoles pairs todos with the caller's role in them, which is owner
+// outside of lists and their role in the list otherwise. The lists are only
+// fetched when a todo is in one.
+func withRoles(ctx context.Context, c *client.Client, todos []database.Todo) ([]client.Todo, error) {
+	var roles map[int64]string
+	withRoles := make([]client.Todo, len(todos))
+	for i, todo := range todos {
+		withRoles[i] = client.Todo{Todo: todo, Role: client.RoleOwner}
+		if !todo.ListID.Valid {
+			continue
+		}
+
+		if roles == nil {
+			lists, err := c.ListLists(ctx)
+			if err != nil {
+				return nil, err
+			}
+			roles = make(map[int64]string, len(lists))
+			for _, list := range lists {
+				roles[list.ID] = list.Role
+			}
+		}
+		withRoles[i].Role = roles[todo.ListID.Int64]
+	}
+	return withRoles, nil
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var shells = []string{"bash", "zsh", "fish"}
+
+var completionCommand = command{
+	name:    "completion",
+	args:    "<bash|zsh|fish>",
+	summary: "print a script completing commands and flags for a shell",
+	setup: func(flags *flag.FlagSet) func(context.Context, *session, []string) error {
+		return func(ctx context.Context, s *session, args []string) error {
+			if len(args) != 1 {
+				return usageErrorf("name one shell of %s", strings.Join(shells, ", "))
+			}
+
+			switch args[0] {
+			case "bash":
+				return writeBashCompletion(s.stdout, false)
+			case "zsh":
+				return writeBashCompletion(s.stdout, true)
+			case "fish":
+				return writeFishCompletion(s.stdout)
+			default:
+				return usageErrorf("unknown shell %q, completion is written for %s", args[0], strings.Join(shells, ", "))
+			}
+		}
+	},
+}
+
+// commandFlags returns the flags of cmd, its own and the shared ones.
+func commandFlags(cmd command) []*flag.Flag {
+	flags, _, _, _ := newFlagSet(cmd, io.Discard)
+	var all []*flag.Flag
+	flags.VisitAll(func(f *flag.Flag) {
+		all = append(all, f)
+	})
+	return all
+}
+
+// commandNames are the words completed after gogsd.
+func commandNames() []string {
+	names := []string{"help"}
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// writeBashCompletion writes a bash completion function, which zsh runs
+// through bashcompinit.
+func writeBashCompletion(w io.Writer, zsh bool) error {
+	var b strings.Builder
+
+	if zsh {
+		b.WriteString("autoload -U +X bashcompinit && bashcompinit\n\n")
+	}
+
+	b.WriteString("_gogsd() {\n")
+	b.WriteString("\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	b.WriteString("\tif [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(&b, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	b.WriteString("\t\treturn\n\tfi\n\n")
+
+	b.WriteString("\tcase $prev in\n")
+	fmt.Fprintf(&b, "\t-o|-output|--output) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", strings.Join(outputs, " "))
+	b.WriteString("\tesac\n\n")
+
+	b.WriteString("\tcase ${COMP_WORDS[1]} in\n")
+	for _, c := range commands {
+		names := make([]string, 0)
+		for _, f := range commandFlags(c) {
+			names = append(names, "-"+f.Name)
+		}
+		fmt.Fprintf(&b, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", c.name, strings.Join(names, " "))
+	}
+	fmt.Fprintf(&b, "\thelp) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", strings.Join(commandNames()[1:], " "))
+	b.WriteString("\tesac\n")
+
+	// completing a shell after completion beats completing its flags.
+	fmt.Fprintf(&b, "\tif [ \"${COMP_WORDS[1]}\" = completion ] && [[ $cur != -* ]]; then\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\tfi\n", strings.Join(shells, " "))
+	b.WriteString("}\n\ncomplete -F _gogsd gogsd\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeFishCompletion(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString("complete -c gogsd -f\n")
+	b.WriteString("complete -c gogsd -n __fish_use_subcommand -a help -d 'list the commands'\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "complete -c gogsd -n __fish_use_subcommand -a %s -d %s\n", c.name, fishQuote(c.summary))
+	}
+
+	for _, c := range commands {
+		for _, f := range commandFlags(c) {
+			fmt.Fprintf(&b, "complete -c gogsd -n '__fish_seen_subcommand_from %s' -o %s -d %s", c.name, f.Name, fishQuote(f.Usage))
+			if f.Name == "o" || f.Name == "output" {
+				fmt.Fprintf(&b, " -x -a %s", fishQuote(strings.Join(outputs, " ")))
+			}
+			b.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&b, "complete -c gogsd -n '__fish_seen_subcommand_from completion' -a %s\n", fishQuote(strings.Join(shells, " ")))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
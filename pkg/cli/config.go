@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/juancortelezzi/gogsd/pkg/config"
+)
+
+// output formats.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputPlain = "plain"
+)
+
+var outputs = []string{outputTable, outputJSON, outputPlain}
+
+// Config is what the commands need to reach the todos, read from the config
+// file, the environment and the flags shared by every command.
+type Config struct {
+	// Server is the base URL of the gogsd server.
+	Server    string `toml:"server" yaml:"server"`
+	APIKey    string `toml:"api_key" yaml:"api_key"`
+	Workspace string `toml:"workspace" yaml:"workspace"`
+	Output    string `toml:"output" yaml:"output"`
+	// Offline opens Database instead of calling Server, acting as User.
+	Offline  bool   `toml:"offline" yaml:"offline"`
+	Database string `toml:"database" yaml:"database"`
+	User     string `toml:"user" yaml:"user"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Server: "http://localhost:3000",
+		Output: outputTable,
+		User:   "local",
+	}
+}
+
+// settings binds the fields of a Config to their environment variable and
+// flag. The database shares DATABASE_URL with the server, so offline
+// commands open the server's database without more configuration.
+type settings struct {
+	configFile string
+	fields     []field
+}
+
+type field struct {
+	name  string
+	env   string
+	usage string
+	value any
+}
+
+func newSettings(c *Config) *settings {
+	return &settings{fields: []field{
+		{"server", "GOGSD_SERVER", "base url of the server", &c.Server},
+		{"api-key", "GOGSD_API_KEY", "API key to call the server with", &c.APIKey},
+		{"workspace", "GOGSD_WORKSPACE", "slug of the workspace, the one of the server's host when empty", &c.Workspace},
+		{"output", "GOGSD_OUTPUT", "output format, table, json or plain", &c.Output},
+		{"offline", "GOGSD_OFFLINE", "open the database instead of calling the server", &c.Offline},
+		{"database", "DATABASE_URL", "database opened by -offline", &c.Database},
+		{"user", "GOGSD_USER", "user of the default workspace -offline acts as", &c.User},
+	}}
+}
+
+// register adds the config flag and a flag for every field to flags.
+func (s *settings) register(flags *flag.FlagSet) {
+	flags.StringVar(&s.configFile, "config", "", "config file, TOML or YAML by extension (GOGSD_CONFIG)")
+	for _, f := range s.fields {
+		usage := fmt.Sprintf("%s (%s)", f.usage, f.env)
+		switch v := f.value.(type) {
+		case *string:
+			flags.StringVar(v, f.name, *v, usage)
+		case *bool:
+			flags.BoolVar(v, f.name, *v, usage)
+		}
+	}
+	flags.Var(aliasFlag{flags.Lookup("output")}, "o", "shorthand for -output")
+}
+
+// loadConfig layers, from lowest to highest priority, the defaults, the
+// config file, the environment and the flags that were set, which were
+// parsed into flagged. The config file is the one named by -config or
+// GOGSD_CONFIG, or cli.toml in the gogsd directory of the user's config
+// directory when it exists.
+func loadConfig(flags *flag.FlagSet, s *settings, flagged Config, lookupEnv func(string) (string, bool)) (Config, error) {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if set["o"] {
+		set["output"] = true
+	}
+
+	c := defaultConfig()
+
+	path := s.configFile
+	if path == "" {
+		path, _ = lookupEnv("GOGSD_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "gogsd", "cli.toml")
+		}
+	}
+
+	if path != "" {
+		err := config.DecodeFile(path, &c)
+		if errors.Is(err, fs.ErrNotExist) && !explicit {
+			err = nil
+		}
+		if err != nil {
+			return c, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	flaggedFields := newSettings(&flagged).fields
+	for i, f := range newSettings(&c).fields {
+		if set[f.name] {
+			copyValue(f.value, flaggedFields[i].value)
+			continue
+		}
+
+		if raw, found := lookupEnv(f.env); found {
+			if err := setValue(f.value, raw); err != nil {
+				return c, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+
+	if !slices.Contains(outputs, c.Output) {
+		return c, fmt.Errorf("output must be one of %s, got %q", strings.Join(outputs, ", "), c.Output)
+	}
+	if c.Offline && c.Database == "" {
+		return c, errors.New("-offline needs a database, set database in the config file, DATABASE_URL or -database")
+	}
+	return c, nil
+}
+
+func setValue(dst any, raw string) error {
+	switch dst := dst.(type) {
+	case *string:
+		*dst = raw
+	case *bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		*dst = v
+	}
+	return nil
+}
+
+func copyValue(dst, src any) {
+	switch dst := dst.(type) {
+	case *string:
+		*dst = *src.(*string)
+	case *bool:
+		*dst = *src.(*bool)
+	}
+}
+
+// aliasFlag sets another flag, for shorthands.
+type aliasFlag struct {
+	target *flag.Flag
+}
+
+func (a aliasFlag) String() string {
+	if a.target == nil {
+		return ""
+	}
+	return a.target.Value.String()
+}
+
+func (a aliasFlag) Set(raw string) error {
+	return a.target.Value.Set(raw)
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/cors"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/features"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/metrics"
+	"github.com/juancortelezzi/gogsd/pkg/ratelimit"
+	"github.com/juancortelezzi/gogsd/pkg/routes"
+	"github.com/juancortelezzi/gogsd/pkg/server"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+// offlineURL is the base URL of the client of an offline database, which is
+// never dialed.
+const offlineURL = "http://offline"
+
+// openOffline opens the database at dsl and returns a transport serving
+// gogsd from it in process, so offline commands go through the same
+// validation, workflows and change log as the server's. Every request is
+// made by the user named user of the default workspace. close closes the
+// database.
+//
+// The database is never migrated, as a server of another version may be
+// using it; one missing migrations is refused instead, and so is a file that
+// does not exist yet, which opening would create empty.
+func openOffline(ctx context.Context, dsl, user string) (transport http.RoundTripper, close func() error, err error) {
+	logger := gsdlogger.NewLogger(io.Discard, slog.LevelError)
+
+	if path, ok := database.FilePath(dsl); ok {
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil, fmt.Errorf("could not open database: %w", err)
+		}
+	}
+
+	db, err := database.OpenWithoutMigrating(dsl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open database: %w", err)
+	}
+
+	pending, err := database.PendingMigrations(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("could not check the database migrations: %w", err)
+	}
+
+	if len(pending) > 0 {
+		db.Close()
+		return nil, nil, fmt.Errorf("the database is missing %d migrations, starting the server applies them", len(pending))
+	}
+
+	queries := database.New(db)
+	found, err := queries.GetUserByName(ctx, database.GetUserByNameParams{WorkspaceID: workspace.DefaultID, Name: user})
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("could not get user %s: %w", user, err)
+	}
+
+	cfg := config.Default()
+	// a single command makes a handful of requests, limiting them is
+	// pointless.
+	cfg.RateLimit.Auth, cfg.RateLimit.Read, cfg.RateLimit.Write = "off", "off", "off"
+	rateLimits, err := cfg.RateLimitConfig()
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	handler := server.NewServerHandler(server.HandlerDeps{
+		Deps: routes.Deps{
+			Logger:   logger,
+			Queries:  queries,
+			Validate: validator.New(validator.WithRequiredStructEnabled()),
+			Limiter:  ratelimit.New(ratelimit.NewMemoryStore(), rateLimits),
+			Metrics:  metrics.New(db, queries),
+			Flags:    features.New(cfg.Features),
+			Bearers:  []auth.Authenticator{localUser{found}},
+		},
+		Resolver:     workspace.NewResolver(queries, ""),
+		Policy:       cors.New(nil),
+		MaxBodyBytes: cfg.Limits.MaxBodyBytes,
+	})
+
+	return handlerTransport{handler}, db.Close, nil
+}
+
+// localUser authenticates every request as the offline user, with every
+// scope. Whoever can open the database can do anything with it anyway.
+type localUser struct {
+	user database.User
+}
+
+func (l localUser) Authenticate(r *http.Request) (auth.Identity, error) {
+	return auth.Identity{User: l.user, Scopes: []string{auth.ScopeAdmin}}, nil
+}
+
+// handlerTransport answers requests with a handler instead of sending them.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := &bufferedResponse{header: http.Header{}}
+	t.handler.ServeHTTP(w, r)
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          io.NopCloser(&w.body),
+		ContentLength: int64(w.body.Len()),
+		Request:       r,
+	}, nil
+}
+
+// bufferedResponse is the ResponseWriter of handlerTransport, keeping the
+// whole response in memory.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedResponse) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(data)
+}
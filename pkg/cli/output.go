@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/juancortelezzi/gogsd/pkg/client"
+)
+
+// printTodos writes todos in format. Tables are for people, plain prints
+// one tab separated todo per line without a header for scripts, and JSON is
+// the todos as the server answered with them.
+func printTodos(w io.Writer, format string, todos []client.Todo) error {
+	switch format {
+	case outputJSON:
+		if todos == nil {
+			todos = []client.Todo{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(todos)
+
+	case outputPlain:
+		for _, todo := range todos {
+			_, err := fmt.Fprintf(w, "%d\t%t\t%s\n", todo.ID, todo.Done, todo.Description)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "ID\tDONE\tLIST\tDESCRIPTION")
+		for _, todo := range todos {
+			done := ""
+			if todo.Done {
+				done = "x"
+			}
+
+			list := "-"
+			if todo.ListID.Valid {
+				list = strconv.FormatInt(todo.ListID.Int64, 10)
+			}
+
+			fmt.Fprintf(table, "%d\t%s\t%s\t%s\n", todo.ID, done, list, todo.Description)
+		}
+		return table.Flush()
+	}
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Tags are the words of a description starting with #, so they need no
+// storage of their own and show up wherever the todo does. They are matched
+// ignoring case.
+
+// parseTag returns tag without its #, failing for tags that would not be a
+// single word of a description.
+func parseTag(tag string) (string, error) {
+	name := strings.TrimPrefix(tag, "#")
+	if name == "" || strings.ContainsFunc(name, unicode.IsSpace) || strings.Contains(name, "#") {
+		return "", usageErrorf("%q is not a tag, tags are single words", tag)
+	}
+	return name, nil
+}
+
+func isTag(word, tag string) bool {
+	return strings.HasPrefix(word, "#") && strings.EqualFold(word[1:], tag)
+}
+
+func hasTag(description, tag string) bool {
+	for _, word := range strings.Fields(description) {
+		if isTag(word, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// addTags appends the tags description does not have yet.
+func addTags(description string, tags []string) string {
+	for _, tag := range tags {
+		if !hasTag(description, tag) {
+			description += " #" + tag
+		}
+	}
+	return description
+}
+
+// removeTags drops the words of description that are one of tags, each
+// together with the whitespace before it, or after it for the leading ones.
+// The rest of the text is left as it is.
+func removeTags(description string, tags []string) string {
+	var kept strings.Builder
+	keptWord := false
+	rest := description
+	for {
+		start := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsSpace(r) })
+		if start < 0 {
+			kept.WriteString(rest)
+			return kept.String()
+		}
+
+		end := strings.IndexFunc(rest[start:], unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		} else {
+			end += start
+		}
+
+		space, word := rest[:start], rest[start:end]
+		rest = rest[end:]
+
+		if !slices.ContainsFunc(tags, func(tag string) bool { return isTag(word, tag) }) {
+			kept.WriteString(space)
+			kept.WriteString(word)
+			keptWord = true
+			continue
+		}
+
+		if !keptWord {
+			kept.WriteString(space)
+			rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+// API key scopes.
+const (
+	ScopeTodosRead  = auth.ScopeTodosRead
+	ScopeTodosWrite = auth.ScopeTodosWrite
+	ScopeAdmin      = auth.ScopeAdmin
+)
+
+type User struct {
+	ID        int64
+	Name      string
+	CreatedAt sql.NullTime
+}
+
+// Session is a login. The server sets its cookie on the answer, so logging
+// in only lasts past Login with an http.Client that has a cookie jar, and
+// writes made with it need CSRFToken, see CSRFTransport.
+type Session struct {
+	User      User
+	CSRFToken string
+	ExpiresAt time.Time
+}
+
+// Register creates a user with a password in the workspace of the client.
+func (c *Client) Register(ctx context.Context, name, password string) (User, error) {
+	var user User
+	body := struct{ Name, Password string }{name, password}
+	err := c.do(ctx, http.MethodPost, "/auth/register", nil, body, &user, http.StatusCreated)
+	return user, err
+}
+
+func (c *Client) Login(ctx context.Context, name, password string) (Session, error) {
+	var session Session
+	body := struct{ Name, Password string }{name, password}
+	err := c.do(ctx, http.MethodPost, "/auth/login", nil, body, &session)
+	return session, err
+}
+
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/auth/logout", nil, nil, nil)
+}
+
+// CSRFTransport sends the CSRF token of a session with every request that
+// is not a read, which the server requires of requests authenticated by a
+// session cookie.
+type CSRFTransport struct {
+	Token string
+	// Base sends the requests, http.DefaultTransport when nil.
+	Base http.RoundTripper
+}
+
+func (t *CSRFTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		r = r.Clone(r.Context())
+		r.Header.Set(auth.CSRFHeader, t.Token)
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+// APIKey is what the server shows of a stored key, which leaves out the key
+// itself.
+type APIKey struct {
+	ID         int64
+	Name       string
+	Prefix     string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	CreatedAt  sql.NullTime
+}
+
+// CreatedAPIKey holds a new key, which the server does not keep and only
+// answers with once.
+type CreatedAPIKey struct {
+	Key    string
+	APIKey APIKey
+}
+
+func (c *Client) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	err := c.do(ctx, http.MethodGet, "/api-keys", nil, nil, &keys)
+	return keys, err
+}
+
+// CreateAPIKey creates a key for the caller with scopes, which it must have
+// itself. A nil expiresAt makes a key that never expires.
+func (c *Client) CreateAPIKey(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (CreatedAPIKey, error) {
+	body := struct {
+		Name      string
+		Scopes    []string
+		ExpiresAt *time.Time
+	}{name, scopes, expiresAt}
+
+	var created CreatedAPIKey
+	err := c.do(ctx, http.MethodPost, "/api-keys", nil, body, &created, http.StatusCreated)
+	return created, err
+}
+
+func (c *Client) DeleteAPIKey(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api-keys/%d", id), nil, nil, nil)
+}
+
+// Workspace is a workspace with how many todos it holds.
+type Workspace struct {
+	database.Workspace
+	Todos int64
+}
+
+// WorkspaceParams are what workspaces are created and updated with. Slug is
+// only read by CreateWorkspace and a nil MaxTodos leaves the workspace
+// without a quota.
+type WorkspaceParams struct {
+	Slug     string
+	Name     string
+	MaxTodos *int64
+}
+
+// GetWorkspace returns the workspace of the client.
+func (c *Client) GetWorkspace(ctx context.Context) (Workspace, error) {
+	var ws Workspace
+	err := c.do(ctx, http.MethodGet, "/workspace", nil, nil, &ws)
+	return ws, err
+}
+
+// ListWorkspaces lists every workspace, which takes an admin of the default
+// workspace.
+func (c *Client) ListWorkspaces(ctx context.Context) ([]database.Workspace, error) {
+	var workspaces []database.Workspace
+	err := c.do(ctx, http.MethodGet, "/workspaces", nil, nil, &workspaces)
+	return workspaces, err
+}
+
+func (c *Client) CreateWorkspace(ctx context.Context, params WorkspaceParams) (database.Workspace, error) {
+	var ws database.Workspace
+	err := c.do(ctx, http.MethodPost, "/workspaces", nil, params, &ws, http.StatusCreated)
+	return ws, err
+}
+
+func (c *Client) UpdateWorkspace(ctx context.Context, slug string, params WorkspaceParams) (database.Workspace, error) {
+	body := struct {
+		Name     string
+		MaxTodos *int64
+	}{params.Name, params.MaxTodos}
+
+	var ws database.Workspace
+	err := c.do(ctx, http.MethodPut, pathf("/workspaces/%s", slug), nil, body, &ws)
+	return ws, err
+}
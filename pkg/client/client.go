@@ -0,0 +1,275 @@
+// Package client calls gogsd from Go. Every route has a typed method taking a
+// context, idempotent calls are retried with backoff when the server is busy
+// or unreachable, and failed calls return an *Error decoded from the body the
+// server answered with. The OpenID Connect login is left out, it is a
+// browser redirect rather than a call.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+// Client calls a gogsd server. Credentials are added by the transport of its
+// http.Client, see BearerTransport.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	workspace  string
+
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option changes how a Client calls the server.
+type Option func(*Client)
+
+// WithHTTPClient makes the Client send its requests through httpClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTransport makes the Client send its requests through transport, which
+// is where credentials are added.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		client := *c.httpClient
+		client.Transport = transport
+		c.httpClient = &client
+	}
+}
+
+// WithWorkspace sends every request to the workspace with slug, instead of
+// the one the server resolves from its host name.
+func WithWorkspace(slug string) Option {
+	return func(c *Client) {
+		c.workspace = slug
+	}
+}
+
+// WithRetries retries idempotent calls up to retries times, waiting between
+// min and max before each of them. Zero retries turns retrying off.
+func WithRetries(retries int, min, max time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// New returns a Client calling the server at baseURL. Idempotent calls are
+// retried three times unless WithRetries says otherwise.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse base url: %w", err)
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("base url %q is not an http or https url", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: &http.Client{},
+		retries:    3,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// BearerTransport sends Token in the Authorization header of every request,
+// which is how both API keys and JWTs are sent.
+type BearerTransport struct {
+	Token string
+	// Base sends the requests, http.DefaultTransport when nil.
+	Base http.RoundTripper
+}
+
+func (t *BearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.Token)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+// idempotent methods can be sent again without changing the outcome, so they
+// are the ones retried.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether an answer with status may go away on its own.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do sends body as JSON to path and decodes the answer into out, unless out
+// is nil. Answers with a status other than one of ok are returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any, ok ...int) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !expected(resp.StatusCode, ok) {
+		return decodeError(resp)
+	}
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode answer to %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+func expected(status int, ok []int) bool {
+	if len(ok) == 0 {
+		return status == http.StatusOK
+	}
+	for _, s := range ok {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends a request, retrying it while it is idempotent and the server
+// can not be reached or answers with a retryable status. The body of the
+// returned response must be closed.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal body of %s %s: %w", method, path, err)
+		}
+	}
+
+	target := c.baseURL.JoinPath(path)
+	target.RawQuery = query.Encode()
+
+	retries := 0
+	if idempotent(method) {
+		retries = c.retries
+	}
+
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		if c.workspace != "" {
+			request.Header.Set(workspace.Header, c.workspace)
+		}
+
+		resp, err := c.httpClient.Do(request)
+		if err == nil && (attempt == retries || !retryable(resp.StatusCode)) {
+			return resp, nil
+		}
+		if err != nil && (attempt == retries || ctx.Err() != nil) {
+			return nil, err
+		}
+
+		wait := c.backoff(attempt)
+		if err == nil {
+			if after, ok := retryAfter(resp); ok {
+				wait = max(wait, after)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff doubles the wait with every attempt up to the maximum, and picks a
+// random wait between half of it and all of it so clients failing together
+// do not retry together.
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.minBackoff
+	for i := 0; i < attempt && wait < c.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, c.maxBackoff)
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// retryAfter reads the Retry-After header of resp, in seconds or as a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// pathf formats a path, escaping its string arguments.
+func pathf(format string, args ...any) string {
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			args[i] = url.PathEscape(s)
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
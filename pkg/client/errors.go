@@ -0,0 +1,104 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/requestid"
+)
+
+// errors matched by errors.Is against every *Error with their status.
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrRateLimited     = errors.New("rate limited")
+)
+
+var statusErrors = map[int]error{
+	http.StatusUnauthorized:    ErrUnauthenticated,
+	http.StatusForbidden:       ErrForbidden,
+	http.StatusNotFound:        ErrNotFound,
+	http.StatusConflict:        ErrConflict,
+	http.StatusTooManyRequests: ErrRateLimited,
+}
+
+// Error is a call the server did not answer with success.
+type Error struct {
+	StatusCode int
+	// Code is one of the apierror codes, or empty when the server answered
+	// with a plain text message.
+	Code      string
+	Message   string
+	RequestID string
+	// RetryAfter is how long the server asked to wait before trying again,
+	// or zero when it did not.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+
+	if e.Code != "" {
+		message = fmt.Sprintf("%s: %s", e.Code, message)
+	}
+
+	if e.RequestID != "" {
+		return fmt.Sprintf("gogsd: %d %s (request %s)", e.StatusCode, message, e.RequestID)
+	}
+	return fmt.Sprintf("gogsd: %d %s", e.StatusCode, message)
+}
+
+// Is makes errors.Is(err, ErrNotFound) and the like true for errors with the
+// matching status, and ErrForbidden for exceeded quotas too.
+func (e *Error) Is(target error) bool {
+	if e.Code == apierror.CodeQuotaExceeded && target == ErrForbidden {
+		return true
+	}
+	return statusErrors[e.StatusCode] == target
+}
+
+// decodeError reads the error the server answered resp with, which is either
+// an apierror body or a plain text message.
+func decodeError(resp *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return fmt.Errorf("could not read error answer with status %d: %w", resp.StatusCode, err)
+	}
+
+	apiErr := &Error{
+		StatusCode: resp.StatusCode,
+		Message:    string(bytes.TrimSpace(body)),
+		RequestID:  resp.Header.Get(requestid.Header),
+	}
+	if after, ok := retryAfter(resp); ok {
+		apiErr.RetryAfter = after
+	}
+
+	var structured struct {
+		Error *struct {
+			Code      string
+			Message   string
+			RequestID string
+		}
+	}
+	if json.Unmarshal(body, &structured) == nil && structured.Error != nil {
+		apiErr.Code = structured.Error.Code
+		apiErr.Message = structured.Error.Message
+		if structured.Error.RequestID != "" {
+			apiErr.RequestID = structured.Error.RequestID
+		}
+	}
+
+	return apiErr
+}
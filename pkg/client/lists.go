@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+// roles of list members.
+const (
+	RoleOwner     = "owner"
+	RoleEditor    = "editor"
+	RoleCommenter = "commenter"
+	RoleViewer    = "viewer"
+)
+
+// List is a list together with the caller's role in it.
+type List struct {
+	database.List
+	Role string
+}
+
+func (c *Client) ListLists(ctx context.Context) ([]List, error) {
+	var lists []List
+	err := c.do(ctx, http.MethodGet, "/lists", nil, nil, &lists)
+	return lists, err
+}
+
+// CreateList creates a list owned by the caller.
+func (c *Client) CreateList(ctx context.Context, name string) (database.List, error) {
+	var list database.List
+	body := struct{ Name string }{name}
+	err := c.do(ctx, http.MethodPost, "/lists", nil, body, &list, http.StatusCreated)
+	return list, err
+}
+
+// DeleteList deletes a list with its todos. Deleting a list that is not
+// there is not an error.
+func (c *Client) DeleteList(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, pathf("/lists/%d", id), nil, nil, nil)
+}
+
+// ListListTodos lists the todos of a list in their manual order.
+func (c *Client) ListListTodos(ctx context.Context, id int64) ([]database.Todo, error) {
+	var todos []database.Todo
+	err := c.do(ctx, http.MethodGet, pathf("/lists/%d/todos", id), nil, nil, &todos)
+	return todos, err
+}
+
+// MarkListDone marks every todo of a list as done and returns how many were
+// not yet. force marks them even when some are blocked by open todos.
+func (c *Client) MarkListDone(ctx context.Context, id int64, force bool) (int64, error) {
+	var count struct{ Updated int64 }
+	err := c.do(ctx, http.MethodPost, pathf("/lists/%d/todos:markDone", id), forceQuery(force), nil, &count)
+	return count.Updated, err
+}
+
+// workflow state kinds.
+const (
+	StateInitial  = "initial"
+	StateActive   = "active"
+	StateTerminal = "terminal"
+)
+
+type Workflow struct {
+	States      []database.WorkflowState
+	Transitions []database.WorkflowTransition
+}
+
+// WorkflowState is a state of a workflow being replaced. States are matched
+// with the current ones by name.
+type WorkflowState struct {
+	Name     string
+	Kind     string
+	WipLimit *int64
+}
+
+// WorkflowTransition allows todos to move between the states named From and
+// To.
+type WorkflowTransition struct {
+	From string
+	To   string
+}
+
+func (c *Client) GetWorkflow(ctx context.Context, listID int64) (Workflow, error) {
+	var workflow Workflow
+	err := c.do(ctx, http.MethodGet, pathf("/lists/%d/workflow", listID), nil, nil, &workflow)
+	return workflow, err
+}
+
+// PutWorkflow replaces the workflow of a list.
+func (c *Client) PutWorkflow(ctx context.Context, listID int64, states []WorkflowState, transitions []WorkflowTransition) (Workflow, error) {
+	body := struct {
+		States      []WorkflowState
+		Transitions []WorkflowTransition
+	}{states, transitions}
+
+	var workflow Workflow
+	err := c.do(ctx, http.MethodPut, pathf("/lists/%d/workflow", listID), nil, body, &workflow)
+	return workflow, err
+}
+
+type BoardColumn struct {
+	State database.WorkflowState
+	Todos []database.Todo
+}
+
+// Board is a list with one column per state of its workflow.
+type Board struct {
+	List    database.List
+	Columns []BoardColumn
+}
+
+func (c *Client) GetBoard(ctx context.Context, listID int64) (Board, error) {
+	var board Board
+	err := c.do(ctx, http.MethodGet, pathf("/lists/%d/board", listID), nil, nil, &board)
+	return board, err
+}
+
+// Member is a user of a list together with their role in it.
+type Member struct {
+	UserID    int64
+	Name      string
+	Role      string
+	CreatedAt sql.NullTime
+}
+
+func (c *Client) ListMembers(ctx context.Context, listID int64) ([]Member, error) {
+	var members []Member
+	err := c.do(ctx, http.MethodGet, pathf("/lists/%d/members", listID), nil, nil, &members)
+	return members, err
+}
+
+// PutMember changes the role of a member of a list.
+func (c *Client) PutMember(ctx context.Context, listID, userID int64, role string) (Member, error) {
+	var member Member
+	body := struct{ Role string }{role}
+	err := c.do(ctx, http.MethodPut, pathf("/lists/%d/members/%d", listID, userID), nil, body, &member)
+	return member, err
+}
+
+func (c *Client) RemoveMember(ctx context.Context, listID, userID int64) error {
+	return c.do(ctx, http.MethodDelete, pathf("/lists/%d/members/%d", listID, userID), nil, nil, nil)
+}
+
+type Invitation struct {
+	ID        int64
+	ListID    int64
+	Role      string
+	ExpiresAt time.Time
+	CreatedAt sql.NullTime
+}
+
+// CreatedInvitation holds the token of a new invitation, which the server
+// does not keep and only answers with once.
+type CreatedInvitation struct {
+	Token      string
+	Invitation Invitation
+}
+
+// CreateInvitation invites anyone holding the returned token to a list with
+// role.
+func (c *Client) CreateInvitation(ctx context.Context, listID int64, role string) (CreatedInvitation, error) {
+	var created CreatedInvitation
+	body := struct{ Role string }{role}
+	err := c.do(ctx, http.MethodPost, pathf("/lists/%d/invitations", listID), nil, body, &created, http.StatusCreated)
+	return created, err
+}
+
+// AcceptInvitation makes the caller a member of the list the invitation is
+// for and returns it.
+func (c *Client) AcceptInvitation(ctx context.Context, token string) (List, error) {
+	var list List
+	body := struct{ Token string }{token}
+	err := c.do(ctx, http.MethodPost, "/invitations:accept", nil, body, &list)
+	return list, err
+}
+
+func (c *Client) DeclineInvitation(ctx context.Context, token string) error {
+	body := struct{ Token string }{token}
+	return c.do(ctx, http.MethodPost, "/invitations:decline", nil, body, nil)
+}
@@ -0,0 +1,357 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+// batch modes, atomic applies every operation or none of them while
+// best_effort applies every operation it can.
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// operations of batches and syncs.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Todo is a todo together with the caller's role in it, which is their role
+// in the todo's list or owner for their todos outside of lists.
+type Todo struct {
+	database.Todo
+	Role string
+}
+
+// TodoParams are what todos are created and replaced with.
+type TodoParams struct {
+	Description string
+	Done        bool
+	ListID      *int64
+}
+
+// TodoPatch holds the fields of a todo to change, the nil ones are left as
+// they are. A todo changed since Version, when set, is not patched and the
+// call fails with ErrConflict.
+type TodoPatch struct {
+	Description *string
+	Done        *bool
+	ListID      *int64
+	Version     *int64 `json:",omitempty"`
+}
+
+// Page is a slice of the todos of the caller, which are ordered by list,
+// position and id. A zero Limit lists all of them. The page starts after the
+// After todo when it is set, which unlike Offset does not skip or repeat todos
+// when todos before it are created or deleted in the meantime.
+type Page struct {
+	Limit  int
+	Offset int
+	After  *Todo
+}
+
+func (p Page) query() url.Values {
+	query := url.Values{}
+	if p.Limit > 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Offset > 0 {
+		query.Set("offset", strconv.Itoa(p.Offset))
+	}
+	if p.After != nil {
+		listID := ""
+		if p.After.ListID.Valid {
+			listID = strconv.FormatInt(p.After.ListID.Int64, 10)
+		}
+		query.Set("after", fmt.Sprintf("%s:%s:%d", listID, p.After.Position, p.After.ID))
+	}
+	return query
+}
+
+// ListTodos lists the todos in page, the todos of the caller first followed by
+// the todos of the lists shared with them.
+func (c *Client) ListTodos(ctx context.Context, page Page) ([]Todo, error) {
+	var todos []Todo
+	err := c.do(ctx, http.MethodGet, "/todos", page.query(), nil, &todos)
+	return todos, err
+}
+
+// TodoIterator goes through the todos of the caller a page at a time, like
+// sql.Rows:
+//
+//	it := c.Todos(ctx, 100)
+//	for it.Next() {
+//		todo := it.Todo()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type TodoIterator struct {
+	c        *Client
+	ctx      context.Context
+	pageSize int
+	after    *Todo
+
+	page []Todo
+	todo Todo
+	last bool
+	err  error
+}
+
+// Todos returns an iterator over the todos of the caller that fetches them
+// pageSize at a time.
+func (c *Client) Todos(ctx context.Context, pageSize int) *TodoIterator {
+	return &TodoIterator{c: c, ctx: ctx, pageSize: max(pageSize, 1)}
+}
+
+// Next moves to the next todo, fetching the next page when the current one
+// is over. It returns false once there are no more todos or a page could not
+// be fetched.
+func (it *TodoIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	if len(it.page) == 0 {
+		if it.last {
+			return false
+		}
+
+		it.page, it.err = it.c.ListTodos(it.ctx, Page{Limit: it.pageSize, After: it.after})
+		if it.err != nil {
+			return false
+		}
+
+		it.last = len(it.page) < it.pageSize
+		if len(it.page) == 0 {
+			return false
+		}
+		it.after = &it.page[len(it.page)-1]
+	}
+
+	it.todo, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Todo is the todo Next moved to.
+func (it *TodoIterator) Todo() Todo {
+	return it.todo
+}
+
+// Err is the error that stopped the iterator, if any.
+func (it *TodoIterator) Err() error {
+	return it.err
+}
+
+// GetTodo returns a todo the caller can see.
+func (c *Client) GetTodo(ctx context.Context, id int64) (Todo, error) {
+	var todo Todo
+	err := c.do(ctx, http.MethodGet, pathf("/todos/%d", id), nil, nil, &todo)
+	return todo, err
+}
+
+func (c *Client) CreateTodo(ctx context.Context, params TodoParams) (database.Todo, error) {
+	var todo database.Todo
+	err := c.do(ctx, http.MethodPost, "/todos", nil, params, &todo, http.StatusCreated)
+	return todo, err
+}
+
+// UpdateTodo replaces every field of a todo with params.
+func (c *Client) UpdateTodo(ctx context.Context, id int64, params TodoParams) (database.Todo, error) {
+	var todo database.Todo
+	err := c.do(ctx, http.MethodPut, pathf("/todos/%d", id), nil, params, &todo)
+	return todo, err
+}
+
+// PatchTodo changes the fields of a todo that are set in patch. force marks
+// the todo done even when some of its blockers are open.
+func (c *Client) PatchTodo(ctx context.Context, id int64, patch TodoPatch, force bool) (database.Todo, error) {
+	var todo database.Todo
+	err := c.do(ctx, http.MethodPatch, pathf("/todos/%d", id), forceQuery(force), patch, &todo)
+	return todo, err
+}
+
+// DeleteTodo deletes a todo. Deleting a todo that is not there is not an
+// error.
+func (c *Client) DeleteTodo(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, pathf("/todos/%d", id), nil, nil, nil)
+}
+
+// DeleteCompletedTodos deletes the done todos of the caller, and the ones of
+// lists they own or edit, and returns how many there were.
+func (c *Client) DeleteCompletedTodos(ctx context.Context) (int64, error) {
+	var count struct{ Deleted int64 }
+	err := c.do(ctx, http.MethodPost, "/todos:deleteCompleted", nil, nil, &count)
+	return count.Deleted, err
+}
+
+// Move places a todo right before or right after another todo of its list,
+// exactly one of before and after must be set.
+type Move struct {
+	Before *int64
+	After  *int64
+}
+
+func (c *Client) MoveTodo(ctx context.Context, id int64, move Move) (database.Todo, error) {
+	var todo database.Todo
+	err := c.do(ctx, http.MethodPost, pathf("/todos/%d/move", id), nil, move, &todo)
+	return todo, err
+}
+
+// TransitionTodo moves a todo to the workflow state statusID of its list.
+func (c *Client) TransitionTodo(ctx context.Context, id, statusID int64, force bool) (database.Todo, error) {
+	var todo database.Todo
+	body := struct{ StatusID int64 }{statusID}
+	err := c.do(ctx, http.MethodPost, pathf("/todos/%d/transition", id), forceQuery(force), body, &todo)
+	return todo, err
+}
+
+// ListTodoBlockers lists the todos that have to be done before todo id.
+func (c *Client) ListTodoBlockers(ctx context.Context, id int64) ([]database.Todo, error) {
+	var todos []database.Todo
+	err := c.do(ctx, http.MethodGet, pathf("/todos/%d/blockers", id), nil, nil, &todos)
+	return todos, err
+}
+
+// ListTodoBlocking lists the todos waiting for todo id to be done.
+func (c *Client) ListTodoBlocking(ctx context.Context, id int64) ([]database.Todo, error) {
+	var todos []database.Todo
+	err := c.do(ctx, http.MethodGet, pathf("/todos/%d/blocking", id), nil, nil, &todos)
+	return todos, err
+}
+
+// AddTodoBlocker makes todo id wait for blockerID and returns every blocker
+// of todo id.
+func (c *Client) AddTodoBlocker(ctx context.Context, id, blockerID int64) ([]database.Todo, error) {
+	var todos []database.Todo
+	body := struct{ BlockerID int64 }{blockerID}
+	err := c.do(ctx, http.MethodPost, pathf("/todos/%d/blockers", id), nil, body, &todos, http.StatusCreated)
+	return todos, err
+}
+
+func (c *Client) RemoveTodoBlocker(ctx context.Context, id, blockerID int64) error {
+	return c.do(ctx, http.MethodDelete, pathf("/todos/%d/blockers/%d", id, blockerID), nil, nil, nil)
+}
+
+// ReadyTodo is an open todo in the order it can be worked on. Depth is the
+// length of the longest chain of open blockers in front of it.
+type ReadyTodo struct {
+	Todo         database.Todo
+	Depth        int
+	OpenBlockers []int64
+}
+
+// ListReadyTodos lists the open todos of the caller with every todo after
+// its open blockers.
+func (c *Client) ListReadyTodos(ctx context.Context) ([]ReadyTodo, error) {
+	var todos []ReadyTodo
+	err := c.do(ctx, http.MethodGet, "/todos:ready", nil, nil, &todos)
+	return todos, err
+}
+
+// BatchOperation creates, updates or deletes a todo. Updates only change
+// the fields that are set.
+type BatchOperation struct {
+	Op          string
+	ID          int64
+	Description *string
+	Done        *bool
+	ListID      *int64
+	Version     *int64 `json:",omitempty"`
+	Force       bool
+}
+
+// BatchResult is the outcome of the operation at Index.
+type BatchResult struct {
+	Index  int
+	Op     string
+	ID     int64
+	Status int
+	Todo   *database.Todo
+	Error  string
+}
+
+// Batch runs operations in a single transaction with mode, BatchAtomic when
+// empty. When some operation fails the results are returned together with an
+// *Error with status 422, after which an atomic batch applied nothing.
+func (c *Client) Batch(ctx context.Context, mode string, operations []BatchOperation) ([]BatchResult, error) {
+	body := struct {
+		Mode       string `json:",omitempty"`
+		Operations []BatchOperation
+	}{mode, operations}
+
+	var results struct{ Results []BatchResult }
+	err := c.do(ctx, http.MethodPost, "/todos:batch", nil, body, &results, http.StatusOK, http.StatusUnprocessableEntity)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results.Results {
+		if result.Status >= http.StatusBadRequest && result.Status != http.StatusFailedDependency {
+			return results.Results, &Error{
+				StatusCode: http.StatusUnprocessableEntity,
+				Message:    fmt.Sprintf("operation %d failed with status %d: %s", result.Index, result.Status, result.Error),
+			}
+		}
+	}
+
+	return results.Results, nil
+}
+
+// SyncChange is a change made offline to a todo, based on the version of it
+// the client last saw.
+type SyncChange struct {
+	Op          string
+	ClientID    string
+	ID          int64
+	BaseVersion int64
+	Description string
+	Done        bool
+	ListID      *int64
+}
+
+type SyncResult struct {
+	Op       string
+	ClientID string
+	ID       int64
+	// Status is applied, conflict, deleted or rejected.
+	Status string
+	Todo   *database.Todo
+}
+
+type SyncResponse struct {
+	// Seq is what to send as since on the next sync.
+	Seq     int64
+	Results []SyncResult
+	// Todos holds every todo changed after since.
+	Todos []database.Todo
+	// Deleted holds the ids of every todo deleted after since.
+	Deleted []int64
+}
+
+// Sync applies changes and returns every change the server saw after since.
+func (c *Client) Sync(ctx context.Context, since int64, changes []SyncChange) (SyncResponse, error) {
+	body := struct {
+		Since   int64
+		Changes []SyncChange
+	}{since, changes}
+
+	var response SyncResponse
+	err := c.do(ctx, http.MethodPost, "/sync", nil, body, &response)
+	return response, err
+}
+
+func forceQuery(force bool) url.Values {
+	if !force {
+		return nil
+	}
+	return url.Values{"force": {"true"}}
+}
@@ -0,0 +1,488 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/cors"
+	"github.com/juancortelezzi/gogsd/pkg/listener"
+	"github.com/juancortelezzi/gogsd/pkg/ratelimit"
+	"github.com/juancortelezzi/gogsd/pkg/telemetry"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+// Config is everything gogsd can be configured with. Every setting has a
+// key in config files, a flag named after its dotted key path and, except
+// for the few only systemd sets, an environment variable. Settings tagged
+// secret are redacted when printed, and settings tagged reload are applied
+// to a running server by Reload.
+type Config struct {
+	Listen    Listen    `toml:"listen" yaml:"listen"`
+	Database  Database  `toml:"database" yaml:"database"`
+	Log       Log       `toml:"log" yaml:"log"`
+	Timeouts  Timeouts  `toml:"timeouts" yaml:"timeouts"`
+	Limits    Limits    `toml:"limits" yaml:"limits"`
+	Auth      Auth      `toml:"auth" yaml:"auth"`
+	RateLimit RateLimit `toml:"rate_limit" yaml:"rate_limit"`
+	CORS      CORS      `toml:"cors" yaml:"cors"`
+	Telemetry Telemetry `toml:"telemetry" yaml:"telemetry"`
+	Metrics   Metrics   `toml:"metrics" yaml:"metrics"`
+	Health    Health    `toml:"health" yaml:"health"`
+	Workspace Workspace `toml:"workspace" yaml:"workspace"`
+	Features  Features  `toml:"features" yaml:"features"`
+}
+
+type Listen struct {
+	Host string `toml:"host" yaml:"host" env:"HOST"`
+	Port int    `toml:"port" yaml:"port" env:"PORT"`
+	// SocketPath makes the server listen on a unix domain socket instead of
+	// Host and Port.
+	SocketPath string `toml:"socket_path" yaml:"socket_path" env:"SOCKET_PATH"`
+	// SocketMode is the octal permissions of the socket.
+	SocketMode string `toml:"socket_mode" yaml:"socket_mode" env:"SOCKET_MODE"`
+	H2C        bool   `toml:"h2c" yaml:"h2c" env:"H2C"`
+	TLS        TLS    `toml:"tls" yaml:"tls"`
+
+	// systemd sets these when it passes the server a socket.
+	SystemdPID string `toml:"-" yaml:"-" env:"LISTEN_PID"`
+	SystemdFDs string `toml:"-" yaml:"-" env:"LISTEN_FDS"`
+}
+
+type TLS struct {
+	CertFile     string `toml:"cert_file" yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile      string `toml:"key_file" yaml:"key_file" env:"TLS_KEY_FILE"`
+	ClientCAFile string `toml:"client_ca_file" yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	// ClientAuth is require or optional.
+	ClientAuth string `toml:"client_auth" yaml:"client_auth" env:"TLS_CLIENT_AUTH"`
+}
+
+type Database struct {
+	URL string `toml:"url" yaml:"url" env:"DATABASE_URL"`
+}
+
+type Log struct {
+	// Level is debug, info, warn or error.
+	Level string `toml:"level" yaml:"level" env:"LOG_LEVEL" reload:"true"`
+}
+
+// Timeouts of zero are no timeouts at all.
+type Timeouts struct {
+	// ReadHeader is how long clients get to send the headers of a request.
+	ReadHeader time.Duration `toml:"read_header" yaml:"read_header" env:"READ_HEADER_TIMEOUT"`
+	// Read is how long clients get to send a whole request.
+	Read time.Duration `toml:"read" yaml:"read" env:"READ_TIMEOUT"`
+	// Write is how long a request gets from its headers being read to its
+	// response being written.
+	Write time.Duration `toml:"write" yaml:"write" env:"WRITE_TIMEOUT"`
+	// Idle is how long connections are kept open between requests.
+	Idle time.Duration `toml:"idle" yaml:"idle" env:"IDLE_TIMEOUT"`
+	// Shutdown is how long requests in flight get to finish on shutdown.
+	Shutdown time.Duration `toml:"shutdown" yaml:"shutdown" env:"SHUTDOWN_TIMEOUT"`
+	// Drain is how long readiness probes fail before the listeners close.
+	Drain time.Duration `toml:"drain" yaml:"drain" env:"SHUTDOWN_DRAIN_DELAY"`
+}
+
+type Limits struct {
+	// MaxHeaderBytes is how large the headers of a request may be.
+	MaxHeaderBytes int `toml:"max_header_bytes" yaml:"max_header_bytes" env:"MAX_HEADER_BYTES"`
+	// MaxBodyBytes is how large the body of a request may be, larger ones
+	// are answered with 413.
+	MaxBodyBytes int64 `toml:"max_body_bytes" yaml:"max_body_bytes" env:"MAX_BODY_BYTES"`
+}
+
+type Auth struct {
+	// BootstrapAPIKey is stored as an admin key of the local user, which is
+	// how the first keys of a fresh database get created. Unsetting it does
+	// not revoke the stored key, deleting it through the API does.
+	BootstrapAPIKey string `toml:"bootstrap_api_key" yaml:"bootstrap_api_key" env:"BOOTSTRAP_API_KEY" secret:"true"`
+	OIDC            OIDC   `toml:"oidc" yaml:"oidc"`
+	JWT             JWT    `toml:"jwt" yaml:"jwt"`
+}
+
+// OIDC login is offered once an issuer is set.
+type OIDC struct {
+	Issuer       string `toml:"issuer" yaml:"issuer" env:"OIDC_ISSUER"`
+	ClientID     string `toml:"client_id" yaml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string `toml:"client_secret" yaml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	RedirectURL  string `toml:"redirect_url" yaml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	PostLoginURL string `toml:"post_login_url" yaml:"post_login_url" env:"OIDC_POST_LOGIN_URL"`
+}
+
+// JWT bearer tokens are accepted once an issuer is set.
+type JWT struct {
+	Issuer    string        `toml:"issuer" yaml:"issuer" env:"JWT_ISSUER"`
+	Audience  string        `toml:"audience" yaml:"audience" env:"JWT_AUDIENCE"`
+	JWKSURL   string        `toml:"jwks_url" yaml:"jwks_url" env:"JWT_JWKS_URL"`
+	JWKSFile  string        `toml:"jwks_file" yaml:"jwks_file" env:"JWT_JWKS_FILE"`
+	ClockSkew time.Duration `toml:"clock_skew" yaml:"clock_skew" env:"JWT_CLOCK_SKEW"`
+	// Workspace is the slug of the workspace the users of tokens live in.
+	// Tokens sent to another workspace are refused.
+	Workspace string `toml:"workspace" yaml:"workspace" env:"JWT_WORKSPACE"`
+}
+
+// RateLimit limits are written as <burst>/<period>, such as 60/1m, or off.
+type RateLimit struct {
+	Auth  string `toml:"auth" yaml:"auth" env:"RATE_LIMIT_AUTH" reload:"true"`
+	Read  string `toml:"read" yaml:"read" env:"RATE_LIMIT_READ" reload:"true"`
+	Write string `toml:"write" yaml:"write" env:"RATE_LIMIT_WRITE" reload:"true"`
+	// Client limits the requests of a client address to authenticated
+	// routes before their credentials are checked, so guessing them is
+	// limited too.
+	Client string `toml:"client" yaml:"client" env:"RATE_LIMIT_CLIENT" reload:"true"`
+	// TrustedProxies are the addresses or CIDR prefixes trusted to tell the
+	// client address in X-Forwarded-For.
+	TrustedProxies []string `toml:"trusted_proxies" yaml:"trusted_proxies" env:"TRUSTED_PROXIES" reload:"true"`
+}
+
+type CORS struct {
+	// AllowedOrigins are the origins browsers may call the API from, such
+	// as https://app.example, or * for any of them without cookies.
+	AllowedOrigins []string `toml:"allowed_origins" yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" reload:"true"`
+}
+
+// Telemetry exports traces over OTLP/HTTP once an endpoint is set.
+type Telemetry struct {
+	// TracesEndpoint is the full URL traces are sent to, Endpoint the base
+	// URL /v1/traces is added to.
+	TracesEndpoint string `toml:"traces_endpoint" yaml:"traces_endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"`
+	Endpoint       string `toml:"endpoint" yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	// Headers are added to exports, written as key1=value1,key2=value2.
+	Headers     string  `toml:"headers" yaml:"headers" env:"OTEL_EXPORTER_OTLP_HEADERS" secret:"true"`
+	ServiceName string  `toml:"service_name" yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `toml:"sample_ratio" yaml:"sample_ratio" env:"OTEL_TRACES_SAMPLER_ARG"`
+}
+
+type Metrics struct {
+	// Listen serves /metrics on a listener of its own at this address.
+	// Metrics are not served at all without one.
+	Listen string `toml:"listen" yaml:"listen" env:"METRICS_ADDR"`
+}
+
+type Health struct {
+	// MinFreeDiskMB is how much space readiness wants left next to the
+	// database file.
+	MinFreeDiskMB uint64 `toml:"min_free_disk_mb" yaml:"min_free_disk_mb" env:"MIN_FREE_DISK_MB"`
+}
+
+type Workspace struct {
+	// Domain lets requests to acme.<domain> name the acme workspace.
+	Domain string `toml:"domain" yaml:"domain" env:"WORKSPACE_DOMAIN"`
+}
+
+type Features struct {
+	// Registration lets anyone register an account.
+	Registration bool `toml:"registration" yaml:"registration" env:"FEATURE_REGISTRATION" reload:"true"`
+}
+
+// Default returns the configuration used for every setting no source sets.
+func Default() Config {
+	return Config{
+		Listen: Listen{
+			Host:       "127.0.0.1",
+			SocketMode: "0660",
+		},
+		Log: Log{Level: "info"},
+		// the read and write timeouts leave slow clients and large syncs
+		// room, the header one stops clients that trickle headers in.
+		Timeouts: Timeouts{
+			ReadHeader: 5 * time.Second,
+			Read:       30 * time.Second,
+			Write:      time.Minute,
+			Idle:       2 * time.Minute,
+			Shutdown:   10 * time.Second,
+		},
+		Limits: Limits{
+			MaxHeaderBytes: 64 << 10,
+			MaxBodyBytes:   1 << 20,
+		},
+		Auth: Auth{
+			OIDC: OIDC{PostLoginURL: "/"},
+			JWT:  JWT{ClockSkew: time.Minute, Workspace: workspace.DefaultSlug},
+		},
+		// generous enough for people and scripts behaving, and stop the ones
+		// that hammer the server.
+		RateLimit: RateLimit{
+			Auth:  "20/1m",
+			Read:  "600/1m",
+			Write: "120/1m",
+			// many people may share an address, so it is well above what
+			// one of them makes.
+			Client: "1200/1m",
+		},
+		Telemetry: Telemetry{
+			ServiceName: telemetry.ServiceName,
+			SampleRatio: 1,
+		},
+		Health:   Health{MinFreeDiskMB: 64},
+		Features: Features{Registration: true},
+	}
+}
+
+// Validate returns every problem with c at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	_, err := c.ListenConfig()
+	check(err)
+	_, err = c.LogLevel()
+	check(err)
+	_, _, err = c.OIDCConfig()
+	check(err)
+	_, _, err = c.JWTConfig()
+	check(err)
+	_, err = c.RateLimitConfig()
+	check(err)
+	_, err = c.TelemetryConfig()
+	check(err)
+
+	if c.Database.URL == "" {
+		check(errors.New("database.url must be set"))
+	}
+
+	if c.Timeouts.Shutdown <= 0 {
+		check(errors.New("timeouts.shutdown must be positive"))
+	}
+
+	timeouts := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"timeouts.read_header", c.Timeouts.ReadHeader},
+		{"timeouts.read", c.Timeouts.Read},
+		{"timeouts.write", c.Timeouts.Write},
+		{"timeouts.idle", c.Timeouts.Idle},
+		{"timeouts.drain", c.Timeouts.Drain},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			check(fmt.Errorf("%s must not be negative", timeout.key))
+		}
+	}
+
+	if c.Limits.MaxHeaderBytes <= 0 {
+		check(errors.New("limits.max_header_bytes must be positive"))
+	}
+
+	if c.Limits.MaxBodyBytes <= 0 {
+		check(errors.New("limits.max_body_bytes must be positive"))
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if err := cors.ValidateOrigin(origin); err != nil {
+			check(fmt.Errorf("cors.allowed_origins: %w", err))
+		}
+	}
+
+	if c.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Listen); err != nil {
+			check(fmt.Errorf("metrics.listen: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ListenConfig is where and how the server listens. A socket passed by
+// systemd wins over a unix socket, which wins over host and port.
+func (c Config) ListenConfig() (listener.Config, error) {
+	var config listener.Config
+	var errs []error
+
+	l := c.Listen
+	switch {
+	case l.SystemdPID != "" && l.SystemdPID == strconv.Itoa(os.Getpid()):
+		if count, err := strconv.Atoi(l.SystemdFDs); err != nil || count < 1 {
+			errs = append(errs, fmt.Errorf("LISTEN_FDS is not a count of sockets: %q", l.SystemdFDs))
+		}
+		config.Systemd = true
+
+	case l.SocketPath != "":
+		config.SocketPath = l.SocketPath
+		mode, err := strconv.ParseUint(l.SocketMode, 8, 32)
+		if err != nil || mode > 0o777 {
+			errs = append(errs, fmt.Errorf("listen.socket_mode is not octal permissions: %q", l.SocketMode))
+		}
+		config.SocketMode = fs.FileMode(mode)
+
+	case l.Port < 1 || l.Port > 65535:
+		errs = append(errs, fmt.Errorf("listen.port must be set to a port between 1 and 65535 unless listen.socket_path is"))
+
+	default:
+		config.Address = net.JoinHostPort(l.Host, strconv.Itoa(l.Port))
+	}
+
+	config.H2C = l.H2C
+
+	t := l.TLS
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			errs = append(errs, errors.New("listen.tls.cert_file and listen.tls.key_file must be set together"))
+		}
+
+		config.TLS = &listener.TLSConfig{CertFile: t.CertFile, KeyFile: t.KeyFile, ClientCAFile: t.ClientCAFile}
+		if t.ClientCAFile != "" {
+			config.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	if t.ClientAuth != "" {
+		switch {
+		case t.ClientCAFile == "" || config.TLS == nil:
+			errs = append(errs, errors.New("listen.tls.client_auth needs listen.tls.client_ca_file and a certificate"))
+		case t.ClientAuth == "require":
+			config.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+		case t.ClientAuth == "optional":
+			config.TLS.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			errs = append(errs, fmt.Errorf("listen.tls.client_auth must be require or optional, not %q", t.ClientAuth))
+		}
+	} else if t.ClientCAFile != "" && config.TLS == nil {
+		errs = append(errs, errors.New("listen.tls.client_ca_file needs a certificate"))
+	}
+
+	return config, errors.Join(errs...)
+}
+
+func (c Config) LogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		return 0, fmt.Errorf("log.level must be debug, info, warn or error, not %q", c.Log.Level)
+	}
+	return level, nil
+}
+
+// OIDCConfig is how gogsd is registered with an OpenID Connect provider.
+// found is false when no issuer is set.
+func (c Config) OIDCConfig() (config auth.OIDCConfig, found bool, err error) {
+	o := c.Auth.OIDC
+	if o.Issuer == "" {
+		return auth.OIDCConfig{}, false, nil
+	}
+
+	var missing []string
+	if o.ClientID == "" {
+		missing = append(missing, "auth.oidc.client_id")
+	}
+	if o.RedirectURL == "" {
+		missing = append(missing, "auth.oidc.redirect_url")
+	}
+	if len(missing) > 0 {
+		return auth.OIDCConfig{}, false, fmt.Errorf("auth.oidc.issuer is set but %s not", strings.Join(missing, " and "))
+	}
+
+	return auth.OIDCConfig{
+		Issuer:       o.Issuer,
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		RedirectURL:  o.RedirectURL,
+		PostLoginURL: o.PostLoginURL,
+	}, true, nil
+}
+
+// JWTConfig is which bearer tokens are accepted. found is false when no
+// issuer is set.
+func (c Config) JWTConfig() (config auth.JWTConfig, found bool, err error) {
+	j := c.Auth.JWT
+	if j.Issuer == "" {
+		return auth.JWTConfig{}, false, nil
+	}
+
+	var errs []error
+	if j.Audience == "" {
+		errs = append(errs, errors.New("auth.jwt.issuer is set but auth.jwt.audience not"))
+	}
+	if (j.JWKSURL == "") == (j.JWKSFile == "") {
+		errs = append(errs, errors.New("auth.jwt.issuer needs exactly one of auth.jwt.jwks_url and auth.jwt.jwks_file"))
+	}
+	if j.ClockSkew < 0 {
+		errs = append(errs, errors.New("auth.jwt.clock_skew must not be negative"))
+	}
+	if j.Workspace == "" {
+		errs = append(errs, errors.New("auth.jwt.issuer is set but auth.jwt.workspace not"))
+	}
+	if len(errs) > 0 {
+		return auth.JWTConfig{}, false, errors.Join(errs...)
+	}
+
+	return auth.JWTConfig{
+		Issuer:    j.Issuer,
+		Audience:  j.Audience,
+		JWKSURL:   j.JWKSURL,
+		JWKSFile:  j.JWKSFile,
+		ClockSkew: j.ClockSkew,
+		Workspace: j.Workspace,
+	}, true, nil
+}
+
+func (c Config) RateLimitConfig() (ratelimit.Config, error) {
+	config := ratelimit.Config{Limits: make(map[string]ratelimit.Limit)}
+	var errs []error
+
+	limits := map[string]string{
+		ratelimit.GroupAuth:   c.RateLimit.Auth,
+		ratelimit.GroupRead:   c.RateLimit.Read,
+		ratelimit.GroupWrite:  c.RateLimit.Write,
+		ratelimit.GroupClient: c.RateLimit.Client,
+	}
+	for group, value := range limits {
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rate_limit.%s: %w", group, err))
+		}
+		config.Limits[group] = limit
+	}
+
+	if len(c.RateLimit.TrustedProxies) > 0 {
+		var err error
+		config.TrustedProxies, err = ratelimit.ParseTrustedProxies(strings.Join(c.RateLimit.TrustedProxies, ","))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rate_limit.trusted_proxies: %w", err))
+		}
+	}
+
+	return config, errors.Join(errs...)
+}
+
+// TelemetryConfig is where traces are exported to. Its endpoint is empty
+// when none is set, which leaves exporting off.
+func (c Config) TelemetryConfig() (telemetry.Config, error) {
+	t := c.Telemetry
+	config := telemetry.Config{
+		Endpoint:    t.TracesEndpoint,
+		ServiceName: t.ServiceName,
+		SampleRatio: t.SampleRatio,
+	}
+
+	if config.Endpoint == "" && t.Endpoint != "" {
+		config.Endpoint = strings.TrimSuffix(t.Endpoint, "/") + "/v1/traces"
+	}
+
+	var errs []error
+	if t.Headers != "" {
+		var err error
+		config.Headers, err = telemetry.ParseHeaders(t.Headers)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("telemetry.headers: %w", err))
+		}
+	}
+
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("telemetry.sample_ratio must be between 0 and 1, not %v", t.SampleRatio))
+	}
+
+	return config, errors.Join(errs...)
+}
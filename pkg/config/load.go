@@ -0,0 +1,261 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Load layers, from lowest to highest priority, the defaults, the config
+// file named by the -config flag or CONFIG_FILE, the environment and the
+// flags in args. Every problem found along the way, and with the resulting
+// configuration, is returned at once.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	config := Default()
+	settings := settingsOf(&config)
+
+	flags := flag.NewFlagSet("gogsd", flag.ContinueOnError)
+	configFile := flags.String("config", "", "config file, TOML or YAML by extension (CONFIG_FILE)")
+	values := make(map[string]*flagValue, len(settings))
+	for _, s := range settings {
+		if s.key == "" {
+			continue
+		}
+		value := &flagValue{isBool: s.value.Kind() == reflect.Bool}
+		values[s.key] = value
+		flags.Var(value, s.key, s.usage())
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	var errs []error
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := DecodeFile(path, &config); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		if raw, found := lookupEnv(s.env); found {
+			if err := set(s.value, raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := values[s.key]; ok && value.set {
+			if err := set(s.value, value.raw); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.key, err))
+			}
+		}
+	}
+
+	// problems with the sources make the configuration meaningless to
+	// validate, the values they should have set are missing.
+	if len(errs) == 0 {
+		if err := config.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return config, errors.Join(errs...)
+}
+
+// DecodeFile decodes the TOML or YAML file at path, told apart by its
+// extension, into v. Settings v has no field for are errors.
+func DecodeFile(path string, v any) error {
+	switch filepath.Ext(path) {
+	case ".toml":
+		metadata, err := toml.DecodeFile(path, v)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, key := range metadata.Undecoded() {
+			errs = append(errs, fmt.Errorf("unknown setting %s", key))
+		}
+		return errors.Join(errs...)
+
+	case ".yaml", ".yml":
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(v); err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+
+	default:
+		return errors.New("config files must end in .toml, .yaml or .yml")
+	}
+}
+
+// setting is a leaf of Config.
+type setting struct {
+	// key is the dotted path of the setting in config files, which is also
+	// its flag. Settings only systemd sets have none.
+	key    string
+	env    string
+	secret bool
+	reload bool
+	value  reflect.Value
+}
+
+func (s setting) usage() string {
+	if s.env == "" {
+		return ""
+	}
+	return "(" + s.env + ")"
+}
+
+// settingsOf returns the leaves of config, which must be a pointer to a
+// struct, in the order they are declared.
+func settingsOf(config any) []setting {
+	var settings []setting
+
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+
+			key := field.Tag.Get("toml")
+			if key == "-" {
+				key = ""
+			} else if prefix != "" {
+				key = prefix + "." + key
+			}
+
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), key)
+				continue
+			}
+
+			settings = append(settings, setting{
+				key:    key,
+				env:    field.Tag.Get("env"),
+				secret: field.Tag.Get("secret") == "true",
+				reload: field.Tag.Get("reload") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(config).Elem(), "")
+
+	return settings
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses raw into v the way environment variables and flags are
+// written. Lists are comma separated.
+func set(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", raw)
+		}
+		v.SetInt(int64(duration))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetInt(n)
+
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a positive number", raw)
+		}
+		v.SetUint(n)
+
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetFloat(f)
+
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+
+	default:
+		panic("config: settings of kind " + v.Kind().String() + " can not be set")
+	}
+
+	return nil
+}
+
+// flagValue keeps what a flag was set to until the file and environment
+// were applied, so flags win over both.
+type flagValue struct {
+	raw    string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.raw
+}
+
+func (f *flagValue) Set(raw string) error {
+	f.raw, f.set = raw, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"io"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Redacted is what secrets that are set are printed as.
+const Redacted = "REDACTED"
+
+// Redact returns a copy of c whose secrets are replaced by Redacted.
+func (c Config) Redact() Config {
+	for _, s := range settingsOf(&c) {
+		if s.secret && !s.value.IsZero() {
+			s.value.SetString(Redacted)
+		}
+	}
+	return c
+}
+
+// Print writes c as a TOML config file with its secrets redacted.
+func (c Config) Print(w io.Writer) error {
+	return toml.NewEncoder(w).Encode(c.Redact())
+}
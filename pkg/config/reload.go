@@ -0,0 +1,30 @@
+package config
+
+import "reflect"
+
+// Reload returns c with the settings tagged reload taken from next, which a
+// running server applies without restarting. reloaded lists the keys of
+// those that changed and restart the keys of the other settings that
+// changed, which keep their value in applied until the server restarts.
+func (c Config) Reload(next Config) (applied Config, reloaded, restart []string) {
+	applied = c
+	current, nexts := settingsOf(&applied), settingsOf(&next)
+
+	for i, s := range current {
+		// settings without a key come from systemd, which does not change
+		// them under a running process.
+		if s.key == "" || reflect.DeepEqual(s.value.Interface(), nexts[i].value.Interface()) {
+			continue
+		}
+
+		if !s.reload {
+			restart = append(restart, s.key)
+			continue
+		}
+
+		s.value.Set(nexts[i].value)
+		reloaded = append(reloaded, s.key)
+	}
+
+	return applied, reloaded, restart
+}
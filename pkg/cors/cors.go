@@ -0,0 +1,131 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/requestid"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+// Any is the origin allowing every origin. Browsers do not send cookies to
+// origins allowed this way.
+const Any = "*"
+
+// maxAge is how many seconds browsers may cache the answer to a preflight.
+const maxAge = "600"
+
+var (
+	allowedMethods = strings.Join([]string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+	}, ", ")
+	allowedHeaders = strings.Join([]string{
+		"Authorization", "Content-Type", "X-API-Key", auth.CSRFHeader, workspace.Header,
+		requestid.Header, requestid.TraceparentHeader, requestid.TracestateHeader,
+	}, ", ")
+	exposedHeaders = strings.Join([]string{
+		"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+		"Retry-After", requestid.Header,
+	}, ", ")
+)
+
+// ValidateOrigin reports whether origin is Any or a scheme and host, the way
+// browsers send it in the Origin header.
+func ValidateOrigin(origin string) error {
+	if origin == Any {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("origin %q is not of the form <scheme>://<host>", origin)
+	}
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("origin %q must only have a scheme and a host", origin)
+	}
+	return nil
+}
+
+// Policy allows browsers on other origins to call the API. Its origins can
+// be swapped while it serves requests; with none, no cross origin request
+// is allowed.
+type Policy struct {
+	origins atomic.Pointer[[]string]
+}
+
+// New returns a policy allowing origins, which must pass ValidateOrigin.
+func New(origins []string) *Policy {
+	p := &Policy{}
+	p.SetOrigins(origins)
+	return p
+}
+
+// SetOrigins makes requests from now on be allowed from origins.
+func (p *Policy) SetOrigins(origins []string) {
+	origins = slices.Clone(origins)
+	p.origins.Store(&origins)
+}
+
+// allowed returns what Access-Control-Allow-Origin is for origin, empty when
+// it is not allowed, and whether credentials are allowed with it.
+func (p *Policy) allowed(origin string) (allowOrigin string, credentials bool) {
+	origins := *p.origins.Load()
+	switch {
+	case slices.Contains(origins, origin):
+		return origin, true
+	case slices.Contains(origins, Any):
+		return Any, false
+	default:
+		return "", false
+	}
+}
+
+// Middleware answers preflight requests and tags the responses to requests
+// from allowed origins. It belongs outside of everything that could turn a
+// preflight away, such as authentication.
+func (p *Policy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		allowOrigin, credentials := p.allowed(origin)
+		if allowOrigin == "" {
+			if preflight {
+				// browsers fail the request they were about to make.
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
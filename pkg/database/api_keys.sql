@@ -0,0 +1,32 @@
+-- name: GetAPIKeyByPrefix :one
+SELECT * FROM api_keys
+WHERE prefix = ? LIMIT 1;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+WHERE user_id = ?
+ORDER BY id;
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+  workspace_id,
+  user_id,
+  name,
+  prefix,
+  salt,
+  hash,
+  scopes,
+  expires_at
+)
+SELECT users.workspace_id, users.id, sqlc.arg(name), sqlc.arg(prefix), sqlc.arg(salt), sqlc.arg(hash), sqlc.arg(scopes), sqlc.arg(expires_at) FROM users
+WHERE users.id = sqlc.arg(user_id)
+RETURNING *;
+
+-- name: DeleteAPIKey :execrows
+DELETE FROM api_keys
+WHERE id = ? AND user_id = ?;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+set last_used_at = CURRENT_TIMESTAMP
+WHERE id = ?;
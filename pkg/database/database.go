@@ -3,25 +3,279 @@ package database
 import (
 	"context"
 	"database/sql"
-	_ "embed"
+	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
 )
 
-//go:embed schema.sql
-var schemaString string
+// migrations are applied in file name order and each of them only once. The
+// number before the first underscore is the version recorded in
+// schema_migrations, so released files must never be renamed or edited.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
 
 func Connect(ctx context.Context, logger gsdlogger.Logger, dsl string) (*Queries, error) {
-	db, err := sql.Open("sqlite3", ":memory:")
+	db, err := Open(ctx, logger, dsl)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(db), nil
+}
+
+// Open opens the database at dsl and brings its schema up to date. Callers
+// wanting more than Connect, such as wrapping the database in NewTracedDB,
+// hand it to New themselves.
+func Open(ctx context.Context, logger gsdlogger.Logger, dsl string) (*sql.DB, error) {
+	db, err := OpenWithoutMigrating(dsl)
 	if err != nil {
 		return nil, err
 	}
 
-	if result, err := db.ExecContext(ctx, schemaString); err != nil {
-		formattedError := fmt.Errorf("error running migration: result=%v err=%w", result, err)
-		return nil, formattedError
+	if err := migrate(ctx, logger, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error running migration: %w", err)
 	}
 
-	return New(db), nil
+	return db, nil
+}
+
+// OpenWithoutMigrating opens the database at dsl like Open but leaves its
+// schema alone, for callers that must not change a database a server of
+// another version may be using. They check PendingMigrations instead.
+func OpenWithoutMigrating(dsl string) (*sql.DB, error) {
+	params := []string{"_foreign_keys=on"}
+
+	_, file := FilePath(dsl)
+	if file {
+		// readers never block the writer in WAL mode, and writers wait for
+		// each other instead of failing with SQLITE_BUSY. Transactions take
+		// the write lock when they begin, as one upgrading to it halfway
+		// fails right away when another writer got there first.
+		params = append(params, "_journal_mode=WAL", "_busy_timeout=5000", "_txlock=immediate")
+	}
+
+	separator := "?"
+	if strings.Contains(dsl, "?") {
+		separator = "&"
+	}
+
+	db, err := sql.Open("sqlite3", dsl+separator+strings.Join(params, "&"))
+	if err != nil {
+		return nil, err
+	}
+
+	// every new connection to an in-memory database gets its own empty
+	// database, so the pool must never grow past the one holding the schema.
+	if !file {
+		db.SetMaxOpenConns(1)
+	}
+
+	return db, nil
+}
+
+func migrate(ctx context.Context, logger gsdlogger.Logger, db *sql.DB) error {
+	// foreign keys can only be switched off outside of a transaction and only
+	// for one connection, so every migration runs on the same one.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, createMigrationsTable); err != nil {
+		return err
+	}
+
+	files, err := migrationFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		var applied bool
+		row := conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)", file.version)
+		if err := row.Scan(&applied); err != nil {
+			return err
+		}
+
+		if applied {
+			continue
+		}
+
+		content, err := migrations.ReadFile(file.path)
+		if err != nil {
+			return err
+		}
+
+		if err := applyMigration(ctx, conn, file.version, path.Base(file.path), string(content)); err != nil {
+			return fmt.Errorf("migration %s: %w", file.path, err)
+		}
+
+		logger.InfoContext(ctx, "applied migration", "name", path.Base(file.path))
+	}
+
+	return nil
+}
+
+type migrationFile struct {
+	version int
+	path    string
+}
+
+func migrationFiles() ([]migrationFile, error) {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]migrationFile, 0, len(names))
+	for _, name := range names {
+		version, err := strconv.Atoi(strings.SplitN(path.Base(name), "_", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version: %w", name, err)
+		}
+		files = append(files, migrationFile{version: version, path: name})
+	}
+
+	return files, nil
+}
+
+// PendingMigrations returns the names of the migrations db is missing, which
+// is none once Open brought it up to date.
+func PendingMigrations(ctx context.Context, db DBTX) ([]string, error) {
+	files, err := migrationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, file := range files {
+		if !applied[file.version] {
+			pending = append(pending, path.Base(file.path))
+		}
+	}
+
+	return pending, nil
+}
+
+// FilePath returns the file holding the database at dsl, which in-memory
+// databases do not have.
+func FilePath(dsl string) (string, bool) {
+	name, query, _ := strings.Cut(strings.TrimPrefix(dsl, "file:"), "?")
+	if name == "" || name == ":memory:" || strings.Contains(query, "mode=memory") {
+		return "", false
+	}
+	return name, true
+}
+
+// applyMigration runs a migration with foreign keys switched off, which is
+// what sqlite needs for a table to be rebuilt without its dependents being
+// cascaded away. The keys are checked once before committing instead.
+func applyMigration(ctx context.Context, conn *sql.Conn, version int, name, content string) error {
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	return New(conn).ExecTx(ctx, func(q *Queries) error {
+		if _, err := q.db.ExecContext(ctx, content); err != nil {
+			return err
+		}
+
+		rows, err := q.db.QueryContext(ctx, "PRAGMA foreign_key_check")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		if rows.Next() {
+			return errors.New("migration leaves rows violating foreign keys")
+		}
+
+		if err := rows.Close(); err != nil {
+			return err
+		}
+
+		_, err = q.db.ExecContext(
+			ctx,
+			"INSERT INTO schema_migrations (version, name) VALUES (?, ?)",
+			version, name,
+		)
+		return err
+	})
+}
+
+type txBeginner interface {
+	BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+}
+
+// txWrapper is implemented by DBTX wrappers that wrap the transactions begun
+// through them as well.
+type txWrapper interface {
+	wrapTx(tx *sql.Tx) DBTX
+}
+
+// ExecTx runs fn with a Queries bound to a new transaction, committing it when
+// fn returns nil and rolling it back otherwise.
+//
+// fn must only use the Queries it is given. Calling back into q runs outside
+// the transaction, so its writes wait for the transaction's lock; on in-memory
+// databases, whose pool holds a single connection, every call waits forever.
+func (q *Queries) ExecTx(ctx context.Context, fn func(*Queries) error) error {
+	beginner, ok := q.db.(txBeginner)
+	if !ok {
+		return errors.New("queries are not backed by a database that can begin transactions")
+	}
+
+	tx, err := beginner.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	txQueries := q.WithTx(tx)
+	if wrapper, ok := q.db.(txWrapper); ok {
+		txQueries = New(wrapper.wrapTx(tx))
+	}
+
+	if err := fn(txQueries); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("error rolling back transaction: %w (original error: %w)", rollbackErr, err)
+		}
+		return err
+	}
+
+	return tx.Commit()
 }
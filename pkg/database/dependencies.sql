@@ -0,0 +1,69 @@
+-- name: ListTodoDependencies :many
+SELECT todo_dependencies.* FROM todo_dependencies
+JOIN todos ON todos.id = todo_dependencies.todo_id
+WHERE todos.workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (todos.list_id IS NULL AND todos.user_id = sqlc.arg(user_id) OR todos.list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+))
+ORDER BY todo_dependencies.todo_id, todo_dependencies.blocker_id;
+
+-- name: ListTodoBlockers :many
+SELECT * FROM todos
+WHERE id IN (
+  SELECT blocker_id FROM todo_dependencies
+  WHERE todo_id = sqlc.arg(todo_id)
+) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+))
+ORDER BY id;
+
+-- name: ListTodosBlockedBy :many
+SELECT * FROM todos
+WHERE id IN (
+  SELECT todo_id FROM todo_dependencies
+  WHERE blocker_id = sqlc.arg(blocker_id)
+) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+))
+ORDER BY id;
+
+-- name: CountOpenTodoBlockers :one
+SELECT COUNT(*) FROM todos
+WHERE workspace_id = ? AND done = FALSE AND id IN (
+  SELECT blocker_id FROM todo_dependencies
+  WHERE todo_id = ?
+);
+
+-- name: CountTodoDependsOn :one
+WITH RECURSIVE blockers (id) AS (
+  SELECT todos.id FROM todos
+  WHERE todos.id = sqlc.arg(todo_id) AND todos.workspace_id = sqlc.arg(workspace_id)
+  UNION
+  SELECT todo_dependencies.blocker_id FROM todo_dependencies
+  JOIN blockers ON blockers.id = todo_dependencies.todo_id
+  WHERE todo_dependencies.workspace_id = sqlc.arg(workspace_id)
+)
+SELECT COUNT(*) FROM blockers
+WHERE id = sqlc.arg(target_id);
+
+-- name: CountBlockedDoneTodosInList :one
+SELECT COUNT(*) FROM todos
+WHERE list_id = ? AND workspace_id = ? AND done = TRUE AND id IN (
+  SELECT todo_dependencies.todo_id FROM todo_dependencies
+  JOIN todos AS blockers ON blockers.id = todo_dependencies.blocker_id
+  WHERE blockers.done = FALSE
+);
+
+-- name: CreateTodoDependency :exec
+INSERT INTO todo_dependencies (
+  workspace_id,
+  todo_id,
+  blocker_id
+)
+SELECT todos.workspace_id, todos.id, blockers.id FROM todos
+JOIN todos AS blockers ON blockers.workspace_id = todos.workspace_id
+WHERE todos.id = sqlc.arg(todo_id) AND blockers.id = sqlc.arg(blocker_id) AND todos.workspace_id = sqlc.arg(workspace_id)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteTodoDependency :execrows
+DELETE FROM todo_dependencies
+WHERE todo_id = ? AND blocker_id = ? AND workspace_id = ?;
@@ -0,0 +1,34 @@
+-- name: GetList :one
+SELECT * FROM lists
+WHERE id = ? AND workspace_id = ? LIMIT 1;
+
+-- name: ListLists :many
+SELECT * FROM lists
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+)
+ORDER BY created_at;
+
+-- name: CreateList :one
+INSERT INTO lists (
+  workspace_id,
+  name
+) VALUES (
+  ?, ?
+)
+RETURNING *;
+
+-- name: DeleteList :exec
+DELETE FROM lists
+WHERE id = ? AND workspace_id = ?;
+
+-- name: MarkListTodosDone :execrows
+UPDATE todos
+set status_id = sqlc.arg(status_id),
+done = TRUE,
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE list_id = sqlc.arg(list_id) AND workspace_id = sqlc.arg(workspace_id) AND done = FALSE AND status_id IN (
+  SELECT from_state_id FROM workflow_transitions
+  WHERE to_state_id = sqlc.arg(status_id)
+);
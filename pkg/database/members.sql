@@ -0,0 +1,78 @@
+-- name: GetListMember :one
+SELECT * FROM list_members
+WHERE list_id = ? AND user_id = ? AND workspace_id = ? LIMIT 1;
+
+-- name: ListListMembers :many
+SELECT list_members.*, users.name FROM list_members
+JOIN users ON users.id = list_members.user_id
+WHERE list_members.list_id = ? AND list_members.workspace_id = ?
+ORDER BY list_members.created_at, list_members.user_id;
+
+-- name: ListUserMemberships :many
+SELECT * FROM list_members
+WHERE user_id = ?;
+
+-- name: CreateListMember :one
+INSERT INTO list_members (
+  workspace_id,
+  list_id,
+  user_id,
+  role
+)
+SELECT lists.workspace_id, lists.id, users.id, sqlc.arg(role) FROM lists
+JOIN users ON users.workspace_id = lists.workspace_id
+WHERE lists.id = sqlc.arg(list_id) AND users.id = sqlc.arg(user_id)
+RETURNING *;
+
+-- name: CreateMemberTodoChanges :exec
+INSERT INTO todo_changes (workspace_id, user_id, todo_id, list_id, member_id)
+SELECT todos.workspace_id, todos.user_id, todos.id, todos.list_id, list_members.user_id FROM todos
+JOIN list_members ON list_members.list_id = todos.list_id
+WHERE list_members.list_id = ? AND list_members.user_id = ?;
+
+-- name: CreateMemberTodoTombstones :exec
+INSERT INTO todo_changes (workspace_id, user_id, todo_id, list_id, member_id, deleted)
+SELECT todos.workspace_id, todos.user_id, todos.id, todos.list_id, list_members.user_id, TRUE FROM todos
+JOIN list_members ON list_members.list_id = todos.list_id
+WHERE list_members.list_id = ? AND list_members.user_id = ?;
+
+-- name: UpdateListMemberRole :one
+UPDATE list_members
+set role = ?
+WHERE list_id = ? AND user_id = ? AND workspace_id = ?
+RETURNING *;
+
+-- name: DeleteListMember :execrows
+DELETE FROM list_members
+WHERE list_id = ? AND user_id = ? AND workspace_id = ?;
+
+-- name: CountListOwners :one
+SELECT COUNT(*) FROM list_members
+WHERE list_id = ? AND workspace_id = ? AND role = 'owner';
+
+-- name: GetListInvitationByTokenHash :one
+SELECT list_invitations.* FROM list_invitations
+JOIN lists ON lists.id = list_invitations.list_id
+WHERE list_invitations.token_hash = ? AND lists.workspace_id = ?
+LIMIT 1;
+
+-- name: CreateListInvitation :one
+INSERT INTO list_invitations (
+  workspace_id,
+  list_id,
+  invited_by,
+  role,
+  token_hash,
+  expires_at
+)
+SELECT lists.workspace_id, lists.id, sqlc.arg(invited_by), sqlc.arg(role), sqlc.arg(token_hash), sqlc.arg(expires_at) FROM lists
+WHERE lists.id = sqlc.arg(list_id)
+RETURNING *;
+
+-- name: DeleteListInvitation :exec
+DELETE FROM list_invitations
+WHERE id = ?;
+
+-- name: DeleteExpiredListInvitations :exec
+DELETE FROM list_invitations
+WHERE expires_at <= ?;
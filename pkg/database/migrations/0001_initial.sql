@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS lists (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS todos (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  description TEXT NOT NULL,
+  done BOOLEAN NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  version INTEGER NOT NULL DEFAULT 1,
+  list_id INTEGER REFERENCES lists (id) ON DELETE CASCADE,
+  -- position is a rank.Between key ordering the todos of a list.
+  position TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS todos_list_id_position_idx ON todos (list_id, position);
+
+-- todo_changes is an append-only log of every write to todos. Its seq is the
+-- server sequence number handed to sync clients, and rows with deleted set
+-- act as tombstones once the todo itself is gone.
+CREATE TABLE IF NOT EXISTS todo_changes (
+  seq INTEGER PRIMARY KEY AUTOINCREMENT,
+  todo_id INTEGER NOT NULL,
+  deleted BOOLEAN NOT NULL DEFAULT FALSE,
+  changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS todo_changes_todo_id_idx ON todo_changes (todo_id);
+
+CREATE TRIGGER IF NOT EXISTS todos_log_insert AFTER INSERT ON todos
+BEGIN
+  INSERT INTO todo_changes (todo_id) VALUES (NEW.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS todos_log_update AFTER UPDATE ON todos
+BEGIN
+  INSERT INTO todo_changes (todo_id) VALUES (NEW.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS todos_log_delete AFTER DELETE ON todos
+BEGIN
+  INSERT INTO todo_changes (todo_id, deleted) VALUES (OLD.id, TRUE);
+END;
@@ -0,0 +1,47 @@
+CREATE TABLE workflow_states (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  list_id INTEGER NOT NULL REFERENCES lists (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  -- kind is initial, active or terminal. A list has exactly one initial
+  -- state, new todos start there, and todos in a terminal state are done.
+  kind TEXT NOT NULL,
+  -- position orders the states as columns on the board.
+  position INTEGER NOT NULL,
+  wip_limit INTEGER,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (list_id, name)
+);
+
+CREATE TABLE workflow_transitions (
+  from_state_id INTEGER NOT NULL REFERENCES workflow_states (id) ON DELETE CASCADE,
+  to_state_id INTEGER NOT NULL REFERENCES workflow_states (id) ON DELETE CASCADE,
+  PRIMARY KEY (from_state_id, to_state_id)
+);
+
+-- status_id is set for every todo in a list and done mirrors whether that
+-- state is terminal. Todos outside of a list keep using done on its own.
+ALTER TABLE todos ADD COLUMN status_id INTEGER REFERENCES workflow_states (id) ON DELETE SET NULL;
+
+CREATE INDEX todos_status_id_idx ON todos (status_id);
+
+-- existing lists get the same two state workflow new lists start with, and
+-- their todos land in the state matching their done flag.
+INSERT INTO workflow_states (list_id, name, kind, position)
+SELECT id, 'Todo', 'initial', 0 FROM lists;
+
+INSERT INTO workflow_states (list_id, name, kind, position)
+SELECT id, 'Done', 'terminal', 1 FROM lists;
+
+INSERT INTO workflow_transitions (from_state_id, to_state_id)
+SELECT from_state.id, to_state.id
+FROM workflow_states AS from_state
+JOIN workflow_states AS to_state
+  ON to_state.list_id = from_state.list_id AND to_state.id != from_state.id;
+
+UPDATE todos
+SET status_id = (
+  SELECT workflow_states.id FROM workflow_states
+  WHERE workflow_states.list_id = todos.list_id
+    AND workflow_states.kind = CASE WHEN todos.done THEN 'terminal' ELSE 'initial' END
+)
+WHERE list_id IS NOT NULL;
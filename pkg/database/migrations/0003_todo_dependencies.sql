@@ -0,0 +1,10 @@
+-- a row means todo_id can not be done before blocker_id is.
+CREATE TABLE todo_dependencies (
+  todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+  blocker_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (todo_id, blocker_id),
+  CHECK (todo_id != blocker_id)
+);
+
+CREATE INDEX todo_dependencies_blocker_id_idx ON todo_dependencies (blocker_id);
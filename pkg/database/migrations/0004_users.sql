@@ -0,0 +1,65 @@
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the local user owns every todo written before there were accounts.
+INSERT INTO users (id, name) VALUES (1, 'local');
+
+-- sqlite can not add a NOT NULL foreign key to an existing table, so todos
+-- and the change log are rebuilt with their owner.
+CREATE TABLE todos_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  description TEXT NOT NULL,
+  done BOOLEAN NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  version INTEGER NOT NULL DEFAULT 1,
+  list_id INTEGER REFERENCES lists (id) ON DELETE CASCADE,
+  -- position is a rank.Between key ordering the todos of a list.
+  position TEXT NOT NULL DEFAULT '',
+  status_id INTEGER REFERENCES workflow_states (id) ON DELETE SET NULL
+);
+
+INSERT INTO todos_new (id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id)
+SELECT id, 1, description, done, created_at, updated_at, version, list_id, position, status_id FROM todos;
+
+DROP TABLE todos;
+ALTER TABLE todos_new RENAME TO todos;
+
+CREATE INDEX todos_user_id_list_id_position_idx ON todos (user_id, list_id, position);
+CREATE INDEX todos_status_id_idx ON todos (status_id);
+
+CREATE TABLE todo_changes_new (
+  seq INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  todo_id INTEGER NOT NULL,
+  deleted BOOLEAN NOT NULL DEFAULT FALSE,
+  changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO todo_changes_new (seq, user_id, todo_id, deleted, changed_at)
+SELECT seq, 1, todo_id, deleted, changed_at FROM todo_changes;
+
+DROP TABLE todo_changes;
+ALTER TABLE todo_changes_new RENAME TO todo_changes;
+
+CREATE INDEX todo_changes_user_id_seq_idx ON todo_changes (user_id, seq);
+CREATE INDEX todo_changes_todo_id_idx ON todo_changes (todo_id);
+
+CREATE TRIGGER todos_log_insert AFTER INSERT ON todos
+BEGIN
+  INSERT INTO todo_changes (user_id, todo_id) VALUES (NEW.user_id, NEW.id);
+END;
+
+CREATE TRIGGER todos_log_update AFTER UPDATE ON todos
+BEGIN
+  INSERT INTO todo_changes (user_id, todo_id) VALUES (NEW.user_id, NEW.id);
+END;
+
+CREATE TRIGGER todos_log_delete AFTER DELETE ON todos
+BEGIN
+  INSERT INTO todo_changes (user_id, todo_id, deleted) VALUES (OLD.user_id, OLD.id, TRUE);
+END;
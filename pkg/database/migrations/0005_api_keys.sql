@@ -0,0 +1,17 @@
+CREATE TABLE api_keys (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  -- prefix is the public part of a key used to look it up. The secret part
+  -- is only kept as the hex sha256 of salt followed by the secret.
+  prefix TEXT NOT NULL UNIQUE,
+  salt TEXT NOT NULL,
+  hash TEXT NOT NULL,
+  -- scopes is a space separated list such as "todos:read todos:write".
+  scopes TEXT NOT NULL,
+  expires_at TIMESTAMP,
+  last_used_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
@@ -0,0 +1,15 @@
+-- password_hash is an encoded argon2id hash. Users without one, such as the
+-- local user, can not log in with a password.
+ALTER TABLE users ADD COLUMN password_hash TEXT;
+
+CREATE TABLE sessions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  -- token_hash is the hex sha256 of the token stored in the session cookie.
+  token_hash TEXT NOT NULL UNIQUE,
+  csrf_token TEXT NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
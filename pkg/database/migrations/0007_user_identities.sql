@@ -0,0 +1,10 @@
+-- user_identities link users to accounts of external identity providers,
+-- such as the subject of an OpenID Connect issuer.
+CREATE TABLE user_identities (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  issuer TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (issuer, subject)
+);
@@ -0,0 +1,61 @@
+CREATE TABLE list_members (
+  list_id INTEGER NOT NULL REFERENCES lists (id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  -- role is one of owner, editor, commenter or viewer.
+  role TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX list_members_user_id_idx ON list_members (user_id);
+
+-- lists had no owner before, so everyone with todos in a list owns it and
+-- lists without todos go to the local user.
+INSERT INTO list_members (list_id, user_id, role)
+SELECT DISTINCT list_id, user_id, 'owner' FROM todos WHERE list_id IS NOT NULL;
+
+INSERT INTO list_members (list_id, user_id, role)
+SELECT id, 1, 'owner' FROM lists WHERE id NOT IN (SELECT list_id FROM list_members);
+
+CREATE TABLE list_invitations (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  list_id INTEGER NOT NULL REFERENCES lists (id) ON DELETE CASCADE,
+  invited_by INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  role TEXT NOT NULL,
+  -- token_hash is the hex sha256 of the token handed to the invitee.
+  token_hash TEXT NOT NULL UNIQUE,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX list_invitations_list_id_idx ON list_invitations (list_id);
+
+-- changes remember the list of the todo so every member of a shared list
+-- hears about them, deletions included.
+ALTER TABLE todo_changes ADD COLUMN list_id INTEGER;
+
+UPDATE todo_changes SET list_id = (SELECT list_id FROM todos WHERE todos.id = todo_changes.todo_id);
+
+CREATE INDEX todo_changes_list_id_seq_idx ON todo_changes (list_id, seq);
+
+DROP TRIGGER todos_log_insert;
+DROP TRIGGER todos_log_update;
+DROP TRIGGER todos_log_delete;
+
+CREATE TRIGGER todos_log_insert AFTER INSERT ON todos
+BEGIN
+  INSERT INTO todo_changes (user_id, todo_id, list_id) VALUES (NEW.user_id, NEW.id, NEW.list_id);
+END;
+
+-- a todo leaving a list is a deletion for the members of that list.
+CREATE TRIGGER todos_log_update AFTER UPDATE ON todos
+BEGIN
+  INSERT INTO todo_changes (user_id, todo_id, list_id, deleted)
+  SELECT OLD.user_id, OLD.id, OLD.list_id, TRUE WHERE OLD.list_id IS NOT NEW.list_id;
+  INSERT INTO todo_changes (user_id, todo_id, list_id) VALUES (NEW.user_id, NEW.id, NEW.list_id);
+END;
+
+CREATE TRIGGER todos_log_delete AFTER DELETE ON todos
+BEGIN
+  INSERT INTO todo_changes (user_id, todo_id, list_id, deleted) VALUES (OLD.user_id, OLD.id, OLD.list_id, TRUE);
+END;
@@ -0,0 +1,53 @@
+CREATE TABLE workspaces (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  -- slug names the workspace in subdomains, the X-Workspace header and
+  -- /w/{slug} path prefixes.
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  -- max_todos caps the todos the workspace can hold, null is no cap.
+  max_todos INTEGER,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- everything written before there were workspaces lives in the default one.
+INSERT INTO workspaces (id, slug, name) VALUES (1, 'default', 'Default');
+
+-- users, identities, lists and todos are the roots every other table hangs
+-- off through foreign keys. User names and identities are only unique within
+-- a workspace, so those two tables are rebuilt.
+CREATE TABLE users_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  workspace_id INTEGER NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  password_hash TEXT,
+  UNIQUE (workspace_id, name)
+);
+
+INSERT INTO users_new (id, workspace_id, name, created_at, password_hash)
+SELECT id, 1, name, created_at, password_hash FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE TABLE user_identities_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  workspace_id INTEGER NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  issuer TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (workspace_id, issuer, subject)
+);
+
+INSERT INTO user_identities_new (id, workspace_id, user_id, issuer, subject, created_at)
+SELECT id, 1, user_id, issuer, subject, created_at FROM user_identities;
+
+DROP TABLE user_identities;
+ALTER TABLE user_identities_new RENAME TO user_identities;
+
+ALTER TABLE lists ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE todos ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+
+CREATE INDEX lists_workspace_id_idx ON lists (workspace_id);
+CREATE INDEX todos_workspace_id_idx ON todos (workspace_id);
@@ -0,0 +1,6 @@
+-- member_id addresses a change to a single member of a list, written when
+-- they join or leave it. The todos did not change then, but the member's
+-- devices need all of them, or a tombstone for each.
+ALTER TABLE todo_changes ADD COLUMN member_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX todo_changes_member_id_seq_idx ON todo_changes (member_id, seq);
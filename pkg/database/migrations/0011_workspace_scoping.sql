@@ -0,0 +1,68 @@
+-- every other table gets the workspace of the row it hangs off too, so
+-- queries can be scoped by workspace without joining back to the roots.
+ALTER TABLE api_keys ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE list_members ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE sessions ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE list_invitations ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE workflow_states ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE workflow_transitions ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE todo_dependencies ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+ALTER TABLE todo_changes ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces (id) ON DELETE CASCADE;
+
+UPDATE api_keys SET workspace_id = (SELECT workspace_id FROM users WHERE users.id = api_keys.user_id);
+UPDATE sessions SET workspace_id = (SELECT workspace_id FROM users WHERE users.id = sessions.user_id);
+UPDATE list_members SET workspace_id = (SELECT workspace_id FROM lists WHERE lists.id = list_members.list_id);
+UPDATE list_invitations SET workspace_id = (SELECT workspace_id FROM lists WHERE lists.id = list_invitations.list_id);
+UPDATE workflow_states SET workspace_id = (SELECT workspace_id FROM lists WHERE lists.id = workflow_states.list_id);
+UPDATE workflow_transitions SET workspace_id = (SELECT workspace_id FROM workflow_states WHERE workflow_states.id = workflow_transitions.from_state_id);
+UPDATE todo_dependencies SET workspace_id = (SELECT workspace_id FROM todos WHERE todos.id = todo_dependencies.todo_id);
+UPDATE todo_changes SET workspace_id = (SELECT workspace_id FROM users WHERE users.id = todo_changes.user_id);
+
+-- workspace_seq numbers the changes of each workspace on their own, so sync
+-- clients can not tell how busy other workspaces are from the gaps. Changes
+-- written before keep their seq and every workspace counts on from the last
+-- one, so the seqs clients already hold stay valid.
+ALTER TABLE todo_changes ADD COLUMN workspace_seq INTEGER NOT NULL DEFAULT 0;
+
+UPDATE todo_changes SET workspace_seq = seq;
+
+CREATE INDEX todo_changes_workspace_id_workspace_seq_idx ON todo_changes (workspace_id, workspace_seq);
+
+CREATE TABLE workspace_change_seqs (
+  workspace_id INTEGER PRIMARY KEY REFERENCES workspaces (id) ON DELETE CASCADE,
+  seq INTEGER NOT NULL
+);
+
+INSERT INTO workspace_change_seqs (workspace_id, seq)
+SELECT id, (SELECT COALESCE(MAX(seq), 0) FROM todo_changes) FROM workspaces;
+
+CREATE TRIGGER todo_changes_number AFTER INSERT ON todo_changes
+BEGIN
+  INSERT INTO workspace_change_seqs (workspace_id, seq) VALUES (NEW.workspace_id, 1)
+  ON CONFLICT (workspace_id) DO UPDATE SET seq = seq + 1;
+  UPDATE todo_changes SET workspace_seq = (
+    SELECT seq FROM workspace_change_seqs WHERE workspace_id = NEW.workspace_id
+  ) WHERE seq = NEW.seq;
+END;
+
+DROP TRIGGER todos_log_insert;
+DROP TRIGGER todos_log_update;
+DROP TRIGGER todos_log_delete;
+
+CREATE TRIGGER todos_log_insert AFTER INSERT ON todos
+BEGIN
+  INSERT INTO todo_changes (workspace_id, user_id, todo_id, list_id) VALUES (NEW.workspace_id, NEW.user_id, NEW.id, NEW.list_id);
+END;
+
+-- a todo leaving a list is a deletion for the members of that list.
+CREATE TRIGGER todos_log_update AFTER UPDATE ON todos
+BEGIN
+  INSERT INTO todo_changes (workspace_id, user_id, todo_id, list_id, deleted)
+  SELECT OLD.workspace_id, OLD.user_id, OLD.id, OLD.list_id, TRUE WHERE OLD.list_id IS NOT NEW.list_id;
+  INSERT INTO todo_changes (workspace_id, user_id, todo_id, list_id) VALUES (NEW.workspace_id, NEW.user_id, NEW.id, NEW.list_id);
+END;
+
+CREATE TRIGGER todos_log_delete AFTER DELETE ON todos
+BEGIN
+  INSERT INTO todo_changes (workspace_id, user_id, todo_id, list_id, deleted) VALUES (OLD.workspace_id, OLD.user_id, OLD.id, OLD.list_id, TRUE);
+END;
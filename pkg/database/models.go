@@ -6,11 +6,135 @@ package database
 
 import (
 	"database/sql"
+	"time"
 )
 
+type ApiKey struct {
+	ID          int64
+	UserID      int64
+	Name        string
+	Prefix      string
+	Salt        string
+	Hash        string
+	Scopes      string
+	ExpiresAt   sql.NullTime
+	LastUsedAt  sql.NullTime
+	CreatedAt   sql.NullTime
+	WorkspaceID int64
+}
+
+type List struct {
+	ID          int64
+	Name        string
+	CreatedAt   sql.NullTime
+	WorkspaceID int64
+}
+
+type ListInvitation struct {
+	ID          int64
+	ListID      int64
+	InvitedBy   int64
+	Role        string
+	TokenHash   string
+	ExpiresAt   time.Time
+	CreatedAt   sql.NullTime
+	WorkspaceID int64
+}
+
+type ListMember struct {
+	ListID      int64
+	UserID      int64
+	Role        string
+	CreatedAt   sql.NullTime
+	WorkspaceID int64
+}
+
+type Session struct {
+	ID          int64
+	UserID      int64
+	TokenHash   string
+	CsrfToken   string
+	ExpiresAt   time.Time
+	CreatedAt   sql.NullTime
+	WorkspaceID int64
+}
+
 type Todo struct {
 	ID          int64
+	UserID      int64
 	Description string
 	Done        bool
 	CreatedAt   sql.NullTime
+	UpdatedAt   sql.NullTime
+	Version     int64
+	ListID      sql.NullInt64
+	Position    string
+	StatusID    sql.NullInt64
+	WorkspaceID int64
+}
+
+type TodoChange struct {
+	Seq          int64
+	UserID       int64
+	TodoID       int64
+	Deleted      bool
+	ChangedAt    sql.NullTime
+	ListID       sql.NullInt64
+	MemberID     sql.NullInt64
+	WorkspaceID  int64
+	WorkspaceSeq int64
+}
+
+type TodoDependency struct {
+	TodoID      int64
+	BlockerID   int64
+	CreatedAt   sql.NullTime
+	WorkspaceID int64
+}
+
+type User struct {
+	ID           int64
+	WorkspaceID  int64
+	Name         string
+	CreatedAt    sql.NullTime
+	PasswordHash sql.NullString
+}
+
+type UserIdentity struct {
+	ID          int64
+	WorkspaceID int64
+	UserID      int64
+	Issuer      string
+	Subject     string
+	CreatedAt   sql.NullTime
+}
+
+type WorkflowState struct {
+	ID          int64
+	ListID      int64
+	Name        string
+	Kind        string
+	Position    int64
+	WipLimit    sql.NullInt64
+	CreatedAt   sql.NullTime
+	WorkspaceID int64
+}
+
+type WorkflowTransition struct {
+	FromStateID int64
+	ToStateID   int64
+	WorkspaceID int64
+}
+
+type Workspace struct {
+	ID        int64
+	Slug      string
+	Name      string
+	MaxTodos  sql.NullInt64
+	CreatedAt sql.NullTime
+}
+
+type WorkspaceChangeSeq struct {
+	WorkspaceID int64
+	Seq         int64
 }
@@ -1,27 +1,168 @@
 -- name: GetTodo :one
 SELECT * FROM todos
-WHERE id = ? LIMIT 1;
+WHERE id = sqlc.arg(id) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+))
+LIMIT 1;
 
 -- name: ListTodos :many
 SELECT * FROM todos
-ORDER BY created_at;
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+))
+ORDER BY list_id, position, id;
+
+-- name: ListTodosPage :many
+SELECT * FROM todos
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+)) AND (
+  sqlc.narg(after_id) IS NULL
+  OR list_id IS sqlc.narg(after_list_id) AND (position, id) > (sqlc.arg(after_position), sqlc.narg(after_id))
+  OR sqlc.narg(after_list_id) IS NULL AND list_id IS NOT NULL
+  OR list_id > sqlc.narg(after_list_id)
+)
+ORDER BY list_id, position, id
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
 
 -- name: CreateTodo :one
 INSERT INTO todos (
-  description, 
-  done
-) VALUES (
-  ?, ?
+  workspace_id,
+  user_id,
+  description,
+  done,
+  list_id,
+  position,
+  status_id
 )
+SELECT users.workspace_id, users.id, sqlc.arg(description), sqlc.arg(done), sqlc.arg(list_id), sqlc.arg(position), sqlc.arg(status_id) FROM users
+JOIN workspaces ON workspaces.id = users.workspace_id
+WHERE users.id = sqlc.arg(user_id)
+AND (sqlc.arg(list_id) IS NULL OR sqlc.arg(list_id) IN (SELECT id FROM lists WHERE lists.workspace_id = users.workspace_id))
+AND (workspaces.max_todos IS NULL OR workspaces.max_todos > (SELECT COUNT(*) FROM todos WHERE todos.workspace_id = users.workspace_id))
 RETURNING *;
 
 -- name: UpdateTodo :one
 UPDATE todos
-set description = ?,
-done = ?
-WHERE id = ?
+set description = sqlc.arg(description),
+done = sqlc.arg(done),
+position = CASE WHEN list_id IS sqlc.arg(list_id) THEN position ELSE CAST(sqlc.arg(end_position) AS TEXT) END,
+list_id = sqlc.arg(list_id),
+status_id = sqlc.arg(status_id),
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id) AND role IN ('owner', 'editor')
+))
 RETURNING *;
 
 -- name: DeleteTodo :exec
 DELETE FROM todos
-WHERE id = ?;
+WHERE id = sqlc.arg(id) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id) AND role IN ('owner', 'editor')
+));
+
+-- name: DeleteCompletedTodos :execrows
+DELETE FROM todos
+WHERE done = TRUE AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id) AND role IN ('owner', 'editor')
+));
+
+-- name: UpdateTodoVersioned :one
+UPDATE todos
+set description = sqlc.arg(description),
+done = sqlc.arg(done),
+position = CASE WHEN list_id IS sqlc.arg(list_id) THEN position ELSE CAST(sqlc.arg(end_position) AS TEXT) END,
+list_id = sqlc.arg(list_id),
+status_id = sqlc.arg(status_id),
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND version = sqlc.arg(version) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id) AND role IN ('owner', 'editor')
+))
+RETURNING *;
+
+-- name: DeleteTodoVersioned :execrows
+DELETE FROM todos
+WHERE id = sqlc.arg(id) AND version = sqlc.arg(version) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id) AND role IN ('owner', 'editor')
+));
+
+-- name: GetTodoChangeSeq :one
+SELECT CAST(COALESCE(MAX(workspace_seq), 0) AS INTEGER) AS seq FROM todo_changes
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id));
+
+-- name: ListTodosChangedBetween :many
+SELECT * FROM todos
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+)) AND id IN (
+  SELECT todo_id FROM todo_changes
+  WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND workspace_seq > sqlc.arg(since) AND workspace_seq <= sqlc.arg(until)
+)
+ORDER BY id;
+
+-- name: ListTodoTombstonesBetween :many
+SELECT DISTINCT todo_id FROM todo_changes
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (member_id = sqlc.arg(user_id) OR list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+)) AND deleted = TRUE AND workspace_seq > sqlc.arg(since) AND workspace_seq <= sqlc.arg(until) AND todo_id NOT IN (
+  SELECT id FROM todos WHERE todos.workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (todos.list_id IS NULL AND todos.user_id = sqlc.arg(user_id) OR todos.list_id IN (
+    SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+  ))
+)
+ORDER BY todo_id;
+
+-- name: ListTodosInList :many
+SELECT * FROM todos
+WHERE list_id IS sqlc.arg(list_id) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+))
+ORDER BY position, id;
+
+-- name: GetLastTodoPosition :one
+SELECT position FROM todos
+WHERE list_id IS sqlc.arg(list_id) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+))
+ORDER BY position DESC LIMIT 1;
+
+-- name: GetTodoPositionBefore :one
+SELECT position FROM todos
+WHERE list_id IS sqlc.arg(list_id) AND position < sqlc.arg(position) AND id != sqlc.arg(id) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+))
+ORDER BY position DESC LIMIT 1;
+
+-- name: GetTodoPositionAfter :one
+SELECT position FROM todos
+WHERE list_id IS sqlc.arg(list_id) AND position > sqlc.arg(position) AND id != sqlc.arg(id) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id)
+))
+ORDER BY position LIMIT 1;
+
+-- name: SetTodoPosition :one
+UPDATE todos
+set list_id = sqlc.arg(list_id),
+position = sqlc.arg(position),
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id) AND role IN ('owner', 'editor')
+))
+RETURNING *;
+
+-- name: SetTodoStatus :one
+UPDATE todos
+set status_id = sqlc.arg(status_id),
+done = sqlc.arg(done),
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = sqlc.arg(user_id)) AND (list_id IS NULL AND user_id = sqlc.arg(user_id) OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = sqlc.arg(user_id) AND role IN ('owner', 'editor')
+))
+RETURNING *;
+
+-- name: CountTodosByDone :many
+SELECT done, COUNT(*) AS count FROM todos
+GROUP BY done;
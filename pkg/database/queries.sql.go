@@ -7,69 +7,413 @@ package database
 
 import (
 	"context"
+	"database/sql"
 )
 
+const countTodosByDone = `-- name: CountTodosByDone :many
+SELECT done, COUNT(*) AS count FROM todos
+GROUP BY done
+`
+
+type CountTodosByDoneRow struct {
+	Done  bool
+	Count int64
+}
+
+func (q *Queries) CountTodosByDone(ctx context.Context) ([]CountTodosByDoneRow, error) {
+	rows, err := q.db.QueryContext(ctx, countTodosByDone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountTodosByDoneRow
+	for rows.Next() {
+		var i CountTodosByDoneRow
+		if err := rows.Scan(&i.Done, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createTodo = `-- name: CreateTodo :one
 INSERT INTO todos (
-  description, 
-  done
-) VALUES (
-  ?, ?
+  workspace_id,
+  user_id,
+  description,
+  done,
+  list_id,
+  position,
+  status_id
 )
-RETURNING id, description, done, created_at
+SELECT users.workspace_id, users.id, ?, ?, ?, ?, ? FROM users
+JOIN workspaces ON workspaces.id = users.workspace_id
+WHERE users.id = ?
+AND (? IS NULL OR ? IN (SELECT id FROM lists WHERE lists.workspace_id = users.workspace_id))
+AND (workspaces.max_todos IS NULL OR workspaces.max_todos > (SELECT COUNT(*) FROM todos WHERE todos.workspace_id = users.workspace_id))
+RETURNING id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id
 `
 
 type CreateTodoParams struct {
 	Description string
 	Done        bool
+	ListID      sql.NullInt64
+	Position    string
+	StatusID    sql.NullInt64
+	UserID      int64
 }
 
 func (q *Queries) CreateTodo(ctx context.Context, arg CreateTodoParams) (Todo, error) {
-	row := q.db.QueryRowContext(ctx, createTodo, arg.Description, arg.Done)
+	row := q.db.QueryRowContext(ctx, createTodo,
+		arg.Description,
+		arg.Done,
+		arg.ListID,
+		arg.Position,
+		arg.StatusID,
+		arg.UserID,
+		arg.ListID,
+		arg.ListID,
+	)
 	var i Todo
 	err := row.Scan(
 		&i.ID,
+		&i.UserID,
 		&i.Description,
 		&i.Done,
 		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.ListID,
+		&i.Position,
+		&i.StatusID,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
 
+const deleteCompletedTodos = `-- name: DeleteCompletedTodos :execrows
+DELETE FROM todos
+WHERE done = TRUE AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ? AND role IN ('owner', 'editor')
+))
+`
+
+func (q *Queries) DeleteCompletedTodos(ctx context.Context, userID int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteCompletedTodos, userID, userID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteTodo = `-- name: DeleteTodo :exec
 DELETE FROM todos
-WHERE id = ?
+WHERE id = ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ? AND role IN ('owner', 'editor')
+))
 `
 
-func (q *Queries) DeleteTodo(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, deleteTodo, id)
+type DeleteTodoParams struct {
+	ID     int64
+	UserID int64
+}
+
+func (q *Queries) DeleteTodo(ctx context.Context, arg DeleteTodoParams) error {
+	_, err := q.db.ExecContext(ctx, deleteTodo,
+		arg.ID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
 	return err
 }
 
+const deleteTodoVersioned = `-- name: DeleteTodoVersioned :execrows
+DELETE FROM todos
+WHERE id = ? AND version = ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ? AND role IN ('owner', 'editor')
+))
+`
+
+type DeleteTodoVersionedParams struct {
+	ID      int64
+	Version int64
+	UserID  int64
+}
+
+func (q *Queries) DeleteTodoVersioned(ctx context.Context, arg DeleteTodoVersionedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteTodoVersioned,
+		arg.ID,
+		arg.Version,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getLastTodoPosition = `-- name: GetLastTodoPosition :one
+SELECT position FROM todos
+WHERE list_id IS ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ?
+))
+ORDER BY position DESC LIMIT 1
+`
+
+type GetLastTodoPositionParams struct {
+	ListID sql.NullInt64
+	UserID int64
+}
+
+func (q *Queries) GetLastTodoPosition(ctx context.Context, arg GetLastTodoPositionParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, getLastTodoPosition,
+		arg.ListID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
+	var position string
+	err := row.Scan(&position)
+	return position, err
+}
+
 const getTodo = `-- name: GetTodo :one
-SELECT id, description, done, created_at FROM todos
-WHERE id = ? LIMIT 1
+SELECT id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id FROM todos
+WHERE id = ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ?
+))
+LIMIT 1
 `
 
-func (q *Queries) GetTodo(ctx context.Context, id int64) (Todo, error) {
-	row := q.db.QueryRowContext(ctx, getTodo, id)
+type GetTodoParams struct {
+	ID     int64
+	UserID int64
+}
+
+func (q *Queries) GetTodo(ctx context.Context, arg GetTodoParams) (Todo, error) {
+	row := q.db.QueryRowContext(ctx, getTodo,
+		arg.ID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
 	var i Todo
 	err := row.Scan(
 		&i.ID,
+		&i.UserID,
 		&i.Description,
 		&i.Done,
 		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.ListID,
+		&i.Position,
+		&i.StatusID,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
 
+const getTodoChangeSeq = `-- name: GetTodoChangeSeq :one
+SELECT CAST(COALESCE(MAX(workspace_seq), 0) AS INTEGER) AS seq FROM todo_changes
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?)
+`
+
+func (q *Queries) GetTodoChangeSeq(ctx context.Context, userID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getTodoChangeSeq, userID)
+	var seq int64
+	err := row.Scan(&seq)
+	return seq, err
+}
+
+const getTodoPositionAfter = `-- name: GetTodoPositionAfter :one
+SELECT position FROM todos
+WHERE list_id IS ? AND position > ? AND id != ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ?
+))
+ORDER BY position LIMIT 1
+`
+
+type GetTodoPositionAfterParams struct {
+	ListID   sql.NullInt64
+	Position string
+	ID       int64
+	UserID   int64
+}
+
+func (q *Queries) GetTodoPositionAfter(ctx context.Context, arg GetTodoPositionAfterParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, getTodoPositionAfter,
+		arg.ListID,
+		arg.Position,
+		arg.ID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
+	var position string
+	err := row.Scan(&position)
+	return position, err
+}
+
+const getTodoPositionBefore = `-- name: GetTodoPositionBefore :one
+SELECT position FROM todos
+WHERE list_id IS ? AND position < ? AND id != ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ?
+))
+ORDER BY position DESC LIMIT 1
+`
+
+type GetTodoPositionBeforeParams struct {
+	ListID   sql.NullInt64
+	Position string
+	ID       int64
+	UserID   int64
+}
+
+func (q *Queries) GetTodoPositionBefore(ctx context.Context, arg GetTodoPositionBeforeParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, getTodoPositionBefore,
+		arg.ListID,
+		arg.Position,
+		arg.ID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
+	var position string
+	err := row.Scan(&position)
+	return position, err
+}
+
+const listTodoTombstonesBetween = `-- name: ListTodoTombstonesBetween :many
+SELECT DISTINCT todo_id FROM todo_changes
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (member_id = ? OR list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ?
+)) AND deleted = TRUE AND workspace_seq > ? AND workspace_seq <= ? AND todo_id NOT IN (
+  SELECT id FROM todos WHERE todos.workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (todos.list_id IS NULL AND todos.user_id = ? OR todos.list_id IN (
+    SELECT list_id FROM list_members WHERE list_members.user_id = ?
+  ))
+)
+ORDER BY todo_id
+`
+
+type ListTodoTombstonesBetweenParams struct {
+	UserID int64
+	Since  int64
+	Until  int64
+}
+
+func (q *Queries) ListTodoTombstonesBetween(ctx context.Context, arg ListTodoTombstonesBetweenParams) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, listTodoTombstonesBetween,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+		arg.Since,
+		arg.Until,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var todo_id int64
+		if err := rows.Scan(&todo_id); err != nil {
+			return nil, err
+		}
+		items = append(items, todo_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listTodos = `-- name: ListTodos :many
-SELECT id, description, done, created_at FROM todos
-ORDER BY created_at
+SELECT id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id FROM todos
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ?
+))
+ORDER BY list_id, position, id
+`
+
+func (q *Queries) ListTodos(ctx context.Context, userID int64) ([]Todo, error) {
+	rows, err := q.db.QueryContext(ctx, listTodos, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Todo
+	for rows.Next() {
+		var i Todo
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Description,
+			&i.Done,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Version,
+			&i.ListID,
+			&i.Position,
+			&i.StatusID,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTodosChangedBetween = `-- name: ListTodosChangedBetween :many
+SELECT id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id FROM todos
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ?
+)) AND id IN (
+  SELECT todo_id FROM todo_changes
+  WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND workspace_seq > ? AND workspace_seq <= ?
+)
+ORDER BY id
 `
 
-func (q *Queries) ListTodos(ctx context.Context) ([]Todo, error) {
-	rows, err := q.db.QueryContext(ctx, listTodos)
+type ListTodosChangedBetweenParams struct {
+	UserID int64
+	Since  int64
+	Until  int64
+}
+
+func (q *Queries) ListTodosChangedBetween(ctx context.Context, arg ListTodosChangedBetweenParams) ([]Todo, error) {
+	rows, err := q.db.QueryContext(ctx, listTodosChangedBetween,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+		arg.Since,
+		arg.Until,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -79,9 +423,16 @@ func (q *Queries) ListTodos(ctx context.Context) ([]Todo, error) {
 		var i Todo
 		if err := rows.Scan(
 			&i.ID,
+			&i.UserID,
 			&i.Description,
 			&i.Done,
 			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Version,
+			&i.ListID,
+			&i.Position,
+			&i.StatusID,
+			&i.WorkspaceID,
 		); err != nil {
 			return nil, err
 		}
@@ -96,28 +447,327 @@ func (q *Queries) ListTodos(ctx context.Context) ([]Todo, error) {
 	return items, nil
 }
 
+const listTodosInList = `-- name: ListTodosInList :many
+SELECT id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id FROM todos
+WHERE list_id IS ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ?
+))
+ORDER BY position, id
+`
+
+type ListTodosInListParams struct {
+	ListID sql.NullInt64
+	UserID int64
+}
+
+func (q *Queries) ListTodosInList(ctx context.Context, arg ListTodosInListParams) ([]Todo, error) {
+	rows, err := q.db.QueryContext(ctx, listTodosInList,
+		arg.ListID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Todo
+	for rows.Next() {
+		var i Todo
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Description,
+			&i.Done,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Version,
+			&i.ListID,
+			&i.Position,
+			&i.StatusID,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTodosPage = `-- name: ListTodosPage :many
+SELECT id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id FROM todos
+WHERE workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ?
+)) AND (
+  ? IS NULL
+  OR list_id IS ? AND (position, id) > (?, ?)
+  OR ? IS NULL AND list_id IS NOT NULL
+  OR list_id > ?
+)
+ORDER BY list_id, position, id
+LIMIT ? OFFSET ?
+`
+
+type ListTodosPageParams struct {
+	UserID        int64
+	AfterID       sql.NullInt64
+	AfterListID   sql.NullInt64
+	AfterPosition string
+	Limit         int64
+	Offset        int64
+}
+
+func (q *Queries) ListTodosPage(ctx context.Context, arg ListTodosPageParams) ([]Todo, error) {
+	rows, err := q.db.QueryContext(ctx, listTodosPage,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+		arg.AfterID,
+		arg.AfterListID,
+		arg.AfterPosition,
+		arg.AfterID,
+		arg.AfterListID,
+		arg.AfterListID,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Todo
+	for rows.Next() {
+		var i Todo
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Description,
+			&i.Done,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Version,
+			&i.ListID,
+			&i.Position,
+			&i.StatusID,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setTodoPosition = `-- name: SetTodoPosition :one
+UPDATE todos
+set list_id = ?,
+position = ?,
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ? AND role IN ('owner', 'editor')
+))
+RETURNING id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id
+`
+
+type SetTodoPositionParams struct {
+	ListID   sql.NullInt64
+	Position string
+	ID       int64
+	UserID   int64
+}
+
+func (q *Queries) SetTodoPosition(ctx context.Context, arg SetTodoPositionParams) (Todo, error) {
+	row := q.db.QueryRowContext(ctx, setTodoPosition,
+		arg.ListID,
+		arg.Position,
+		arg.ID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
+	var i Todo
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Description,
+		&i.Done,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.ListID,
+		&i.Position,
+		&i.StatusID,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const setTodoStatus = `-- name: SetTodoStatus :one
+UPDATE todos
+set status_id = ?,
+done = ?,
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ? AND role IN ('owner', 'editor')
+))
+RETURNING id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id
+`
+
+type SetTodoStatusParams struct {
+	StatusID sql.NullInt64
+	Done     bool
+	ID       int64
+	UserID   int64
+}
+
+func (q *Queries) SetTodoStatus(ctx context.Context, arg SetTodoStatusParams) (Todo, error) {
+	row := q.db.QueryRowContext(ctx, setTodoStatus,
+		arg.StatusID,
+		arg.Done,
+		arg.ID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
+	var i Todo
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Description,
+		&i.Done,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.ListID,
+		&i.Position,
+		&i.StatusID,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
 const updateTodo = `-- name: UpdateTodo :one
 UPDATE todos
 set description = ?,
-done = ?
-WHERE id = ?
-RETURNING id, description, done, created_at
+done = ?,
+position = CASE WHEN list_id IS ? THEN position ELSE CAST(? AS TEXT) END,
+list_id = ?,
+status_id = ?,
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ? AND role IN ('owner', 'editor')
+))
+RETURNING id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id
 `
 
 type UpdateTodoParams struct {
 	Description string
 	Done        bool
+	ListID      sql.NullInt64
+	EndPosition string
+	StatusID    sql.NullInt64
 	ID          int64
+	UserID      int64
 }
 
 func (q *Queries) UpdateTodo(ctx context.Context, arg UpdateTodoParams) (Todo, error) {
-	row := q.db.QueryRowContext(ctx, updateTodo, arg.Description, arg.Done, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateTodo,
+		arg.Description,
+		arg.Done,
+		arg.ListID,
+		arg.EndPosition,
+		arg.ListID,
+		arg.StatusID,
+		arg.ID,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
+	var i Todo
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Description,
+		&i.Done,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.ListID,
+		&i.Position,
+		&i.StatusID,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const updateTodoVersioned = `-- name: UpdateTodoVersioned :one
+UPDATE todos
+set description = ?,
+done = ?,
+position = CASE WHEN list_id IS ? THEN position ELSE CAST(? AS TEXT) END,
+list_id = ?,
+status_id = ?,
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND version = ? AND workspace_id = (SELECT workspace_id FROM users WHERE users.id = ?) AND (list_id IS NULL AND user_id = ? OR list_id IN (
+  SELECT list_id FROM list_members WHERE list_members.user_id = ? AND role IN ('owner', 'editor')
+))
+RETURNING id, user_id, description, done, created_at, updated_at, version, list_id, position, status_id, workspace_id
+`
+
+type UpdateTodoVersionedParams struct {
+	Description string
+	Done        bool
+	ListID      sql.NullInt64
+	EndPosition string
+	StatusID    sql.NullInt64
+	ID          int64
+	Version     int64
+	UserID      int64
+}
+
+func (q *Queries) UpdateTodoVersioned(ctx context.Context, arg UpdateTodoVersionedParams) (Todo, error) {
+	row := q.db.QueryRowContext(ctx, updateTodoVersioned,
+		arg.Description,
+		arg.Done,
+		arg.ListID,
+		arg.EndPosition,
+		arg.ListID,
+		arg.StatusID,
+		arg.ID,
+		arg.Version,
+		arg.UserID,
+		arg.UserID,
+		arg.UserID,
+	)
 	var i Todo
 	err := row.Scan(
 		&i.ID,
+		&i.UserID,
 		&i.Description,
 		&i.Done,
 		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.ListID,
+		&i.Position,
+		&i.StatusID,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
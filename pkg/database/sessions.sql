@@ -0,0 +1,27 @@
+-- name: GetSessionByTokenHash :one
+SELECT * FROM sessions
+WHERE token_hash = ? LIMIT 1;
+
+-- name: CreateSession :one
+INSERT INTO sessions (
+  workspace_id,
+  user_id,
+  token_hash,
+  csrf_token,
+  expires_at
+)
+SELECT users.workspace_id, users.id, sqlc.arg(token_hash), sqlc.arg(csrf_token), sqlc.arg(expires_at) FROM users
+WHERE users.id = sqlc.arg(user_id)
+RETURNING *;
+
+-- name: DeleteSessionByTokenHash :exec
+DELETE FROM sessions
+WHERE token_hash = ?;
+
+-- name: DeleteExpiredUserSessions :exec
+DELETE FROM sessions
+WHERE user_id = ? AND expires_at <= ?;
+
+-- name: DeleteExpiredSessions :execrows
+DELETE FROM sessions
+WHERE expires_at <= ?;
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedDB is a DBTX recording a span for every statement it runs, named
+// after the sqlc query the statement comes from.
+type TracedDB struct {
+	db     DBTX
+	tracer trace.Tracer
+}
+
+// NewTracedDB wraps db, which is usually a *sql.DB, so every statement run
+// through it is traced with tracer. Transactions begun by ExecTx are traced
+// as well.
+func NewTracedDB(db DBTX, tracer trace.Tracer) *TracedDB {
+	return &TracedDB{db: db, tracer: tracer}
+}
+
+func (t *TracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	result, err := t.db.ExecContext(ctx, query, args...)
+	recordError(span, err)
+	return result, err
+}
+
+func (t *TracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	stmt, err := t.db.PrepareContext(ctx, query)
+	recordError(span, err)
+	return stmt, err
+}
+
+func (t *TracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	recordError(span, err)
+	return rows, err
+}
+
+// QueryRowContext can not tell whether the statement failed, its errors
+// only come out of Scan.
+func (t *TracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	return t.db.QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx lets ExecTx begin transactions on the wrapped database.
+func (t *TracedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	beginner, ok := t.db.(txBeginner)
+	if !ok {
+		return nil, errors.New("traced database can not begin transactions")
+	}
+	return beginner.BeginTx(ctx, opts)
+}
+
+func (t *TracedDB) wrapTx(tx *sql.Tx) DBTX {
+	return &TracedDB{db: tx, tracer: t.tracer}
+}
+
+func (t *TracedDB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	name, statement := queryName(query)
+	operation, _, _ := strings.Cut(statement, " ")
+	return t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "sqlite"),
+			attribute.String("db.operation.name", strings.ToUpper(operation)),
+			attribute.String("db.query.text", statement),
+		),
+	)
+}
+
+// queryName splits the "-- name: GetTodo :one" header sqlc puts on every
+// query from the statement. Statements without one are named after their
+// first keyword.
+func queryName(query string) (name, statement string) {
+	query = strings.TrimSpace(query)
+	if header, rest, found := strings.Cut(query, "\n"); found && strings.HasPrefix(header, "-- name: ") {
+		fields := strings.Fields(strings.TrimPrefix(header, "-- name: "))
+		if len(fields) > 0 {
+			return fields[0], strings.TrimSpace(rest)
+		}
+	}
+
+	operation, _, _ := strings.Cut(query, " ")
+	return strings.ToUpper(operation), query
+}
+
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
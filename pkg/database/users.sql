@@ -0,0 +1,46 @@
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = ? LIMIT 1;
+
+-- name: GetUserByName :one
+SELECT * FROM users
+WHERE workspace_id = ? AND name = ? LIMIT 1;
+
+-- name: CreateUser :one
+INSERT INTO users (
+  workspace_id,
+  name
+) VALUES (
+  ?, ?
+)
+RETURNING *;
+
+-- name: CreateUserWithPassword :one
+INSERT INTO users (
+  workspace_id,
+  name,
+  password_hash
+) VALUES (
+  ?, ?, ?
+)
+RETURNING *;
+
+-- name: GetUserByIdentity :one
+SELECT users.* FROM users
+JOIN user_identities ON user_identities.user_id = users.id
+WHERE user_identities.workspace_id = ? AND user_identities.issuer = ? AND user_identities.subject = ?
+LIMIT 1;
+
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (
+  workspace_id,
+  user_id,
+  issuer,
+  subject
+) VALUES (
+  ?, ?, ?, ?
+);
+
+-- name: CountUserIdentities :one
+SELECT COUNT(*) FROM user_identities
+WHERE user_id = ?;
@@ -0,0 +1,76 @@
+-- name: GetWorkflowState :one
+SELECT * FROM workflow_states
+WHERE id = ? AND workspace_id = ? LIMIT 1;
+
+-- name: GetWorkflowStateByKind :one
+SELECT * FROM workflow_states
+WHERE list_id = ? AND kind = ? AND workspace_id = ?
+ORDER BY position LIMIT 1;
+
+-- name: ListWorkflowStates :many
+SELECT * FROM workflow_states
+WHERE list_id = ? AND workspace_id = ?
+ORDER BY position;
+
+-- name: CreateWorkflowState :one
+INSERT INTO workflow_states (
+  workspace_id,
+  list_id,
+  name,
+  kind,
+  position,
+  wip_limit
+)
+SELECT lists.workspace_id, lists.id, sqlc.arg(name), sqlc.arg(kind), sqlc.arg(position), sqlc.arg(wip_limit) FROM lists
+WHERE lists.id = sqlc.arg(list_id) AND lists.workspace_id = sqlc.arg(workspace_id)
+RETURNING *;
+
+-- name: UpdateWorkflowState :one
+UPDATE workflow_states
+set kind = ?,
+position = ?,
+wip_limit = ?
+WHERE id = ? AND workspace_id = ?
+RETURNING *;
+
+-- name: DeleteWorkflowState :exec
+DELETE FROM workflow_states
+WHERE id = ? AND workspace_id = ?;
+
+-- name: ListWorkflowTransitions :many
+SELECT workflow_transitions.* FROM workflow_transitions
+JOIN workflow_states ON workflow_states.id = workflow_transitions.from_state_id
+WHERE workflow_states.list_id = ? AND workflow_transitions.workspace_id = ?
+ORDER BY workflow_transitions.from_state_id, workflow_transitions.to_state_id;
+
+-- name: CountWorkflowTransitions :one
+SELECT COUNT(*) FROM workflow_transitions
+WHERE from_state_id = ? AND to_state_id = ? AND workspace_id = ?;
+
+-- name: CreateWorkflowTransition :exec
+INSERT INTO workflow_transitions (
+  workspace_id,
+  from_state_id,
+  to_state_id
+)
+SELECT from_state.workspace_id, from_state.id, to_state.id FROM workflow_states AS from_state
+JOIN workflow_states AS to_state ON to_state.list_id = from_state.list_id
+WHERE from_state.id = sqlc.arg(from_state_id) AND to_state.id = sqlc.arg(to_state_id) AND from_state.workspace_id = sqlc.arg(workspace_id);
+
+-- name: DeleteListWorkflowTransitions :exec
+DELETE FROM workflow_transitions
+WHERE workspace_id = ? AND from_state_id IN (
+  SELECT id FROM workflow_states
+  WHERE list_id = ?
+);
+
+-- name: SetStatusTodosDone :exec
+UPDATE todos
+set done = sqlc.arg(done),
+version = version + 1,
+updated_at = CURRENT_TIMESTAMP
+WHERE status_id = sqlc.arg(status_id) AND workspace_id = sqlc.arg(workspace_id) AND done != sqlc.arg(done);
+
+-- name: CountTodosInStatus :one
+SELECT COUNT(*) FROM todos
+WHERE status_id = ? AND workspace_id = ?;
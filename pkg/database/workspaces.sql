@@ -0,0 +1,28 @@
+-- name: GetWorkspaceBySlug :one
+SELECT * FROM workspaces
+WHERE slug = ? LIMIT 1;
+
+-- name: ListWorkspaces :many
+SELECT * FROM workspaces
+ORDER BY id;
+
+-- name: CreateWorkspace :one
+INSERT INTO workspaces (
+  slug,
+  name,
+  max_todos
+) VALUES (
+  ?, ?, ?
+)
+RETURNING *;
+
+-- name: UpdateWorkspace :one
+UPDATE workspaces
+set name = ?,
+max_todos = ?
+WHERE slug = ?
+RETURNING *;
+
+-- name: CountWorkspaceTodos :one
+SELECT COUNT(*) FROM todos
+WHERE workspace_id = ?;
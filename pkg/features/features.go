@@ -0,0 +1,43 @@
+package features
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/juancortelezzi/gogsd/pkg/config"
+)
+
+// Flags are the features turned on, which can change while the server
+// serves requests.
+type Flags struct {
+	current atomic.Pointer[config.Features]
+}
+
+func New(features config.Features) *Flags {
+	f := &Flags{}
+	f.Set(features)
+	return f
+}
+
+// Set turns features on and off for requests from now on.
+func (f *Flags) Set(features config.Features) {
+	f.current.Store(&features)
+}
+
+func (f *Flags) Get() config.Features {
+	return *f.current.Load()
+}
+
+// Require returns a middleware answering 404, as if the route did not
+// exist, while enabled reports the feature off.
+func (f *Flags) Require(enabled func(config.Features) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !enabled(f.Get()) {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
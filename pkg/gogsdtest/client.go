@@ -0,0 +1,156 @@
+package gogsdtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+// Client calls a Server on behalf of a test, failing it when a request can
+// not be made at all. The typed methods also fail it when the server does
+// not answer as a successful call would; Do is for the calls that should
+// not succeed.
+type Client struct {
+	t       testing.TB
+	baseURL string
+	client  *http.Client
+	header  http.Header
+}
+
+// NewClient returns a client authenticated with key, or with no
+// credentials at all when key is empty.
+func (s *Server) NewClient(key string) *Client {
+	return NewClient(s.t, s.URL, s.Server.Client(), key)
+}
+
+// NewClient returns a client calling the gogsd at baseURL through client,
+// for servers a test runs some other way than New. It is authenticated with
+// key, or with no credentials at all when key is empty.
+func NewClient(t testing.TB, baseURL string, client *http.Client, key string) *Client {
+	c := &Client{t: t, baseURL: baseURL, client: client, header: make(http.Header)}
+	if key != "" {
+		c.header.Set("Authorization", "Bearer "+key)
+	}
+	return c
+}
+
+// WithHeader returns a copy of c sending header key with every request. A
+// Host header names the host requests are made to.
+func (c *Client) WithHeader(key, value string) *Client {
+	clone := *c
+	clone.header = c.header.Clone()
+	clone.header.Set(key, value)
+	return &clone
+}
+
+// Do sends a request to path. body is sent as is when it is a string or
+// []byte and as JSON otherwise, nil sends none. The body of the response is
+// closed when the test ends.
+func (c *Client) Do(method, path string, body any) *http.Response {
+	c.t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(body)
+	case []byte:
+		reader = bytes.NewBuffer(body)
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewBuffer(data)
+	}
+
+	request, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for key, values := range c.header {
+		request.Header[key] = values
+	}
+	if host := c.header.Get("Host"); host != "" {
+		request.Host = host
+	}
+	if reader != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(request)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// JSON sends body like Do, expects the response to have status and
+// decodes it into out, unless out is nil.
+func (c *Client) JSON(method, path string, body any, status int, out any) {
+	c.t.Helper()
+
+	resp := c.Do(method, path, body)
+	if resp.StatusCode != status {
+		data, _ := io.ReadAll(resp.Body)
+		c.t.Fatalf("%s %s: expected status code to be %d but got %d: %s", method, path, status, resp.StatusCode, bytes.TrimSpace(data))
+	}
+
+	if out == nil {
+		return
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		c.t.Fatalf("%s %s: could not decode response: %v", method, path, err)
+	}
+}
+
+// TodoParams are what todos are created and updated with.
+type TodoParams struct {
+	Description string
+	Done        bool
+	ListID      *int64 `json:",omitempty"`
+}
+
+func (c *Client) ListTodos() []database.Todo {
+	c.t.Helper()
+
+	var todos []database.Todo
+	c.JSON(http.MethodGet, "/todos", nil, http.StatusOK, &todos)
+	return todos
+}
+
+func (c *Client) CreateTodo(params TodoParams) database.Todo {
+	c.t.Helper()
+
+	var todo database.Todo
+	c.JSON(http.MethodPost, "/todos", params, http.StatusCreated, &todo)
+	return todo
+}
+
+func (c *Client) UpdateTodo(id int64, params TodoParams) database.Todo {
+	c.t.Helper()
+
+	var todo database.Todo
+	c.JSON(http.MethodPut, fmt.Sprintf("/todos/%d", id), params, http.StatusOK, &todo)
+	return todo
+}
+
+func (c *Client) DeleteTodo(id int64) {
+	c.t.Helper()
+	c.JSON(http.MethodDelete, fmt.Sprintf("/todos/%d", id), nil, http.StatusOK, nil)
+}
+
+func (c *Client) CreateList(name string) database.List {
+	c.t.Helper()
+
+	var list database.List
+	c.JSON(http.MethodPost, "/lists", struct{ Name string }{name}, http.StatusCreated, &list)
+	return list
+}
@@ -0,0 +1,65 @@
+package gogsdtest
+
+import (
+	"fmt"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+// TodoBuilder builds todo fixtures, created through the API by the client
+// of the server the builder came from.
+type TodoBuilder struct {
+	s      *Server
+	client *Client
+	params TodoParams
+}
+
+// NewTodo starts building a todo, described "todo <n>" after how many the
+// server created unless Description is called.
+func (s *Server) NewTodo() *TodoBuilder {
+	return &TodoBuilder{s: s, client: s.Client}
+}
+
+func (b *TodoBuilder) Description(description string) *TodoBuilder {
+	b.params.Description = description
+	return b
+}
+
+func (b *TodoBuilder) Done() *TodoBuilder {
+	b.params.Done = true
+	return b
+}
+
+func (b *TodoBuilder) InList(id int64) *TodoBuilder {
+	b.params.ListID = &id
+	return b
+}
+
+// By makes client create the todo, for fixtures owned by another user.
+func (b *TodoBuilder) By(client *Client) *TodoBuilder {
+	b.client = client
+	return b
+}
+
+func (b *TodoBuilder) Create() database.Todo {
+	b.s.t.Helper()
+
+	params := b.params
+	b.s.todos++
+	if params.Description == "" {
+		params.Description = fmt.Sprintf("todo %d", b.s.todos)
+	}
+	return b.client.CreateTodo(params)
+}
+
+// CreateN creates n todos, each described apart unless Description was
+// called.
+func (b *TodoBuilder) CreateN(n int) []database.Todo {
+	b.s.t.Helper()
+
+	todos := make([]database.Todo, n)
+	for i := range todos {
+		todos[i] = b.Create()
+	}
+	return todos
+}
@@ -0,0 +1,118 @@
+// Package gogsdtest serves gogsd in process for tests. Every Server listens
+// on a port of its own and has a database of its own, so the tests using
+// it can call t.Parallel.
+package gogsdtest
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/cors"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/features"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/metrics"
+	"github.com/juancortelezzi/gogsd/pkg/ratelimit"
+	"github.com/juancortelezzi/gogsd/pkg/routes"
+	"github.com/juancortelezzi/gogsd/pkg/server"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+// APIKey is stored as an admin key of the local user of every Server. Its
+// Client sends it.
+const APIKey = "gsd_0123456789ab_gogsdtest-admin-key"
+
+// Server is the handler of server.NewServerHandler served by an
+// httptest.Server. Probes, metrics and OpenID Connect login are not served.
+type Server struct {
+	*httptest.Server
+
+	DB      *sql.DB
+	Queries *database.Queries
+	// Client is authenticated with APIKey.
+	Client *Client
+
+	t testing.TB
+	// todos counts the todo fixtures created, to describe them apart.
+	todos int
+}
+
+// Option changes the configuration a Server is set up with.
+type Option func(*config.Config)
+
+// WithConfig lets edit change the configuration a Server is set up with.
+func WithConfig(edit func(*config.Config)) Option {
+	return Option(edit)
+}
+
+// New serves gogsd with an empty in-memory database until the test ends.
+// Rate limits are off unless an option turns them on, tests make requests
+// faster than people do.
+func New(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Database.URL = ":memory:"
+	cfg.RateLimit.Auth, cfg.RateLimit.Read, cfg.RateLimit.Write, cfg.RateLimit.Client = "off", "off", "off", "off"
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	rateLimits, err := cfg.RateLimitConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(testWriter{t}, slog.LevelDebug)
+
+	db, err := database.Open(ctx, logger, cfg.Database.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	queries := database.New(db)
+	if err := auth.EnsureAPIKey(ctx, queries, "local", APIKey, []string{auth.ScopeAdmin}); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := server.NewServerHandler(server.HandlerDeps{
+		Deps: routes.Deps{
+			Logger:   logger,
+			Queries:  queries,
+			Validate: validator.New(validator.WithRequiredStructEnabled()),
+			Limiter:  ratelimit.New(ratelimit.NewMemoryStore(), rateLimits),
+			Metrics:  metrics.New(db, queries),
+			Flags:    features.New(cfg.Features),
+		},
+		Resolver:     workspace.NewResolver(queries, cfg.Workspace.Domain),
+		Policy:       cors.New(cfg.CORS.AllowedOrigins),
+		MaxBodyBytes: cfg.Limits.MaxBodyBytes,
+	})
+
+	s := &Server{Server: httptest.NewServer(handler), DB: db, Queries: queries, t: t}
+	t.Cleanup(s.Close)
+	s.Client = s.NewClient(APIKey)
+
+	return s
+}
+
+// testWriter logs the server through t, so each test only shows its own
+// lines, and only when it fails or runs verbosely.
+type testWriter struct {
+	t testing.TB
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
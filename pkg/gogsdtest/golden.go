@@ -0,0 +1,95 @@
+package gogsdtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the responses the tests got")
+
+// Scrubbed replaces the values that change from run to run in golden files.
+const Scrubbed = "<scrubbed>"
+
+// Golden compares the status and body of resp with testdata/<name>.golden,
+// or writes the file when the tests run with -update. JSON bodies are
+// indented with their keys sorted, and the values of keys ending in At,
+// the timestamps, are replaced by Scrubbed, as are those of the keys in
+// scrub.
+func Golden(t testing.TB, resp *http.Response, name string, scrub ...string) {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := fmt.Sprintf("%d %s\n\n%s\n", resp.StatusCode, http.StatusText(resp.StatusCode), normalize(body, scrub))
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run the tests with -update to write it", err)
+	}
+
+	if got != string(want) {
+		t.Fatalf("response does not match %s, run the tests with -update if it should:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// normalize indents JSON bodies and scrubs them, other bodies are left as
+// they are.
+func normalize(body []byte, scrub []string) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return string(bytes.TrimSpace(body))
+	}
+
+	var indented bytes.Buffer
+	encoder := json.NewEncoder(&indented)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(scrubValue(v, scrub)); err != nil {
+		return string(bytes.TrimSpace(body))
+	}
+	return string(bytes.TrimSpace(indented.Bytes()))
+}
+
+func scrubValue(v any, scrub []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if strings.HasSuffix(key, "At") || slices.Contains(scrub, key) {
+				v[key] = Scrubbed
+				continue
+			}
+			v[key] = scrubValue(value, scrub)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = scrubValue(value, scrub)
+		}
+	}
+	return v
+}
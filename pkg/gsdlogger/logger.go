@@ -1,9 +1,11 @@
 package gsdlogger
 
 import (
+	"context"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 )
 
 type Logger = *slog.Logger
@@ -35,9 +37,41 @@ func (rw *LoggerResponseWritter) WriteHeader(code int) {
 	return
 }
 
-func NewLogger(w io.Writer, level slog.Level) Logger {
+// NewLogger logs records at level and above to w. A *slog.LevelVar lets
+// the level change while the logger is in use.
+func NewLogger(w io.Writer, level slog.Leveler) Logger {
 	options := &slog.HandlerOptions{Level: level}
 	handler := slog.NewTextHandler(w, options)
 
-	return slog.New(handler)
+	return slog.New(contextHandler{handler})
+}
+
+type contextAttrsKey struct{}
+
+// WithAttrs returns a copy of ctx whose args, given as to slog.Logger.With,
+// are added to every record logged with it by a Logger from NewLogger. It
+// lets middlewares tag every line logged for a request, by any logger.
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	previous, _ := ctx.Value(contextAttrsKey{}).([]any)
+	return context.WithValue(ctx, contextAttrsKey{}, append(slices.Clip(previous), args...))
+}
+
+// contextHandler adds the attributes stored by WithAttrs to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if args, ok := ctx.Value(contextAttrsKey{}).([]any); ok {
+		r.Add(args...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
 }
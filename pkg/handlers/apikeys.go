@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// apiKey is what clients get to see of a stored key, which leaves out its
+// salt and hash.
+type apiKey struct {
+	ID         int64
+	Name       string
+	Prefix     string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	CreatedAt  sql.NullTime
+}
+
+func toAPIKey(key database.ApiKey) apiKey {
+	return apiKey{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     strings.Fields(key.Scopes),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+func HandleListAPIKeys(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		keys, err := queries.ListAPIKeys(r.Context(), user.ID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get api keys from db", "err", err)
+			apierror.Error(w, "could not get api keys from db", http.StatusInternalServerError)
+			return
+		}
+
+		views := make([]apiKey, len(keys))
+		for i, key := range keys {
+			views[i] = toAPIKey(key)
+		}
+
+		writeJson(w, logger, r, http.StatusOK, views)
+	})
+}
+
+// HandleCreateAPIKey creates a key for the caller. The key itself is only
+// part of this response. A key can not be given scopes the caller lacks.
+func HandleCreateAPIKey(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := auth.IdentityFromContext(r.Context())
+		if !ok {
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthenticated, "unauthenticated")
+			return
+		}
+
+		var keyParams struct {
+			Name      string   `validate:"min=1,max=255"`
+			Scopes    []string `validate:"min=1,dive,oneof=todos:read todos:write admin"`
+			ExpiresAt *time.Time
+		}
+
+		if !decodeBody(w, logger, r, &keyParams, "api key") {
+			return
+		}
+
+		if err := validate.Struct(keyParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var expiresAt sql.NullTime
+		if keyParams.ExpiresAt != nil {
+			if !keyParams.ExpiresAt.After(time.Now()) {
+				apierror.Error(w, "validation fail: ExpiresAt must be in the future", http.StatusBadRequest)
+				return
+			}
+			expiresAt = sql.NullTime{Time: keyParams.ExpiresAt.UTC(), Valid: true}
+		}
+
+		for _, scope := range keyParams.Scopes {
+			if !identity.HasScope(scope) {
+				apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, fmt.Sprintf("missing scope %s", scope))
+				return
+			}
+		}
+
+		key, params, err := auth.NewAPIKey(identity.User.ID, keyParams.Name, keyParams.Scopes, expiresAt)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not generate api key", "err", err)
+			apierror.Error(w, "could not generate api key", http.StatusInternalServerError)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "creating api key", "name", keyParams.Name, "scopes", keyParams.Scopes)
+		stored, err := queries.CreateAPIKey(r.Context(), params)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not save api key in database", "err", err)
+			apierror.Error(w, "could not save api key in database", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusCreated, struct {
+			Key    string
+			APIKey apiKey
+		}{Key: key, APIKey: toAPIKey(stored)})
+	})
+}
+
+func HandleDeleteAPIKey(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		logger.DebugContext(r.Context(), "deleting api key", "id", id)
+		deleted, err := queries.DeleteAPIKey(r.Context(), database.DeleteAPIKeyParams{ID: id, UserID: user.ID})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not delete api key", "err", err)
+			apierror.Error(w, "could not delete api key in database", http.StatusInternalServerError)
+			return
+		}
+
+		if deleted == 0 {
+			apierror.Error(w, "api key not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// batchModeAtomic applies every operation or none of them, while the
+// best_effort mode applies every operation that can be applied and reports
+// the rest as failed.
+const batchModeAtomic = "atomic"
+
+// errBatchAborted rolls back an atomic batch after one of its operations failed.
+var errBatchAborted = errors.New("batch aborted")
+
+type batchOperation struct {
+	Op string `validate:"oneof=create update delete"`
+	ID int64  `validate:"required_unless=Op create"`
+	// Description, Done and ListID are only written when present, so an
+	// update can touch a single field.
+	Description *string `validate:"required_if=Op create,omitempty,min=1,max=255,ascii"`
+	Done        *bool
+	ListID      *int64
+	// Version, when present, is the version of the todo the operation was
+	// made from. Updates and deletes of a todo changed since conflict
+	// instead of overwriting the change.
+	Version *int64
+	// Force completes the todo even when some of its blockers are open.
+	Force bool
+}
+
+type batchResult struct {
+	Index  int
+	Op     string
+	ID     int64
+	Status int
+	Todo   *database.Todo
+	Error  string
+}
+
+// HandleBatchTodos runs many create, update and delete operations in a single
+// transaction and reports a status for each of them.
+func HandleBatchTodos(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		var batchParams struct {
+			Mode       string           `validate:"omitempty,oneof=atomic best_effort"`
+			Operations []batchOperation `validate:"min=1,max=1000"`
+		}
+
+		if !decodeBody(w, logger, r, &batchParams, "batch") {
+			return
+		}
+
+		if err := validate.Struct(batchParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if batchParams.Mode == "" {
+			batchParams.Mode = batchModeAtomic
+		}
+
+		logger.DebugContext(
+			r.Context(), "running batch",
+			"mode", batchParams.Mode,
+			"operations", len(batchParams.Operations),
+		)
+
+		results := make([]batchResult, len(batchParams.Operations))
+		failed := -1
+
+		err := queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			for i, operation := range batchParams.Operations {
+				result, err := applyBatchOperation(r, tx, validate, user, operation)
+				if err != nil {
+					return err
+				}
+
+				result.Index = i
+				results[i] = result
+
+				if result.Status >= http.StatusBadRequest && batchParams.Mode == batchModeAtomic {
+					failed = i
+					return errBatchAborted
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil && !errors.Is(err, errBatchAborted) {
+			logger.ErrorContext(r.Context(), "could not run batch", "err", err)
+			apierror.Error(w, "could not run batch", http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		if failed >= 0 {
+			status = http.StatusUnprocessableEntity
+			for i := range results {
+				if i == failed {
+					continue
+				}
+
+				results[i] = batchResult{
+					Index:  i,
+					Op:     batchParams.Operations[i].Op,
+					ID:     batchParams.Operations[i].ID,
+					Status: http.StatusFailedDependency,
+					Error:  fmt.Sprintf("not applied because operation %d failed", failed),
+				}
+			}
+		}
+
+		resultsJson, err := json.Marshal(map[string][]batchResult{"Results": results})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not marshal batch results", "err", err)
+			apierror.Error(w, "could not marshal batch results", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(resultsJson)
+	})
+}
+
+// applyBatchOperation only returns an error when the database fails; problems
+// with the operation itself are reported through the result status.
+func applyBatchOperation(
+	r *http.Request,
+	queries *database.Queries,
+	validate *validator.Validate,
+	user database.User,
+	operation batchOperation,
+) (batchResult, error) {
+	result := batchResult{Op: operation.Op, ID: operation.ID}
+
+	fail := func(status int, message string) (batchResult, error) {
+		result.Status = status
+		result.Error = message
+		return result, nil
+	}
+
+	if err := validate.Struct(operation); err != nil {
+		return fail(http.StatusBadRequest, fmt.Sprintf("validation fail: %s", err))
+	}
+
+	err := checkListRole(r.Context(), queries, user, toNullInt64(operation.ListID), editRoles...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fail(http.StatusBadRequest, "list not found")
+	}
+	if errors.Is(err, errForbidden) {
+		return fail(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return result, fmt.Errorf("could not get list: %w", err)
+	}
+
+	if operation.Op == opCreate {
+		position, err := endOfList(r.Context(), queries, user.ID, toNullInt64(operation.ListID))
+		if err != nil {
+			return result, err
+		}
+
+		params := database.CreateTodoParams{
+			UserID:      user.ID,
+			Description: *operation.Description,
+			ListID:      toNullInt64(operation.ListID),
+			Position:    position,
+		}
+		if operation.Done != nil {
+			params.Done = *operation.Done
+		}
+
+		params.StatusID, params.Done, err = resolveStatus(r.Context(), queries, user.WorkspaceID, nil, params.ListID, params.Done)
+		if errors.Is(err, errWorkflow) {
+			return fail(http.StatusConflict, err.Error())
+		}
+		if err != nil {
+			return result, err
+		}
+
+		todo, err := createTodo(r.Context(), queries, params)
+		if errors.Is(err, errQuotaExceeded) {
+			return fail(http.StatusForbidden, err.Error())
+		}
+		if err != nil {
+			return result, fmt.Errorf("could not create todo: %w", err)
+		}
+
+		result.ID = todo.ID
+		result.Status = http.StatusCreated
+		result.Todo = &todo
+		return result, nil
+	}
+
+	todo, err := queries.GetTodo(r.Context(), database.GetTodoParams{ID: operation.ID, UserID: user.ID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fail(http.StatusNotFound, "todo not found")
+	}
+	if err != nil {
+		return result, fmt.Errorf("could not get todo %d: %w", operation.ID, err)
+	}
+
+	err = checkListRole(r.Context(), queries, user, todo.ListID, editRoles...)
+	if errors.Is(err, errForbidden) {
+		return fail(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return result, fmt.Errorf("could not get list of todo %d: %w", operation.ID, err)
+	}
+
+	if operation.Version != nil && *operation.Version != todo.Version {
+		return fail(http.StatusConflict, fmt.Sprintf("todo is at version %d, not %d", todo.Version, *operation.Version))
+	}
+
+	if operation.Op == opDelete {
+		err := queries.DeleteTodo(r.Context(), database.DeleteTodoParams{ID: operation.ID, UserID: user.ID})
+		if err != nil {
+			return result, fmt.Errorf("could not delete todo %d: %w", operation.ID, err)
+		}
+
+		result.Status = http.StatusOK
+		return result, nil
+	}
+
+	params := database.UpdateTodoParams{
+		Description: todo.Description,
+		Done:        todo.Done,
+		ListID:      todo.ListID,
+		ID:          todo.ID,
+		UserID:      user.ID,
+	}
+	if operation.Description != nil {
+		params.Description = *operation.Description
+	}
+	if operation.Done != nil {
+		params.Done = *operation.Done
+	}
+	if operation.ListID != nil {
+		params.ListID = toNullInt64(operation.ListID)
+	}
+
+	params.EndPosition, err = endOfList(r.Context(), queries, user.ID, params.ListID)
+	if err != nil {
+		return result, err
+	}
+
+	params.StatusID, params.Done, err = resolveStatus(r.Context(), queries, user.WorkspaceID, &todo, params.ListID, params.Done)
+	if errors.Is(err, errWorkflow) {
+		return fail(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return result, err
+	}
+
+	err = checkBlockers(r.Context(), queries, todo, params.Done, operation.Force)
+	if errors.Is(err, errBlocked) {
+		return fail(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return result, err
+	}
+
+	todo, err = queries.UpdateTodo(r.Context(), params)
+	if err != nil {
+		return result, fmt.Errorf("could not update todo %d: %w", operation.ID, err)
+	}
+
+	result.Status = http.StatusOK
+	result.Todo = &todo
+	return result, nil
+}
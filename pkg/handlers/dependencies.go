@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+var (
+	// errBlocked is returned when a todo would be done while one of its
+	// blockers is still open. Handlers answer it with 409 Conflict unless the
+	// request was forced.
+	errBlocked = errors.New("blocked")
+	// errDependencyCycle is returned when a new blocker already depends on
+	// the todo it would block.
+	errDependencyCycle = errors.New("dependency cycle")
+	errBadBlocker      = errors.New("bad blocker")
+)
+
+// readyTodo is an open todo in the order it can be worked on. Depth is the
+// length of the longest chain of open blockers in front of it, so todos with
+// a depth of 0 can be started right away.
+type readyTodo struct {
+	Todo         database.Todo
+	Depth        int
+	OpenBlockers []int64
+}
+
+// HandleAddTodoBlocker records that a todo can not be done before another
+// one is. Adding a blocker twice is not an error.
+func HandleAddTodoBlocker(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		var blockerParams struct {
+			BlockerID int64 `validate:"required"`
+		}
+
+		if !decodeBody(w, logger, r, &blockerParams, "blocker") {
+			return
+		}
+
+		if err := validate.Struct(blockerParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "adding blocker", "id", id, "requestParams", blockerParams)
+
+		var blockers []database.Todo
+		err = queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			todo, err := tx.GetTodo(r.Context(), database.GetTodoParams{ID: id, UserID: user.ID})
+			if err != nil {
+				return err
+			}
+
+			if err := checkListRole(r.Context(), tx, user, todo.ListID, editRoles...); err != nil {
+				return err
+			}
+
+			_, err = tx.GetTodo(r.Context(), database.GetTodoParams{ID: blockerParams.BlockerID, UserID: user.ID})
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: todo %d not found", errBadBlocker, blockerParams.BlockerID)
+			}
+			if err != nil {
+				return err
+			}
+
+			// the blocker may not already wait on the todo, directly or not
+			cycle, err := tx.CountTodoDependsOn(r.Context(), database.CountTodoDependsOnParams{
+				TodoID:      blockerParams.BlockerID,
+				WorkspaceID: user.WorkspaceID,
+				TargetID:    id,
+			})
+			if err != nil {
+				return err
+			}
+
+			if cycle > 0 {
+				return fmt.Errorf("%w: todo %d already depends on todo %d", errDependencyCycle, blockerParams.BlockerID, id)
+			}
+
+			err = tx.CreateTodoDependency(r.Context(), database.CreateTodoDependencyParams{
+				TodoID:      id,
+				BlockerID:   blockerParams.BlockerID,
+				WorkspaceID: user.WorkspaceID,
+			})
+			if err != nil {
+				return err
+			}
+
+			blockers, err = tx.ListTodoBlockers(r.Context(), database.ListTodoBlockersParams{
+				TodoID: id,
+				UserID: user.ID,
+			})
+			return err
+		})
+
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "todo not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if errors.Is(err, errBadBlocker) {
+			apierror.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, errDependencyCycle) {
+			logger.DebugContext(r.Context(), "could not add blocker", "err", err)
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not add blocker", "err", err)
+			apierror.Error(w, "could not add blocker in database", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusCreated, blockers)
+	})
+}
+
+func HandleRemoveTodoBlocker(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		blockerID, err := strconv.ParseInt(r.PathValue("blockerId"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse blocker id", "err", err)
+			apierror.Error(w, "could not parse blocker id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		todo, err := queries.GetTodo(r.Context(), database.GetTodoParams{ID: id, UserID: user.ID})
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "todo not found", http.StatusNotFound)
+			return
+		}
+
+		if err == nil {
+			err = checkListRole(r.Context(), queries, user, todo.ListID, editRoles...)
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todo", "err", err)
+			apierror.Error(w, "could not get todo from db", http.StatusInternalServerError)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "removing blocker", "id", id, "blocker", blockerID)
+		removed, err := queries.DeleteTodoDependency(r.Context(), database.DeleteTodoDependencyParams{
+			TodoID:      id,
+			BlockerID:   blockerID,
+			WorkspaceID: user.WorkspaceID,
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not remove blocker", "err", err)
+			apierror.Error(w, "could not remove blocker in database", http.StatusInternalServerError)
+			return
+		}
+
+		if removed == 0 {
+			apierror.Error(w, "blocker not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// HandleListTodoBlockers lists the todos that have to be done before this
+// one, leaving out the ones the user can not see.
+func HandleListTodoBlockers(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return handleListRelatedTodos(logger, queries, func(ctx context.Context, id, userID int64) ([]database.Todo, error) {
+		return queries.ListTodoBlockers(ctx, database.ListTodoBlockersParams{TodoID: id, UserID: userID})
+	})
+}
+
+// HandleListTodoBlocking lists the todos waiting on this one.
+func HandleListTodoBlocking(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return handleListRelatedTodos(logger, queries, func(ctx context.Context, id, userID int64) ([]database.Todo, error) {
+		return queries.ListTodosBlockedBy(ctx, database.ListTodosBlockedByParams{BlockerID: id, UserID: userID})
+	})
+}
+
+func handleListRelatedTodos(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	list func(ctx context.Context, id, userID int64) ([]database.Todo, error),
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		_, err = queries.GetTodo(r.Context(), database.GetTodoParams{ID: id, UserID: user.ID})
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "todo not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todo", "err", err)
+			apierror.Error(w, "could not get todo from db", http.StatusInternalServerError)
+			return
+		}
+
+		todos, err := list(r.Context(), id, user.ID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todos from db", "err", err)
+			apierror.Error(w, "could not get todos from db", http.StatusInternalServerError)
+			return
+		}
+
+		if todos == nil {
+			todos = []database.Todo{}
+		}
+
+		writeJson(w, logger, r, http.StatusOK, todos)
+	})
+}
+
+// HandleListReadyTodos answers with every open todo sorted so that each one
+// comes after all of its open blockers. Todos at the same depth keep their
+// list order.
+func HandleListReadyTodos(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		todos, err := queries.ListTodos(r.Context(), user.ID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todos from db", "err", err)
+			apierror.Error(w, "could not get todos from db", http.StatusInternalServerError)
+			return
+		}
+
+		dependencies, err := queries.ListTodoDependencies(r.Context(), user.ID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get dependencies from db", "err", err)
+			apierror.Error(w, "could not get dependencies from db", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusOK, sortReadyTodos(todos, dependencies))
+	})
+}
+
+// sortReadyTodos orders the open todos topologically, one depth at a time.
+func sortReadyTodos(todos []database.Todo, dependencies []database.TodoDependency) []readyTodo {
+	var open []database.Todo
+	index := map[int64]int{}
+	for _, todo := range todos {
+		if !todo.Done {
+			index[todo.ID] = len(open)
+			open = append(open, todo)
+		}
+	}
+
+	blockers := make([][]int64, len(open))
+	dependents := map[int64][]int{}
+	for _, dependency := range dependencies {
+		i, todoOpen := index[dependency.TodoID]
+		_, blockerOpen := index[dependency.BlockerID]
+		if todoOpen && blockerOpen {
+			blockers[i] = append(blockers[i], dependency.BlockerID)
+			dependents[dependency.BlockerID] = append(dependents[dependency.BlockerID], i)
+		}
+	}
+
+	pending := make([]int, len(open))
+	var layer []int
+	for i := range open {
+		pending[i] = len(blockers[i])
+		if pending[i] == 0 {
+			layer = append(layer, i)
+		}
+	}
+
+	sorted := make([]readyTodo, 0, len(open))
+	for depth := 0; len(layer) > 0; depth++ {
+		var next []int
+		for _, i := range layer {
+			openBlockers := blockers[i]
+			if openBlockers == nil {
+				openBlockers = []int64{}
+			}
+			sorted = append(sorted, readyTodo{Todo: open[i], Depth: depth, OpenBlockers: openBlockers})
+
+			for _, j := range dependents[open[i].ID] {
+				pending[j]--
+				if pending[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+
+		sort.Ints(next)
+		layer = next
+	}
+
+	return sorted
+}
+
+// checkBlockers refuses to complete todo while any of its blockers is open.
+// Todos that already are done, or stay open, are never blocked.
+func checkBlockers(ctx context.Context, queries *database.Queries, todo database.Todo, done, force bool) error {
+	if force || !done || todo.Done {
+		return nil
+	}
+
+	open, err := queries.CountOpenTodoBlockers(ctx, database.CountOpenTodoBlockersParams{
+		WorkspaceID: todo.WorkspaceID,
+		TodoID:      todo.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if open > 0 {
+		return fmt.Errorf("%w: todo %d still has %d open blockers", errBlocked, todo.ID, open)
+	}
+
+	return nil
+}
+
+// parseForce reads the force query parameter that lets a request complete
+// todos whose blockers are still open.
+func parseForce(r *http.Request) (bool, error) {
+	force := r.URL.Query().Get("force")
+	if force == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(force)
+}
@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/database"
 	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
 )
 
 func HandlePing() http.Handler {
@@ -19,10 +26,62 @@ func HandleHello(l gsdlogger.Logger) http.Handler {
 
 		if name == "" {
 			l.ErrorContext(r.Context(), "error getting name from url", "name", name)
-			http.Error(w, "name is required", http.StatusBadRequest)
+			apierror.Error(w, "name is required", http.StatusBadRequest)
 			return
 		}
 
 		fmt.Fprintf(w, "Hello, %s!\n", name)
 	})
 }
+
+// requestUser returns the user a request was made by, answering 401 when the
+// route was not wrapped by a middleware that sets one.
+func requestUser(w http.ResponseWriter, logger gsdlogger.Logger, r *http.Request) (database.User, bool) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		logger.DebugContext(r.Context(), "request has no user")
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthenticated, "unauthenticated")
+	}
+	return user, ok
+}
+
+// requestWorkspace returns the workspace a request was made to, answering 500
+// when the route was not wrapped by the workspace middleware.
+func requestWorkspace(w http.ResponseWriter, logger gsdlogger.Logger, r *http.Request) (database.Workspace, bool) {
+	ws, ok := workspace.FromContext(r.Context())
+	if !ok {
+		logger.ErrorContext(r.Context(), "request has no workspace")
+		apierror.Error(w, "request has no workspace", http.StatusInternalServerError)
+	}
+	return ws, ok
+}
+
+// decodeBody decodes the JSON body of r into v, answering 400 when it has
+// fields v does not, or anything after the value, and 413 when it is over
+// the limit the server puts on bodies. what names v in the answer.
+func decodeBody(w http.ResponseWriter, logger gsdlogger.Logger, r *http.Request, v any, what string) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil {
+		// the limit may only be hit past the value, which is still too large.
+		if trailing := decoder.Decode(&struct{}{}); trailing != io.EOF {
+			err = errors.Join(errors.New("body has data after the value"), trailing)
+		}
+	}
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		logger.DebugContext(r.Context(), "body too large", "limit", tooLarge.Limit)
+		apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodeRequestTooLarge, fmt.Sprintf("body is larger than %d bytes", tooLarge.Limit))
+		return false
+	}
+
+	logger.DebugContext(r.Context(), "could not decode "+what+" from body", "err", err)
+	apierror.Error(w, "could not decode "+what+" from body", http.StatusBadRequest)
+	return false
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// HandleListLists lists the lists the user is a member of, each with the
+// user's role in it.
+func HandleListLists(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		lists, err := queries.ListLists(r.Context(), user.ID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get lists from db", "err", err)
+			apierror.Error(w, "could not get lists from db", http.StatusInternalServerError)
+			return
+		}
+
+		roles, err := listRoles(r.Context(), queries, user.ID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list roles from db", "err", err)
+			apierror.Error(w, "could not get lists from db", http.StatusInternalServerError)
+			return
+		}
+
+		shared := make([]sharedList, len(lists))
+		for i, list := range lists {
+			shared[i] = sharedList{List: list, Role: roles[list.ID]}
+		}
+
+		listsJson, err := json.Marshal(shared)
+		if err != nil {
+			apierror.Error(w, "could not marshal lists", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(listsJson)
+	})
+}
+
+// HandleCreateList creates a list owned by the user in their workspace.
+func HandleCreateList(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		var listParams struct {
+			Name string `validate:"min=1,max=255"`
+		}
+
+		if !decodeBody(w, logger, r, &listParams, "list") {
+			return
+		}
+
+		if err := validate.Struct(listParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var list database.List
+		err := queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			var err error
+			list, err = tx.CreateList(r.Context(), database.CreateListParams{
+				WorkspaceID: user.WorkspaceID,
+				Name:        listParams.Name,
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.CreateListMember(r.Context(), database.CreateListMemberParams{
+				ListID: list.ID,
+				UserID: user.ID,
+				Role:   roleOwner,
+			})
+			if err != nil {
+				return err
+			}
+			return createDefaultWorkflow(r.Context(), tx, list)
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not save list in database", "err", err)
+			apierror.Error(w, "could not save list in database", http.StatusInternalServerError)
+			return
+		}
+
+		listJson, err := json.Marshal(list)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not marshal list", "err", err)
+			apierror.Error(w, "could not marshal list", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(listJson)
+	})
+}
+
+// HandleDeleteList deletes a list together with every todo in it. Only its
+// owners can do it.
+func HandleDeleteList(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		err = checkListRole(r.Context(), queries, user, sql.NullInt64{Int64: id, Valid: true}, roleOwner)
+		if errors.Is(err, sql.ErrNoRows) {
+			// deleting a list that is not there is not an error
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "deleting list", "id", id)
+		if err := queries.DeleteList(r.Context(), database.DeleteListParams{ID: id, WorkspaceID: user.WorkspaceID}); err != nil {
+			logger.ErrorContext(r.Context(), "could not delete list", "err", err)
+			apierror.Error(w, "could not delete list in database", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// HandleMarkListDone marks every open todo in a list as done.
+func HandleMarkListDone(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		force, err := parseForce(r)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse force", "err", err)
+			apierror.Error(w, "could not parse force", http.StatusBadRequest)
+			return
+		}
+
+		err = checkListRole(r.Context(), queries, user, sql.NullInt64{Int64: id, Valid: true}, editRoles...)
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "list not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		// todos are moved to the first terminal state, skipping the ones the
+		// workflow does not let go there directly.
+		var updated int64
+		err = queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			terminal, err := tx.GetWorkflowStateByKind(r.Context(), database.GetWorkflowStateByKindParams{
+				ListID:      id,
+				Kind:        stateKindTerminal,
+				WorkspaceID: user.WorkspaceID,
+			})
+			if err != nil {
+				return err
+			}
+
+			// todos already done with open blockers were forced there before
+			blockedBefore, err := tx.CountBlockedDoneTodosInList(r.Context(), database.CountBlockedDoneTodosInListParams{
+				ListID:      sql.NullInt64{Int64: id, Valid: true},
+				WorkspaceID: user.WorkspaceID,
+			})
+			if err != nil {
+				return err
+			}
+
+			updated, err = tx.MarkListTodosDone(r.Context(), database.MarkListTodosDoneParams{
+				StatusID:    sql.NullInt64{Int64: terminal.ID, Valid: true},
+				ListID:      sql.NullInt64{Int64: id, Valid: true},
+				WorkspaceID: user.WorkspaceID,
+			})
+			if err != nil {
+				return err
+			}
+
+			blockedAfter, err := tx.CountBlockedDoneTodosInList(r.Context(), database.CountBlockedDoneTodosInListParams{
+				ListID:      sql.NullInt64{Int64: id, Valid: true},
+				WorkspaceID: user.WorkspaceID,
+			})
+			if err != nil {
+				return err
+			}
+
+			if !force && blockedAfter > blockedBefore {
+				return fmt.Errorf("%w: %d todos in the list still have open blockers", errBlocked, blockedAfter-blockedBefore)
+			}
+
+			if !terminal.WipLimit.Valid {
+				return nil
+			}
+
+			count, err := tx.CountTodosInStatus(r.Context(), database.CountTodosInStatusParams{
+				StatusID:    sql.NullInt64{Int64: terminal.ID, Valid: true},
+				WorkspaceID: user.WorkspaceID,
+			})
+			if err != nil {
+				return err
+			}
+
+			if count > terminal.WipLimit.Int64 {
+				return fmt.Errorf("%w: %q can not hold %d todos, its limit is %d", errWorkflow, terminal.Name, count, terminal.WipLimit.Int64)
+			}
+			return nil
+		})
+
+		if errors.Is(err, errWorkflow) || errors.Is(err, errBlocked) {
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not mark list todos as done", "err", err)
+			apierror.Error(w, "could not mark list todos as done", http.StatusInternalServerError)
+			return
+		}
+
+		writeCount(w, logger, r, "Updated", updated)
+	})
+}
+
+func toNullInt64(v *int64) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *v, Valid: true}
+}
+
+// writeCount answers a bulk operation with the number of rows it touched.
+func writeCount(w http.ResponseWriter, logger gsdlogger.Logger, r *http.Request, key string, count int64) {
+	writeJson(w, logger, r, http.StatusOK, map[string]int64{key: count})
+}
+
+func writeJson(w http.ResponseWriter, logger gsdlogger.Logger, r *http.Request, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "could not marshal response", "err", err)
+		apierror.Error(w, "could not marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,593 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// roles a user can have in a list. Owners manage the list, its workflow and
+// its members, editors change its todos, and commenters and viewers can only
+// read them. Comments do not exist yet, so commenters are viewers for now.
+const (
+	roleOwner     = "owner"
+	roleEditor    = "editor"
+	roleCommenter = "commenter"
+	roleViewer    = "viewer"
+)
+
+// editRoles are the roles allowed to change the todos of a list.
+var editRoles = []string{roleOwner, roleEditor}
+
+const invitationTTL = 7 * 24 * time.Hour
+
+// errForbidden is wrapped by every error caused by a change the caller's
+// role in a list does not allow. Handlers answer those with 403 Forbidden.
+var errForbidden = errors.New("forbidden")
+
+// errLastOwner is returned when a change would leave a list without owners.
+var errLastOwner = errors.New("a list needs at least one owner")
+
+// member is a user of a list together with their role in it.
+type member struct {
+	UserID    int64
+	Name      string
+	Role      string
+	CreatedAt sql.NullTime
+}
+
+// invitation is what clients get to see of a stored invitation, which leaves
+// out its token hash.
+type invitation struct {
+	ID        int64
+	ListID    int64
+	Role      string
+	ExpiresAt time.Time
+	CreatedAt sql.NullTime
+}
+
+// sharedList is a list together with the caller's role in it.
+type sharedList struct {
+	database.List
+	Role string
+}
+
+// checkListRole makes sure the user has one of roles in a list, or any role
+// when roles is empty. Lists the user is not a member of are reported as
+// sql.ErrNoRows, so they can not be told apart from lists that do not exist.
+// No list stands for the user's own todos, where everything is allowed.
+func checkListRole(ctx context.Context, queries *database.Queries, user database.User, listID sql.NullInt64, roles ...string) error {
+	if !listID.Valid {
+		return nil
+	}
+
+	found, err := queries.GetListMember(ctx, database.GetListMemberParams{
+		ListID:      listID.Int64,
+		UserID:      user.ID,
+		WorkspaceID: user.WorkspaceID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(roles) > 0 && !slices.Contains(roles, found.Role) {
+		return fmt.Errorf("%w: a %s of list %d can not do this", errForbidden, found.Role, listID.Int64)
+	}
+	return nil
+}
+
+// listRoles returns the role the user has in each of their lists by list id.
+func listRoles(ctx context.Context, queries *database.Queries, userID int64) (map[int64]string, error) {
+	memberships, err := queries.ListUserMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[int64]string, len(memberships))
+	for _, membership := range memberships {
+		roles[membership.ListID] = membership.Role
+	}
+	return roles, nil
+}
+
+// writeForbidden answers a change the caller's role does not allow.
+func writeForbidden(w http.ResponseWriter, logger gsdlogger.Logger, r *http.Request, err error) {
+	logger.DebugContext(r.Context(), "role does not allow this", "err", err)
+	apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, err.Error())
+}
+
+// HandleListMembers lists the members of a list to any of its members.
+func HandleListMembers(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		err = checkListRole(r.Context(), queries, user, sql.NullInt64{Int64: id, Valid: true})
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "list not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		rows, err := queries.ListListMembers(r.Context(), database.ListListMembersParams{ListID: id, WorkspaceID: user.WorkspaceID})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list members from db", "err", err)
+			apierror.Error(w, "could not get list members from db", http.StatusInternalServerError)
+			return
+		}
+
+		members := make([]member, len(rows))
+		for i, row := range rows {
+			members[i] = member{UserID: row.UserID, Name: row.Name, Role: row.Role, CreatedAt: row.CreatedAt}
+		}
+
+		writeJson(w, logger, r, http.StatusOK, members)
+	})
+}
+
+// HandlePutMember changes the role of a member of a list. Only owners can do
+// it, and the last owner can not step down.
+func HandlePutMember(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := strconv.ParseInt(r.PathValue("userId"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse user id", "err", err)
+			apierror.Error(w, "could not parse user id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		var memberParams struct {
+			Role string `validate:"oneof=owner editor commenter viewer"`
+		}
+
+		if !decodeBody(w, logger, r, &memberParams, "member") {
+			return
+		}
+
+		if err := validate.Struct(memberParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "changing member role", "list", id, "user", userID, "role", memberParams.Role)
+
+		var updated member
+		err = queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			err := checkListRole(r.Context(), tx, user, sql.NullInt64{Int64: id, Valid: true}, roleOwner)
+			if err != nil {
+				return err
+			}
+
+			target, err := tx.GetListMember(r.Context(), database.GetListMemberParams{
+				ListID:      id,
+				UserID:      userID,
+				WorkspaceID: user.WorkspaceID,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				return errMemberNotFound
+			}
+			if err != nil {
+				return err
+			}
+
+			if target.Role == roleOwner && memberParams.Role != roleOwner {
+				if err := checkOtherOwners(r.Context(), tx, user.WorkspaceID, id); err != nil {
+					return err
+				}
+			}
+
+			stored, err := tx.UpdateListMemberRole(r.Context(), database.UpdateListMemberRoleParams{
+				Role:        memberParams.Role,
+				ListID:      id,
+				UserID:      userID,
+				WorkspaceID: user.WorkspaceID,
+			})
+			if err != nil {
+				return err
+			}
+
+			found, err := tx.GetUser(r.Context(), userID)
+			if err != nil {
+				return err
+			}
+
+			updated = member{UserID: found.ID, Name: found.Name, Role: stored.Role, CreatedAt: stored.CreatedAt}
+			return nil
+		})
+
+		if !writeMemberError(w, logger, r, err, "could not change member role") {
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusOK, updated)
+	})
+}
+
+// HandleDeleteMember removes a member from a list. Owners can remove anyone
+// and every member can remove themselves, which is how a list is left.
+func HandleDeleteMember(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := strconv.ParseInt(r.PathValue("userId"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse user id", "err", err)
+			apierror.Error(w, "could not parse user id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		logger.DebugContext(r.Context(), "removing member", "list", id, "user", userID)
+		err = queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			var roles []string
+			if userID != user.ID {
+				roles = []string{roleOwner}
+			}
+
+			err := checkListRole(r.Context(), tx, user, sql.NullInt64{Int64: id, Valid: true}, roles...)
+			if err != nil {
+				return err
+			}
+
+			target, err := tx.GetListMember(r.Context(), database.GetListMemberParams{
+				ListID:      id,
+				UserID:      userID,
+				WorkspaceID: user.WorkspaceID,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				return errMemberNotFound
+			}
+			if err != nil {
+				return err
+			}
+
+			if target.Role == roleOwner {
+				if err := checkOtherOwners(r.Context(), tx, user.WorkspaceID, id); err != nil {
+					return err
+				}
+			}
+
+			// the member's devices drop the todos of the list on their next sync.
+			err = tx.CreateMemberTodoTombstones(r.Context(), database.CreateMemberTodoTombstonesParams{ListID: id, UserID: userID})
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.DeleteListMember(r.Context(), database.DeleteListMemberParams{
+				ListID:      id,
+				UserID:      userID,
+				WorkspaceID: user.WorkspaceID,
+			})
+			return err
+		})
+
+		if !writeMemberError(w, logger, r, err, "could not remove member") {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// HandleCreateInvitation lets an owner invite someone to a list with a role.
+// The token is only part of this response and is handed to the invitee out of
+// band, who accepts or declines it.
+func HandleCreateInvitation(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		var invitationParams struct {
+			Role string `validate:"oneof=owner editor commenter viewer"`
+		}
+
+		if !decodeBody(w, logger, r, &invitationParams, "invitation") {
+			return
+		}
+
+		if err := validate.Struct(invitationParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token, hash, err := auth.NewInvitationToken()
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not generate invitation token", "err", err)
+			apierror.Error(w, "could not generate invitation token", http.StatusInternalServerError)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "creating invitation", "list", id, "role", invitationParams.Role)
+
+		var stored database.ListInvitation
+		err = queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			err := checkListRole(r.Context(), tx, user, sql.NullInt64{Int64: id, Valid: true}, roleOwner)
+			if err != nil {
+				return err
+			}
+
+			stored, err = tx.CreateListInvitation(r.Context(), database.CreateListInvitationParams{
+				ListID:    id,
+				InvitedBy: user.ID,
+				Role:      invitationParams.Role,
+				TokenHash: hash,
+				ExpiresAt: time.Now().Add(invitationTTL).UTC(),
+			})
+			return err
+		})
+
+		if !writeMemberError(w, logger, r, err, "could not create invitation") {
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusCreated, struct {
+			Token      string
+			Invitation invitation
+		}{Token: token, Invitation: toInvitation(stored)})
+	})
+}
+
+// HandleAcceptInvitation makes the caller a member of the list an invitation
+// is for, with the invitation's role. Invitations can only be used once.
+func HandleAcceptInvitation(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		token, ok := decodeInvitationToken(w, logger, r, validate)
+		if !ok {
+			return
+		}
+
+		var accepted sharedList
+		err := queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			found, err := invitationByToken(r.Context(), tx, user.WorkspaceID, token)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.GetListMember(r.Context(), database.GetListMemberParams{
+				ListID:      found.ListID,
+				UserID:      user.ID,
+				WorkspaceID: user.WorkspaceID,
+			})
+			if err == nil {
+				return errAlreadyMember
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			logger.DebugContext(r.Context(), "accepting invitation", "list", found.ListID, "role", found.Role)
+			_, err = tx.CreateListMember(r.Context(), database.CreateListMemberParams{
+				ListID: found.ListID,
+				UserID: user.ID,
+				Role:   found.Role,
+			})
+			if err != nil {
+				return err
+			}
+
+			// the todos of the list are new to the member's devices.
+			err = tx.CreateMemberTodoChanges(r.Context(), database.CreateMemberTodoChangesParams{ListID: found.ListID, UserID: user.ID})
+			if err != nil {
+				return err
+			}
+
+			if err := tx.DeleteListInvitation(r.Context(), found.ID); err != nil {
+				return err
+			}
+
+			list, err := tx.GetList(r.Context(), database.GetListParams{ID: found.ListID, WorkspaceID: user.WorkspaceID})
+			accepted = sharedList{List: list, Role: found.Role}
+			return err
+		})
+
+		if !writeMemberError(w, logger, r, err, "could not accept invitation") {
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusOK, accepted)
+	})
+}
+
+// HandleDeclineInvitation throws an invitation away without joining the list.
+func HandleDeclineInvitation(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		token, ok := decodeInvitationToken(w, logger, r, validate)
+		if !ok {
+			return
+		}
+
+		err := queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			found, err := invitationByToken(r.Context(), tx, user.WorkspaceID, token)
+			if err != nil {
+				return err
+			}
+
+			logger.DebugContext(r.Context(), "declining invitation", "list", found.ListID)
+			return tx.DeleteListInvitation(r.Context(), found.ID)
+		})
+
+		if !writeMemberError(w, logger, r, err, "could not decline invitation") {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+var (
+	errMemberNotFound     = errors.New("member not found")
+	errInvitationNotFound = errors.New("invitation not found")
+	errAlreadyMember      = errors.New("already a member of the list")
+)
+
+// writeMemberError answers the errors of the membership endpoints and
+// reports whether err was nil, so the handler can go on.
+func writeMemberError(w http.ResponseWriter, logger gsdlogger.Logger, r *http.Request, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errForbidden):
+		writeForbidden(w, logger, r, err)
+	case errors.Is(err, sql.ErrNoRows):
+		apierror.Error(w, "list not found", http.StatusNotFound)
+	case errors.Is(err, errMemberNotFound), errors.Is(err, errInvitationNotFound):
+		apierror.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errLastOwner), errors.Is(err, errAlreadyMember):
+		logger.DebugContext(r.Context(), message, "err", err)
+		apierror.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logger.ErrorContext(r.Context(), message, "err", err)
+		apierror.Error(w, message, http.StatusInternalServerError)
+	}
+	return false
+}
+
+// checkOtherOwners fails with errLastOwner when a list has a single owner,
+// which is about to stop being one.
+func checkOtherOwners(ctx context.Context, queries *database.Queries, workspaceID, listID int64) error {
+	owners, err := queries.CountListOwners(ctx, database.CountListOwnersParams{ListID: listID, WorkspaceID: workspaceID})
+	if err != nil {
+		return err
+	}
+
+	if owners <= 1 {
+		return errLastOwner
+	}
+	return nil
+}
+
+func decodeInvitationToken(
+	w http.ResponseWriter,
+	logger gsdlogger.Logger,
+	r *http.Request,
+	validate *validator.Validate,
+) (string, bool) {
+	var tokenParams struct {
+		Token string `validate:"min=1,max=255"`
+	}
+
+	if !decodeBody(w, logger, r, &tokenParams, "invitation token") {
+		return "", false
+	}
+
+	if err := validate.Struct(tokenParams); err != nil {
+		logger.DebugContext(r.Context(), "validation fail", "err", err)
+		formattedError := fmt.Errorf("validation fail: %w", err)
+		apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+		return "", false
+	}
+
+	return tokenParams.Token, true
+}
+
+// invitationByToken finds the invitation a token belongs to among the lists
+// of workspaceID, throwing away the expired ones first.
+func invitationByToken(ctx context.Context, queries *database.Queries, workspaceID int64, token string) (database.ListInvitation, error) {
+	if err := queries.DeleteExpiredListInvitations(ctx, time.Now().UTC()); err != nil {
+		return database.ListInvitation{}, err
+	}
+
+	found, err := queries.GetListInvitationByTokenHash(ctx, database.GetListInvitationByTokenHashParams{
+		TokenHash:   auth.HashInvitationToken(token),
+		WorkspaceID: workspaceID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return found, errInvitationNotFound
+	}
+	return found, err
+}
+
+func toInvitation(stored database.ListInvitation) invitation {
+	return invitation{
+		ID:        stored.ID,
+		ListID:    stored.ListID,
+		Role:      stored.Role,
+		ExpiresAt: stored.ExpiresAt,
+		CreatedAt: stored.CreatedAt,
+	}
+}
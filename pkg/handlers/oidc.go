@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// HandleOIDCLogin sends the browser to the provider, binding the login to it
+// with a cookie.
+func HandleOIDCLogin(logger gsdlogger.Logger, provider *auth.OIDCProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, authURL, err := provider.Begin()
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not start oidc login", "err", err)
+			apierror.Error(w, "could not start oidc login", http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     auth.OIDCStateCookie,
+			Value:    state,
+			Path:     "/",
+			MaxAge:   600,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// HandleOIDCCallback finishes a login, starts a session for the local user
+// linked to the subject of the ID token, creating that user on its first
+// login, and sends the browser on to the post login URL. New users are named
+// after the preferred username, the local part of the email or the subject.
+func HandleOIDCCallback(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	provider *auth.OIDCProvider,
+	sessions *auth.Sessions,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var boundState string
+		if cookie, err := r.Cookie(auth.OIDCStateCookie); err == nil {
+			boundState = cookie.Value
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     auth.OIDCStateCookie,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		claims, err := provider.Finish(r.Context(), boundState, r.URL.Query())
+		if errors.Is(err, auth.ErrOIDCLogin) || errors.Is(err, auth.ErrInvalidCredentials) {
+			logger.DebugContext(r.Context(), "oidc login failed", "err", err)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthenticated, err.Error())
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not finish oidc login", "err", err)
+			apierror.Error(w, "could not finish oidc login", http.StatusBadGateway)
+			return
+		}
+
+		ws, ok := requestWorkspace(w, logger, r)
+		if !ok {
+			return
+		}
+
+		localPart, _, _ := strings.Cut(claims.Email, "@")
+		found, err := auth.LinkedUser(
+			r.Context(),
+			queries,
+			ws.ID,
+			claims.Issuer,
+			claims.Subject,
+			claims.PreferredUsername,
+			localPart,
+			claims.Subject,
+		)
+
+		if errors.Is(err, auth.ErrNoFreeName) {
+			logger.DebugContext(r.Context(), "could not create oidc user", "err", err)
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get oidc user from db", "err", err)
+			apierror.Error(w, "could not get oidc user from db", http.StatusInternalServerError)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "oidc login", "user", found.ID, "subject", claims.Subject)
+		if _, err := sessions.Start(r.Context(), w, r, found.ID); err != nil {
+			logger.ErrorContext(r.Context(), "could not start session", "err", err)
+			apierror.Error(w, "could not start session", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, provider.PostLoginURL(), http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/rank"
+)
+
+// errBadAnchor is returned by moveTodo when the anchors can not be used to
+// place the todo.
+var errBadAnchor = errors.New("bad anchor")
+
+// HandleMoveTodo places a todo right before or right after another todo,
+// moving it into the anchor's list if needed. Only the moved todo is written
+// unless its list has to be spread out again.
+func HandleMoveTodo(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		var moveParams struct {
+			Before *int64 `validate:"required_without=After"`
+			After  *int64 `validate:"required_without=Before"`
+		}
+
+		if !decodeBody(w, logger, r, &moveParams, "move") {
+			return
+		}
+
+		if err := validate.Struct(moveParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "moving todo", "id", id, "requestParams", moveParams)
+
+		var todo database.Todo
+		err = queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			todo, err = moveTodo(r.Context(), tx, user, id, moveParams.Before, moveParams.After)
+			return err
+		})
+
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "todo not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, errBadAnchor) {
+			logger.DebugContext(r.Context(), "could not move todo", "err", err)
+			apierror.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if errors.Is(err, errWorkflow) {
+			logger.DebugContext(r.Context(), "could not move todo", "err", err)
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not move todo", "err", err)
+			apierror.Error(w, "could not move todo in database", http.StatusInternalServerError)
+			return
+		}
+
+		todoJson, err := json.Marshal(todo)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not marshal todo", "err", err)
+			apierror.Error(w, "could not marshal todo", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(todoJson)
+	})
+}
+
+// HandleListListTodos lists the todos of a list in their manual order.
+func HandleListListTodos(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		err = checkListRole(r.Context(), queries, user, sql.NullInt64{Int64: id, Valid: true})
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "list not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		todos, err := queries.ListTodosInList(r.Context(), database.ListTodosInListParams{
+			UserID: user.ID,
+			ListID: sql.NullInt64{Int64: id, Valid: true},
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todos from db", "err", err)
+			apierror.Error(w, "could not get todos from db", http.StatusInternalServerError)
+			return
+		}
+
+		if todos == nil {
+			todos = []database.Todo{}
+		}
+
+		todosJson, err := json.Marshal(todos)
+		if err != nil {
+			apierror.Error(w, "could not marshal todos", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(todosJson)
+	})
+}
+
+func moveTodo(ctx context.Context, queries *database.Queries, user database.User, id int64, before, after *int64) (database.Todo, error) {
+	todo, err := queries.GetTodo(ctx, database.GetTodoParams{ID: id, UserID: user.ID})
+	if err != nil {
+		return todo, err
+	}
+
+	if err := checkListRole(ctx, queries, user, todo.ListID, editRoles...); err != nil {
+		return todo, err
+	}
+
+	anchors := make([]database.Todo, 0, 2)
+	for _, anchorID := range []*int64{after, before} {
+		if anchorID == nil {
+			continue
+		}
+
+		if *anchorID == id {
+			return todo, fmt.Errorf("%w: a todo can not be moved next to itself", errBadAnchor)
+		}
+
+		anchor, err := queries.GetTodo(ctx, database.GetTodoParams{ID: *anchorID, UserID: user.ID})
+		if errors.Is(err, sql.ErrNoRows) {
+			return todo, fmt.Errorf("%w: todo %d not found", errBadAnchor, *anchorID)
+		}
+		if err != nil {
+			return todo, err
+		}
+
+		anchors = append(anchors, anchor)
+	}
+
+	listID := anchors[0].ListID
+	if len(anchors) == 2 && anchors[1].ListID != listID {
+		return todo, fmt.Errorf("%w: before and after are in different lists", errBadAnchor)
+	}
+
+	if listID != todo.ListID {
+		if err := checkListRole(ctx, queries, user, listID, editRoles...); err != nil {
+			return todo, err
+		}
+	}
+
+	position, err := positionNextTo(ctx, queries, user.ID, id, listID, before, after)
+	if err != nil {
+		return todo, err
+	}
+
+	if len(position) > rank.MaxLength {
+		if err := rebalanceList(ctx, queries, user.ID, listID); err != nil {
+			return todo, err
+		}
+
+		position, err = positionNextTo(ctx, queries, user.ID, id, listID, before, after)
+		if err != nil {
+			return todo, err
+		}
+	}
+
+	if listID == todo.ListID {
+		return queries.SetTodoPosition(ctx, database.SetTodoPositionParams{
+			ListID:   listID,
+			Position: position,
+			ID:       id,
+			UserID:   user.ID,
+		})
+	}
+
+	// the todo enters another workflow and has to pick a state in it
+	statusID, done, err := resolveStatus(ctx, queries, user.WorkspaceID, &todo, listID, todo.Done)
+	if err != nil {
+		return todo, err
+	}
+
+	_, err = queries.SetTodoPosition(ctx, database.SetTodoPositionParams{
+		ListID:   listID,
+		Position: position,
+		ID:       id,
+		UserID:   user.ID,
+	})
+	if err != nil {
+		return todo, err
+	}
+
+	return queries.SetTodoStatus(ctx, database.SetTodoStatusParams{
+		StatusID: statusID,
+		Done:     done,
+		ID:       id,
+		UserID:   user.ID,
+	})
+}
+
+// positionNextTo finds the neighbours of the anchors, ignoring the todo being
+// moved, and returns a position between them.
+func positionNextTo(
+	ctx context.Context,
+	queries *database.Queries,
+	userID, id int64,
+	listID sql.NullInt64,
+	before, after *int64,
+) (string, error) {
+	var lo, hi string
+
+	if after != nil {
+		anchor, err := queries.GetTodo(ctx, database.GetTodoParams{ID: *after, UserID: userID})
+		if err != nil {
+			return "", err
+		}
+		lo = anchor.Position
+	}
+
+	if before != nil {
+		anchor, err := queries.GetTodo(ctx, database.GetTodoParams{ID: *before, UserID: userID})
+		if err != nil {
+			return "", err
+		}
+		hi = anchor.Position
+	}
+
+	var err error
+	switch {
+	case before == nil:
+		hi, err = queries.GetTodoPositionAfter(ctx, database.GetTodoPositionAfterParams{
+			UserID:   userID,
+			ListID:   listID,
+			Position: lo,
+			ID:       id,
+		})
+	case after == nil:
+		lo, err = queries.GetTodoPositionBefore(ctx, database.GetTodoPositionBeforeParams{
+			UserID:   userID,
+			ListID:   listID,
+			Position: hi,
+			ID:       id,
+		})
+	case lo > hi:
+		return "", fmt.Errorf("%w: after must come before before", errBadAnchor)
+	}
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	if lo != "" && lo == hi {
+		// two todos were appended at the same time and share a position,
+		// spread the list so they can be told apart again.
+		if err := rebalanceList(ctx, queries, userID, listID); err != nil {
+			return "", err
+		}
+		return positionNextTo(ctx, queries, userID, id, listID, before, after)
+	}
+
+	return rank.Between(lo, hi)
+}
+
+// endOfList returns a position after every todo in the list, or after every
+// todo the user has outside of lists when listID is null.
+func endOfList(ctx context.Context, queries *database.Queries, userID int64, listID sql.NullInt64) (string, error) {
+	last, err := queries.GetLastTodoPosition(ctx, database.GetLastTodoPositionParams{
+		UserID: userID,
+		ListID: listID,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("could not get last position: %w", err)
+	}
+
+	position, err := rank.After(last)
+	if err != nil {
+		return "", err
+	}
+
+	if len(position) <= rank.MaxLength {
+		return position, nil
+	}
+
+	if err := rebalanceList(ctx, queries, userID, listID); err != nil {
+		return "", err
+	}
+
+	return endOfList(ctx, queries, userID, listID)
+}
+
+// rebalanceList gives every todo in the list a new, evenly
+// spaced position while keeping their order. Positions only grow when todos
+// are squeezed between close neighbours, so this is rarely needed.
+func rebalanceList(ctx context.Context, queries *database.Queries, userID int64, listID sql.NullInt64) error {
+	todos, err := queries.ListTodosInList(ctx, database.ListTodosInListParams{
+		UserID: userID,
+		ListID: listID,
+	})
+	if err != nil {
+		return fmt.Errorf("could not list todos to rebalance: %w", err)
+	}
+
+	for i, position := range rank.Spread(len(todos)) {
+		_, err := queries.SetTodoPosition(ctx, database.SetTodoPositionParams{
+			ListID:   listID,
+			Position: position,
+			ID:       todos[i].ID,
+			UserID:   userID,
+		})
+		if err != nil {
+			return fmt.Errorf("could not rebalance todo %d: %w", todos[i].ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// errNameTaken is returned when registering a name another user already has.
+var errNameTaken = errors.New("name is already taken")
+
+// user is what clients get to see of a user, which leaves out its password
+// hash.
+type user struct {
+	ID        int64
+	Name      string
+	CreatedAt sql.NullTime
+}
+
+func toUser(u database.User) user {
+	return user{ID: u.ID, Name: u.Name, CreatedAt: u.CreatedAt}
+}
+
+func HandleRegister(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var registerParams struct {
+			Name     string `validate:"min=1,max=64"`
+			Password string `validate:"min=8,max=1024"`
+		}
+
+		if !decodeBody(w, logger, r, &registerParams, "user") {
+			return
+		}
+
+		if err := validate.Struct(registerParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ws, ok := requestWorkspace(w, logger, r)
+		if !ok {
+			return
+		}
+
+		hash, err := auth.HashPassword(registerParams.Password)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not hash password", "err", err)
+			apierror.Error(w, "could not hash password", http.StatusInternalServerError)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "registering user", "name", registerParams.Name, "workspace", ws.Slug)
+		var created database.User
+		err = queries.ExecTx(r.Context(), func(q *database.Queries) error {
+			_, err := q.GetUserByName(r.Context(), database.GetUserByNameParams{
+				WorkspaceID: ws.ID,
+				Name:        registerParams.Name,
+			})
+			if err == nil {
+				return errNameTaken
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			created, err = q.CreateUserWithPassword(r.Context(), database.CreateUserWithPasswordParams{
+				WorkspaceID:  ws.ID,
+				Name:         registerParams.Name,
+				PasswordHash: sql.NullString{String: hash, Valid: true},
+			})
+			return err
+		})
+
+		if errors.Is(err, errNameTaken) {
+			logger.DebugContext(r.Context(), "could not register user", "err", err)
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not save user in database", "err", err)
+			apierror.Error(w, "could not save user in database", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusCreated, toUser(created))
+	})
+}
+
+// HandleLogin starts a session for a user name and password in the
+// workspace of the request. Failed logins count against both the name and
+// the client address clientIP tells, and either being locked out by
+// throttle answers 429 until its window ends. clientIP must only trust the
+// proxies the server sits behind, or one client could lock out everyone
+// behind the same proxy.
+func HandleLogin(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+	sessions *auth.Sessions,
+	throttle *auth.LoginThrottle,
+	clientIP func(*http.Request) netip.Addr,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var loginParams struct {
+			Name     string `validate:"required"`
+			Password string `validate:"required"`
+		}
+
+		if !decodeBody(w, logger, r, &loginParams, "login") {
+			return
+		}
+
+		if err := validate.Struct(loginParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ws, ok := requestWorkspace(w, logger, r)
+		if !ok {
+			return
+		}
+
+		nameKey := "name:" + ws.Slug + ":" + strings.ToLower(loginParams.Name)
+		addrKey := "addr:" + clientIP(r).String()
+
+		if wait := throttle.Wait(nameKey, addrKey); wait > 0 {
+			logger.DebugContext(r.Context(), "login throttled", "name", loginParams.Name, "wait", wait)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			apierror.Write(w, http.StatusTooManyRequests, apierror.CodeRateLimited, "too many failed logins")
+			return
+		}
+
+		found, err := queries.GetUserByName(r.Context(), database.GetUserByNameParams{
+			WorkspaceID: ws.ID,
+			Name:        loginParams.Name,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logger.ErrorContext(r.Context(), "could not get user from db", "err", err)
+			apierror.Error(w, "could not get user from db", http.StatusInternalServerError)
+			return
+		}
+
+		matches, err := auth.VerifyPassword(found, loginParams.Password)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not verify password", "err", err)
+			apierror.Error(w, "could not verify password", http.StatusInternalServerError)
+			return
+		}
+
+		if !matches {
+			logger.DebugContext(r.Context(), "login failed", "name", loginParams.Name)
+			throttle.Fail(nameKey, addrKey)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthenticated, "invalid name or password")
+			return
+		}
+
+		throttle.Reset(nameKey)
+
+		session, err := sessions.Start(r.Context(), w, r, found.ID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not start session", "err", err)
+			apierror.Error(w, "could not start session", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusOK, struct {
+			User      user
+			CSRFToken string
+			ExpiresAt time.Time
+		}{User: toUser(found), CSRFToken: session.CsrfToken, ExpiresAt: session.ExpiresAt})
+	})
+}
+
+func HandleLogout(logger gsdlogger.Logger, sessions *auth.Sessions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := sessions.End(r.Context(), w, r); err != nil {
+			logger.ErrorContext(r.Context(), "could not end session", "err", err)
+			apierror.Error(w, "could not end session", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+const (
+	// syncStatusApplied means the change was written to the server.
+	syncStatusApplied = "applied"
+	// syncStatusConflict means the todo changed on the server after
+	// BaseVersion; the current server copy is returned so the client can
+	// resolve it and retry with the new version.
+	syncStatusConflict = "conflict"
+	// syncStatusDeleted means the todo no longer exists on the server.
+	syncStatusDeleted = "deleted"
+	// syncStatusRejected means the change can never be applied as sent, for
+	// example because it points at a list that does not exist or where the
+	// user may not edit todos.
+	syncStatusRejected = "rejected"
+)
+
+type syncChange struct {
+	Op string `validate:"oneof=create update delete"`
+	// ClientID lets the client match a created todo with its server ID.
+	ClientID    string `validate:"max=255"`
+	ID          int64  `validate:"required_unless=Op create"`
+	BaseVersion int64  `validate:"required_unless=Op create"`
+	Description string `validate:"required_unless=Op delete,max=255,ascii"`
+	Done        bool
+	ListID      *int64
+}
+
+type syncResult struct {
+	Op       string
+	ClientID string
+	ID       int64
+	Status   string
+	Todo     *database.Todo
+}
+
+type syncResponse struct {
+	// Seq is the sequence number of the last change in the user's workspace,
+	// which the client must send as Since on its next sync.
+	Seq     int64
+	Results []syncResult
+	// Todos holds the current state of every todo changed after Since.
+	Todos []database.Todo
+	// Deleted holds the ids of every todo deleted after Since, or moved out
+	// of the lists the user can see.
+	Deleted []int64
+}
+
+// HandleSync applies a batch of offline changes with version based conflict
+// detection and answers with every change the server saw after the client's
+// last sync.
+func HandleSync(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		var syncParams struct {
+			Since   int64        `validate:"min=0"`
+			Changes []syncChange `validate:"max=500,dive"`
+		}
+
+		if !decodeBody(w, logger, r, &syncParams, "sync") {
+			return
+		}
+
+		if err := validate.Struct(syncParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.DebugContext(
+			r.Context(), "syncing todos",
+			"since", syncParams.Since,
+			"changes", len(syncParams.Changes),
+		)
+
+		response := syncResponse{
+			Results: make([]syncResult, 0, len(syncParams.Changes)),
+			Todos:   []database.Todo{},
+			Deleted: []int64{},
+		}
+
+		err := queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			for _, change := range syncParams.Changes {
+				result, err := applySyncChange(r, tx, user, change)
+				if err != nil {
+					return err
+				}
+				response.Results = append(response.Results, result)
+			}
+
+			seq, err := tx.GetTodoChangeSeq(r.Context(), user.ID)
+			if err != nil {
+				return fmt.Errorf("could not get change sequence: %w", err)
+			}
+			response.Seq = seq
+
+			between := database.ListTodosChangedBetweenParams{
+				UserID: user.ID,
+				Since:  syncParams.Since,
+				Until:  seq,
+			}
+			todos, err := tx.ListTodosChangedBetween(r.Context(), between)
+			if err != nil {
+				return fmt.Errorf("could not list changed todos: %w", err)
+			}
+			response.Todos = append(response.Todos, todos...)
+
+			deleted, err := tx.ListTodoTombstonesBetween(
+				r.Context(),
+				database.ListTodoTombstonesBetweenParams(between),
+			)
+			if err != nil {
+				return fmt.Errorf("could not list deleted todos: %w", err)
+			}
+			response.Deleted = append(response.Deleted, deleted...)
+
+			return nil
+		})
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not sync todos", "err", err)
+			apierror.Error(w, "could not sync todos", http.StatusInternalServerError)
+			return
+		}
+
+		responseJson, err := json.Marshal(response)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not marshal sync response", "err", err)
+			apierror.Error(w, "could not marshal sync response", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseJson)
+	})
+}
+
+func applySyncChange(r *http.Request, queries *database.Queries, user database.User, change syncChange) (syncResult, error) {
+	result := syncResult{Op: change.Op, ClientID: change.ClientID, ID: change.ID}
+
+	if change.Op != opDelete {
+		err := checkListRole(r.Context(), queries, user, toNullInt64(change.ListID), editRoles...)
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, errForbidden) {
+			result.Status = syncStatusRejected
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("could not get list: %w", err)
+		}
+	}
+
+	// changes to todos of lists the user may only read are never applied
+	if change.Op != opCreate {
+		current, err := queries.GetTodo(r.Context(), database.GetTodoParams{ID: change.ID, UserID: user.ID})
+		if err == nil {
+			err = checkListRole(r.Context(), queries, user, current.ListID, editRoles...)
+		}
+		if errors.Is(err, errForbidden) {
+			result.Status = syncStatusRejected
+			return result, nil
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return result, fmt.Errorf("could not get todo %d: %w", change.ID, err)
+		}
+	}
+
+	var position string
+	if change.Op != opDelete {
+		var err error
+		position, err = endOfList(r.Context(), queries, user.ID, toNullInt64(change.ListID))
+		if err != nil {
+			return result, err
+		}
+	}
+
+	switch change.Op {
+	case opCreate:
+		statusID, done, err := resolveStatus(r.Context(), queries, user.WorkspaceID, nil, toNullInt64(change.ListID), change.Done)
+		if errors.Is(err, errWorkflow) {
+			result.Status = syncStatusRejected
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+
+		todo, err := createTodo(r.Context(), queries, database.CreateTodoParams{
+			UserID:      user.ID,
+			Description: change.Description,
+			Done:        done,
+			ListID:      toNullInt64(change.ListID),
+			Position:    position,
+			StatusID:    statusID,
+		})
+		if errors.Is(err, errQuotaExceeded) {
+			result.Status = syncStatusRejected
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("could not create todo: %w", err)
+		}
+		result.ID = todo.ID
+		result.Status = syncStatusApplied
+		result.Todo = &todo
+		return result, nil
+
+	case opUpdate:
+		statusID, done := sql.NullInt64{}, change.Done
+		current, err := queries.GetTodo(r.Context(), database.GetTodoParams{ID: change.ID, UserID: user.ID})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return result, fmt.Errorf("could not get todo %d: %w", change.ID, err)
+		}
+
+		// the workflow is only checked against the version the client saw,
+		// anything else is answered as a conflict below.
+		if err == nil && current.Version == change.BaseVersion {
+			statusID, done, err = resolveStatus(r.Context(), queries, user.WorkspaceID, &current, toNullInt64(change.ListID), change.Done)
+			if err == nil {
+				err = checkBlockers(r.Context(), queries, current, done, false)
+			}
+			if errors.Is(err, errWorkflow) || errors.Is(err, errBlocked) {
+				result.Status = syncStatusRejected
+				return result, nil
+			}
+			if err != nil {
+				return result, err
+			}
+		}
+
+		todo, err := queries.UpdateTodoVersioned(r.Context(), database.UpdateTodoVersionedParams{
+			Description: change.Description,
+			Done:        done,
+			ListID:      toNullInt64(change.ListID),
+			EndPosition: position,
+			StatusID:    statusID,
+			ID:          change.ID,
+			UserID:      user.ID,
+			Version:     change.BaseVersion,
+		})
+		if err == nil {
+			result.Status = syncStatusApplied
+			result.Todo = &todo
+			return result, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return result, fmt.Errorf("could not update todo %d: %w", change.ID, err)
+		}
+
+	case opDelete:
+		deleted, err := queries.DeleteTodoVersioned(r.Context(), database.DeleteTodoVersionedParams{
+			ID:      change.ID,
+			UserID:  user.ID,
+			Version: change.BaseVersion,
+		})
+		if err != nil {
+			return result, fmt.Errorf("could not delete todo %d: %w", change.ID, err)
+		}
+		if deleted > 0 {
+			result.Status = syncStatusApplied
+			return result, nil
+		}
+	}
+
+	// nothing matched id and version, so either someone else changed the
+	// todo or it is already gone.
+	current, err := queries.GetTodo(r.Context(), database.GetTodoParams{ID: change.ID, UserID: user.ID})
+	if errors.Is(err, sql.ErrNoRows) {
+		result.Status = syncStatusDeleted
+		return result, nil
+	}
+	if err != nil {
+		return result, fmt.Errorf("could not get todo %d: %w", change.ID, err)
+	}
+
+	result.Status = syncStatusConflict
+	result.Todo = &current
+	return result, nil
+}
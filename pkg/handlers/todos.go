@@ -1,27 +1,78 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
 	"github.com/juancortelezzi/gogsd/pkg/database"
 	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
 )
 
+// operations accepted by the endpoints that change many todos at once.
+const (
+	opCreate = "create"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// sharedTodo is a todo together with the caller's role in it, which is their
+// role in the todo's list or owner for their todos outside of lists.
+type sharedTodo struct {
+	database.Todo
+	Role string
+}
+
+// HandleListTodos lists the todos of the user and the todos of every list
+// shared with them, ordered by list, position and id. The limit query
+// parameter pages through them, starting after the todo of the after cursor
+// or skipping offset todos, every todo is listed when limit is left out.
 func HandleListTodos(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		todos, err := queries.ListTodos(r.Context())
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		page, err := parsePage(r)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse page", "err", err)
+			apierror.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page.UserID = user.ID
+		todos, err := queries.ListTodosPage(r.Context(), page)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todos from db", "err", err)
+			apierror.Error(w, "could not get todos from db", http.StatusInternalServerError)
+			return
+		}
+
+		roles, err := listRoles(r.Context(), queries, user.ID)
 		if err != nil {
-			http.Error(w, "could not get todos from db", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "could not get list roles from db", "err", err)
+			apierror.Error(w, "could not get todos from db", http.StatusInternalServerError)
 			return
 		}
 
-		todosJson, err := json.Marshal(todos)
+		shared := make([]sharedTodo, len(todos))
+		for i, todo := range todos {
+			shared[i] = sharedTodo{Todo: todo, Role: roleOwner}
+			if todo.ListID.Valid {
+				shared[i].Role = roles[todo.ListID.Int64]
+			}
+		}
+
+		todosJson, err := json.Marshal(shared)
 		if err != nil {
-			http.Error(w, "could not marshal todos", http.StatusInternalServerError)
+			apierror.Error(w, "could not marshal todos", http.StatusInternalServerError)
 			return
 		}
 
@@ -31,46 +82,197 @@ func HandleListTodos(logger gsdlogger.Logger, queries *database.Queries) http.Ha
 	})
 }
 
+// parsePage returns the limit, offset and after query parameters of r. The
+// limit is -1 when there is none, which SQLite takes as no limit. The after
+// cursor is the list id, position and id of a todo separated by colons, with
+// no list id for todos outside of lists.
+func parsePage(r *http.Request) (database.ListTodosPageParams, error) {
+	query := r.URL.Query()
+	page := database.ListTodosPageParams{Limit: -1}
+	if param := query.Get("limit"); param != "" {
+		limit, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || limit < 1 {
+			return page, fmt.Errorf("limit must be a positive number, got %q", param)
+		}
+		page.Limit = limit
+	}
+	if param := query.Get("offset"); param != "" {
+		offset, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || offset < 0 {
+			return page, fmt.Errorf("offset must not be a negative number, got %q", param)
+		}
+		page.Offset = offset
+	}
+	if param := query.Get("after"); param != "" {
+		listID, position, id, err := parseCursor(param)
+		if err != nil {
+			return page, fmt.Errorf("after must be list_id:position:id, got %q", param)
+		}
+		page.AfterListID, page.AfterPosition, page.AfterID = listID, position, sql.NullInt64{Int64: id, Valid: true}
+	}
+	return page, nil
+}
+
+func parseCursor(cursor string) (listID sql.NullInt64, position string, id int64, err error) {
+	first, last := strings.Index(cursor, ":"), strings.LastIndex(cursor, ":")
+	if first == last {
+		return listID, "", 0, errors.New("cursor must have three parts")
+	}
+	if cursor[:first] != "" {
+		listID.Int64, err = strconv.ParseInt(cursor[:first], 10, 64)
+		if err != nil {
+			return listID, "", 0, err
+		}
+		listID.Valid = true
+	}
+	if id, err = strconv.ParseInt(cursor[last+1:], 10, 64); err != nil {
+		return listID, "", 0, err
+	}
+	return listID, cursor[first+1 : last], id, nil
+}
+
+// HandleGetTodo answers with a single todo the user can see, together with
+// their role in it.
+func HandleGetTodo(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		todo, err := queries.GetTodo(r.Context(), database.GetTodoParams{ID: id, UserID: user.ID})
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "todo not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todo", "err", err)
+			apierror.Error(w, "could not get todo from db", http.StatusInternalServerError)
+			return
+		}
+
+		shared := sharedTodo{Todo: todo, Role: roleOwner}
+		if todo.ListID.Valid {
+			roles, err := listRoles(r.Context(), queries, user.ID)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "could not get list roles from db", "err", err)
+				apierror.Error(w, "could not get todo from db", http.StatusInternalServerError)
+				return
+			}
+			shared.Role = roles[todo.ListID.Int64]
+		}
+
+		todoJson, err := json.Marshal(shared)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not marshal todo", "err", err)
+			apierror.Error(w, "could not marshal todo", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(todoJson)
+	})
+}
+
 func HandleCreateTodo(
 	logger gsdlogger.Logger,
 	queries *database.Queries,
 	validate *validator.Validate,
 ) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
 
 		var todoParams struct {
 			Description string `validate:"min=1,max=255,ascii"`
 			Done        bool
+			ListID      *int64
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&todoParams); err != nil {
-			http.Error(w, "could not decode todo from body", http.StatusBadRequest)
+		if !decodeBody(w, logger, r, &todoParams, "todo") {
 			return
 		}
 
 		if err := validate.Struct(todoParams); err != nil {
 			logger.DebugContext(r.Context(), "validation fail", "err", err)
 			formattedError := fmt.Errorf("validation fail: %w", err)
-			http.Error(w, formattedError.Error(), http.StatusBadRequest)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := checkListRole(r.Context(), queries, user, toNullInt64(todoParams.ListID), editRoles...)
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "list not found", http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		position, err := endOfList(r.Context(), queries, user.ID, toNullInt64(todoParams.ListID))
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get position for todo", "err", err)
+			apierror.Error(w, "could not save todo in database", http.StatusInternalServerError)
+			return
+		}
+
+		statusID, done, err := resolveStatus(r.Context(), queries, user.WorkspaceID, nil, toNullInt64(todoParams.ListID), todoParams.Done)
+		if errors.Is(err, errWorkflow) {
+			logger.DebugContext(r.Context(), "workflow rejected todo", "err", err)
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get status for todo", "err", err)
+			apierror.Error(w, "could not save todo in database", http.StatusInternalServerError)
 			return
 		}
 
 		logger.DebugContext(r.Context(), "creating todo", "requestParams", todoParams)
-		todo, err := queries.CreateTodo(r.Context(), database.CreateTodoParams{
+		todo, err := createTodo(r.Context(), queries, database.CreateTodoParams{
+			UserID:      user.ID,
 			Description: todoParams.Description,
-			Done:        todoParams.Done,
+			Done:        done,
+			ListID:      toNullInt64(todoParams.ListID),
+			Position:    position,
+			StatusID:    statusID,
 		})
 
+		if errors.Is(err, errQuotaExceeded) {
+			writeQuotaExceeded(w, logger, r, err)
+			return
+		}
+
 		if err != nil {
 			logger.ErrorContext(r.Context(), "could not save todo in database", "err", err)
-			http.Error(w, "could not save todo in database", http.StatusInternalServerError)
+			apierror.Error(w, "could not save todo in database", http.StatusInternalServerError)
 			return
 		}
 
 		todoJson, err := json.Marshal(todo)
 		if err != nil {
 			logger.ErrorContext(r.Context(), "could not marshal todo", "err", err)
-			http.Error(w, "could not marshal todo", http.StatusInternalServerError)
+			apierror.Error(w, "could not marshal todo", http.StatusInternalServerError)
 			return
 		}
 
@@ -89,52 +291,142 @@ func HandleUpdateTodo(
 		idParam := r.PathValue("id")
 		if idParam == "" {
 			logger.ErrorContext(r.Context(), "could not find id in path")
-			http.Error(w, "could not find id in path", http.StatusInternalServerError)
+			apierror.Error(w, "could not find id in path", http.StatusInternalServerError)
 			return
 		}
 
 		id, err := strconv.ParseInt(idParam, 10, 64)
 		if err != nil {
 			logger.DebugContext(r.Context(), "could not parse id", "err", err)
-			http.Error(w, "could not parse id", http.StatusBadRequest)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		force, err := parseForce(r)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse force", "err", err)
+			apierror.Error(w, "could not parse force", http.StatusBadRequest)
 			return
 		}
 
 		var todoParams struct {
 			Description string `validate:"min=1,max=255,ascii"`
 			Done        bool
+			ListID      *int64
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&todoParams); err != nil {
-			logger.DebugContext(r.Context(), "could not decode todo from body", "err", err)
-			http.Error(w, "could not decode todo from body", http.StatusBadRequest)
+		if !decodeBody(w, logger, r, &todoParams, "todo") {
 			return
 		}
 
 		if err := validate.Struct(todoParams); err != nil {
 			logger.DebugContext(r.Context(), "validation fail", "err", err)
 			formattedError := fmt.Errorf("validation fail: %w", err)
-			http.Error(w, formattedError.Error(), http.StatusBadRequest)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = checkListRole(r.Context(), queries, user, toNullInt64(todoParams.ListID), editRoles...)
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "list not found", http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		// only used when the todo moves to another list
+		endPosition, err := endOfList(r.Context(), queries, user.ID, toNullInt64(todoParams.ListID))
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get position for todo", "err", err)
+			apierror.Error(w, "could not update todo in database", http.StatusInternalServerError)
+			return
+		}
+
+		current, err := queries.GetTodo(r.Context(), database.GetTodoParams{ID: id, UserID: user.ID})
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "todo not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todo", "err", err)
+			apierror.Error(w, "could not update todo in database", http.StatusInternalServerError)
+			return
+		}
+
+		err = checkListRole(r.Context(), queries, user, current.ListID, editRoles...)
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not update todo in database", http.StatusInternalServerError)
+			return
+		}
+
+		statusID, done, err := resolveStatus(r.Context(), queries, user.WorkspaceID, &current, toNullInt64(todoParams.ListID), todoParams.Done)
+		if errors.Is(err, errWorkflow) {
+			logger.DebugContext(r.Context(), "workflow rejected todo", "err", err)
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get status for todo", "err", err)
+			apierror.Error(w, "could not update todo in database", http.StatusInternalServerError)
+			return
+		}
+
+		err = checkBlockers(r.Context(), queries, current, done, force)
+		if errors.Is(err, errBlocked) {
+			logger.DebugContext(r.Context(), "todo is blocked", "err", err)
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get blockers for todo", "err", err)
+			apierror.Error(w, "could not update todo in database", http.StatusInternalServerError)
 			return
 		}
 
 		logger.DebugContext(r.Context(), "updating todo", "requestParams", todoParams)
 		todo, err := queries.UpdateTodo(r.Context(), database.UpdateTodoParams{
 			Description: todoParams.Description,
-			Done:        todoParams.Done,
+			Done:        done,
+			ListID:      toNullInt64(todoParams.ListID),
+			EndPosition: endPosition,
+			StatusID:    statusID,
 			ID:          id,
+			UserID:      user.ID,
 		})
 
 		if err != nil {
 			logger.ErrorContext(r.Context(), "could not update todo in database", "err", err)
-			http.Error(w, "could not update todo in database", http.StatusInternalServerError)
+			apierror.Error(w, "could not update todo in database", http.StatusInternalServerError)
 			return
 		}
 
 		todoJson, err := json.Marshal(todo)
 		if err != nil {
 			logger.ErrorContext(r.Context(), "could not marshal todo", "err", err)
-			http.Error(w, "could not marshal todo", http.StatusInternalServerError)
+			apierror.Error(w, "could not marshal todo", http.StatusInternalServerError)
 			return
 		}
 
@@ -144,6 +436,90 @@ func HandleUpdateTodo(
 	})
 }
 
+// HandlePatchTodo updates only the fields present in the body, like an update
+// operation of a batch does.
+func HandlePatchTodo(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		force, err := parseForce(r)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse force", "err", err)
+			apierror.Error(w, "could not parse force", http.StatusBadRequest)
+			return
+		}
+
+		var todoParams struct {
+			Description *string
+			Done        *bool
+			ListID      *int64
+			Version     *int64
+		}
+
+		if !decodeBody(w, logger, r, &todoParams, "todo") {
+			return
+		}
+
+		logger.DebugContext(r.Context(), "patching todo", "requestParams", todoParams)
+		var result batchResult
+		err = queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			var err error
+			result, err = applyBatchOperation(r, tx, validate, user, batchOperation{
+				Op:          opUpdate,
+				ID:          id,
+				Description: todoParams.Description,
+				Done:        todoParams.Done,
+				ListID:      todoParams.ListID,
+				Version:     todoParams.Version,
+				Force:       force,
+			})
+			return err
+		})
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not patch todo", "err", err)
+			apierror.Error(w, "could not update todo in database", http.StatusInternalServerError)
+			return
+		}
+
+		if result.Status == http.StatusForbidden {
+			writeForbidden(w, logger, r, errors.New(result.Error))
+			return
+		}
+
+		if result.Status >= http.StatusBadRequest {
+			logger.DebugContext(r.Context(), "could not patch todo", "status", result.Status, "err", result.Error)
+			apierror.Error(w, result.Error, result.Status)
+			return
+		}
+
+		todoJson, err := json.Marshal(result.Todo)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not marshal todo", "err", err)
+			apierror.Error(w, "could not marshal todo", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(todoJson)
+	})
+}
+
 func HandleDeleteTodo(
 	logger gsdlogger.Logger,
 	queries *database.Queries,
@@ -153,24 +529,74 @@ func HandleDeleteTodo(
 		idParam := r.PathValue("id")
 		if idParam == "" {
 			logger.ErrorContext(r.Context(), "could not find id in path")
-			http.Error(w, "could not find id in path", http.StatusInternalServerError)
+			apierror.Error(w, "could not find id in path", http.StatusInternalServerError)
 			return
 		}
 
 		id, err := strconv.ParseInt(idParam, 10, 64)
 		if err != nil {
 			logger.DebugContext(r.Context(), "could not parse id", "err", err)
-			http.Error(w, "could not parse id", http.StatusBadRequest)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		current, err := queries.GetTodo(r.Context(), database.GetTodoParams{ID: id, UserID: user.ID})
+		if errors.Is(err, sql.ErrNoRows) {
+			// deleting a todo that is not there is not an error
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if err == nil {
+			err = checkListRole(r.Context(), queries, user, current.ListID, editRoles...)
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todo", "err", err)
+			apierror.Error(w, "could not delete todo in database", http.StatusInternalServerError)
 			return
 		}
 
 		logger.DebugContext(r.Context(), "deleting todo", "id", id)
-		if err := queries.DeleteTodo(r.Context(), id); err != nil {
+		err = queries.DeleteTodo(r.Context(), database.DeleteTodoParams{ID: id, UserID: user.ID})
+		if err != nil {
 			logger.ErrorContext(r.Context(), "could not delete todo", "err", err)
-			http.Error(w, "could not delete todo in database", http.StatusInternalServerError)
+			apierror.Error(w, "could not delete todo in database", http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 	})
 }
+
+// HandleDeleteCompletedTodos deletes every done todo the user can delete:
+// their own todos outside lists, and the todos of the lists they own or edit
+// whoever created them, as marking a list done does.
+func HandleDeleteCompletedTodos(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		logger.DebugContext(r.Context(), "deleting completed todos")
+		deleted, err := queries.DeleteCompletedTodos(r.Context(), user.ID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not delete completed todos", "err", err)
+			apierror.Error(w, "could not delete completed todos in database", http.StatusInternalServerError)
+			return
+		}
+
+		writeCount(w, logger, r, "Deleted", deleted)
+	})
+}
@@ -0,0 +1,633 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+const (
+	stateKindInitial  = "initial"
+	stateKindActive   = "active"
+	stateKindTerminal = "terminal"
+)
+
+// errWorkflow is wrapped by every error caused by a write that the list's
+// workflow does not allow. Handlers answer those with 409 Conflict.
+var errWorkflow = errors.New("workflow")
+
+type workflow struct {
+	States      []database.WorkflowState
+	Transitions []database.WorkflowTransition
+}
+
+type boardColumn struct {
+	State database.WorkflowState
+	Todos []database.Todo
+}
+
+func HandleGetWorkflow(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		err = checkListRole(r.Context(), queries, user, sql.NullInt64{Int64: id, Valid: true})
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "list not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		current, err := getWorkflow(r.Context(), queries, user.WorkspaceID, id)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get workflow", "err", err)
+			apierror.Error(w, "could not get workflow from db", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusOK, current)
+	})
+}
+
+// HandlePutWorkflow replaces the states and transitions of a list. States are
+// matched by name, so renaming a state is removing it and adding a new one,
+// which is only allowed once no todo is left in it. Only owners of the list
+// can change its workflow.
+func HandlePutWorkflow(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	type stateParams struct {
+		Name     string `validate:"min=1,max=64"`
+		Kind     string `validate:"oneof=initial active terminal"`
+		WipLimit *int64 `validate:"omitempty,min=1"`
+	}
+
+	type transitionParams struct {
+		From string `validate:"min=1,max=64"`
+		To   string `validate:"min=1,max=64,nefield=From"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		var workflowParams struct {
+			States      []stateParams      `validate:"min=2,max=32,dive"`
+			Transitions []transitionParams `validate:"max=1024,dive"`
+		}
+
+		if !decodeBody(w, logger, r, &workflowParams, "workflow") {
+			return
+		}
+
+		if err := validate.Struct(workflowParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		kinds := map[string]int{}
+		names := map[string]bool{}
+		for _, state := range workflowParams.States {
+			if names[state.Name] {
+				apierror.Error(w, fmt.Sprintf("validation fail: state %q is repeated", state.Name), http.StatusBadRequest)
+				return
+			}
+			names[state.Name] = true
+			kinds[state.Kind]++
+		}
+
+		if kinds[stateKindInitial] != 1 || kinds[stateKindTerminal] == 0 {
+			apierror.Error(w, "validation fail: a workflow needs exactly one initial state and at least one terminal state", http.StatusBadRequest)
+			return
+		}
+
+		for _, transition := range workflowParams.Transitions {
+			if !names[transition.From] || !names[transition.To] {
+				apierror.Error(w, fmt.Sprintf("validation fail: transition %q to %q uses an unknown state", transition.From, transition.To), http.StatusBadRequest)
+				return
+			}
+		}
+
+		err = checkListRole(r.Context(), queries, user, sql.NullInt64{Int64: id, Valid: true}, roleOwner)
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "list not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "replacing workflow", "list", id, "requestParams", workflowParams)
+
+		var updated workflow
+		err = queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			existing, err := tx.ListWorkflowStates(r.Context(), database.ListWorkflowStatesParams{
+				ListID:      id,
+				WorkspaceID: user.WorkspaceID,
+			})
+			if err != nil {
+				return err
+			}
+
+			byName := map[string]database.WorkflowState{}
+			for _, state := range existing {
+				if names[state.Name] {
+					byName[state.Name] = state
+					continue
+				}
+
+				count, err := tx.CountTodosInStatus(r.Context(), database.CountTodosInStatusParams{
+					StatusID:    sql.NullInt64{Int64: state.ID, Valid: true},
+					WorkspaceID: user.WorkspaceID,
+				})
+				if err != nil {
+					return err
+				}
+
+				if count > 0 {
+					return fmt.Errorf("%w: state %q still has %d todos", errWorkflow, state.Name, count)
+				}
+
+				err = tx.DeleteWorkflowState(r.Context(), database.DeleteWorkflowStateParams{
+					ID:          state.ID,
+					WorkspaceID: user.WorkspaceID,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			ids := map[string]int64{}
+			for i, params := range workflowParams.States {
+				state, found := byName[params.Name]
+				if !found {
+					state, err = tx.CreateWorkflowState(r.Context(), database.CreateWorkflowStateParams{
+						ListID:      id,
+						WorkspaceID: user.WorkspaceID,
+						Name:        params.Name,
+						Kind:        params.Kind,
+						Position:    int64(i),
+						WipLimit:    toNullInt64(params.WipLimit),
+					})
+					if err != nil {
+						return err
+					}
+					ids[state.Name] = state.ID
+					continue
+				}
+
+				_, err := tx.UpdateWorkflowState(r.Context(), database.UpdateWorkflowStateParams{
+					Kind:        params.Kind,
+					Position:    int64(i),
+					WipLimit:    toNullInt64(params.WipLimit),
+					ID:          state.ID,
+					WorkspaceID: user.WorkspaceID,
+				})
+				if err != nil {
+					return err
+				}
+
+				// the state may have become terminal or stopped being one
+				err = tx.SetStatusTodosDone(r.Context(), database.SetStatusTodosDoneParams{
+					Done:        params.Kind == stateKindTerminal,
+					StatusID:    sql.NullInt64{Int64: state.ID, Valid: true},
+					WorkspaceID: user.WorkspaceID,
+				})
+				if err != nil {
+					return err
+				}
+				ids[state.Name] = state.ID
+			}
+
+			err = tx.DeleteListWorkflowTransitions(r.Context(), database.DeleteListWorkflowTransitionsParams{
+				WorkspaceID: user.WorkspaceID,
+				ListID:      id,
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, transition := range workflowParams.Transitions {
+				err := tx.CreateWorkflowTransition(r.Context(), database.CreateWorkflowTransitionParams{
+					FromStateID: ids[transition.From],
+					ToStateID:   ids[transition.To],
+					WorkspaceID: user.WorkspaceID,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			updated, err = getWorkflow(r.Context(), tx, user.WorkspaceID, id)
+			return err
+		})
+
+		if errors.Is(err, errWorkflow) {
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not replace workflow", "err", err)
+			apierror.Error(w, "could not replace workflow in database", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusOK, updated)
+	})
+}
+
+// HandleGetBoard answers with one column per workflow state of a list, each
+// holding its todos in their manual order.
+func HandleGetBoard(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		err = checkListRole(r.Context(), queries, user, sql.NullInt64{Int64: id, Valid: true})
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "list not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list member", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		list, err := queries.GetList(r.Context(), database.GetListParams{ID: id, WorkspaceID: user.WorkspaceID})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get list", "err", err)
+			apierror.Error(w, "could not get list from db", http.StatusInternalServerError)
+			return
+		}
+
+		states, err := queries.ListWorkflowStates(r.Context(), database.ListWorkflowStatesParams{
+			ListID:      id,
+			WorkspaceID: user.WorkspaceID,
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get workflow states", "err", err)
+			apierror.Error(w, "could not get workflow states from db", http.StatusInternalServerError)
+			return
+		}
+
+		todos, err := queries.ListTodosInList(r.Context(), database.ListTodosInListParams{
+			UserID: user.ID,
+			ListID: sql.NullInt64{Int64: id, Valid: true},
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get todos from db", "err", err)
+			apierror.Error(w, "could not get todos from db", http.StatusInternalServerError)
+			return
+		}
+
+		columns := make([]boardColumn, len(states))
+		columnByState := map[int64]*boardColumn{}
+		for i, state := range states {
+			columns[i] = boardColumn{State: state, Todos: []database.Todo{}}
+			columnByState[state.ID] = &columns[i]
+		}
+
+		for _, todo := range todos {
+			if column, found := columnByState[todo.StatusID.Int64]; found {
+				column.Todos = append(column.Todos, todo)
+			}
+		}
+
+		writeJson(w, logger, r, http.StatusOK, struct {
+			List    database.List
+			Columns []boardColumn
+		}{List: list, Columns: columns})
+	})
+}
+
+// HandleTransitionTodo moves a todo to another state of its list's workflow.
+func HandleTransitionTodo(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse id", "err", err)
+			apierror.Error(w, "could not parse id", http.StatusBadRequest)
+			return
+		}
+
+		force, err := parseForce(r)
+		if err != nil {
+			logger.DebugContext(r.Context(), "could not parse force", "err", err)
+			apierror.Error(w, "could not parse force", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := requestUser(w, logger, r)
+		if !ok {
+			return
+		}
+
+		var transitionParams struct {
+			StatusID int64 `validate:"required"`
+		}
+
+		if !decodeBody(w, logger, r, &transitionParams, "transition") {
+			return
+		}
+
+		if err := validate.Struct(transitionParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "transitioning todo", "id", id, "status", transitionParams.StatusID)
+
+		var todo database.Todo
+		err = queries.ExecTx(r.Context(), func(tx *database.Queries) error {
+			todo, err = tx.GetTodo(r.Context(), database.GetTodoParams{ID: id, UserID: user.ID})
+			if err != nil {
+				return err
+			}
+
+			if !todo.ListID.Valid {
+				return fmt.Errorf("%w: todos outside of a list have no workflow", errWorkflow)
+			}
+
+			if err := checkListRole(r.Context(), tx, user, todo.ListID, editRoles...); err != nil {
+				return err
+			}
+
+			target, err := tx.GetWorkflowState(r.Context(), database.GetWorkflowStateParams{
+				ID:          transitionParams.StatusID,
+				WorkspaceID: user.WorkspaceID,
+			})
+			if errors.Is(err, sql.ErrNoRows) || (err == nil && target.ListID != todo.ListID.Int64) {
+				return fmt.Errorf("%w: status %d is not part of the todo's list", errWorkflow, transitionParams.StatusID)
+			}
+			if err != nil {
+				return err
+			}
+
+			if todo.StatusID.Valid && todo.StatusID.Int64 == target.ID {
+				return nil
+			}
+
+			if err := checkTransition(r.Context(), tx, todo, target); err != nil {
+				return err
+			}
+
+			if err := checkBlockers(r.Context(), tx, todo, target.Kind == stateKindTerminal, force); err != nil {
+				return err
+			}
+
+			todo, err = tx.SetTodoStatus(r.Context(), database.SetTodoStatusParams{
+				StatusID: sql.NullInt64{Int64: target.ID, Valid: true},
+				Done:     target.Kind == stateKindTerminal,
+				ID:       id,
+				UserID:   user.ID,
+			})
+			return err
+		})
+
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Error(w, "todo not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, errForbidden) {
+			writeForbidden(w, logger, r, err)
+			return
+		}
+
+		if errors.Is(err, errWorkflow) || errors.Is(err, errBlocked) {
+			logger.DebugContext(r.Context(), "transition rejected", "err", err)
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not transition todo", "err", err)
+			apierror.Error(w, "could not transition todo in database", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusOK, todo)
+	})
+}
+
+// resolveStatus picks the state of a todo written with a plain done flag, as
+// the todo endpoints do. current is nil for todos being created.
+//
+// Todos entering a list start in its initial state, or in its first terminal
+// state when they are already done. Flipping done on a todo that stays in its
+// list is a transition to one of those states and has to be allowed by the
+// workflow.
+func resolveStatus(
+	ctx context.Context,
+	queries *database.Queries,
+	workspaceID int64,
+	current *database.Todo,
+	listID sql.NullInt64,
+	done bool,
+) (sql.NullInt64, bool, error) {
+	if !listID.Valid {
+		return sql.NullInt64{}, done, nil
+	}
+
+	staying := current != nil && current.ListID == listID && current.StatusID.Valid
+	if staying && current.Done == done {
+		return current.StatusID, done, nil
+	}
+
+	kind := stateKindInitial
+	if done {
+		kind = stateKindTerminal
+	}
+
+	target, err := queries.GetWorkflowStateByKind(ctx, database.GetWorkflowStateByKindParams{
+		ListID:      listID.Int64,
+		Kind:        kind,
+		WorkspaceID: workspaceID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return sql.NullInt64{}, done, fmt.Errorf("%w: the list has no %s state", errWorkflow, kind)
+	}
+	if err != nil {
+		return sql.NullInt64{}, done, err
+	}
+
+	var todo database.Todo
+	if staying {
+		todo = *current
+	}
+
+	if err := checkTransition(ctx, queries, todo, target); err != nil {
+		return sql.NullInt64{}, done, err
+	}
+
+	return sql.NullInt64{Int64: target.ID, Valid: true}, done, nil
+}
+
+// checkTransition makes sure the workflow allows todo to move into target and
+// that target has room for it. A todo without a status is entering the list
+// and may start in any state.
+func checkTransition(ctx context.Context, queries *database.Queries, todo database.Todo, target database.WorkflowState) error {
+	if todo.StatusID.Valid {
+		allowed, err := queries.CountWorkflowTransitions(ctx, database.CountWorkflowTransitionsParams{
+			FromStateID: todo.StatusID.Int64,
+			ToStateID:   target.ID,
+			WorkspaceID: target.WorkspaceID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if allowed == 0 {
+			from, err := queries.GetWorkflowState(ctx, database.GetWorkflowStateParams{
+				ID:          todo.StatusID.Int64,
+				WorkspaceID: target.WorkspaceID,
+			})
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: moving from %q to %q is not allowed", errWorkflow, from.Name, target.Name)
+		}
+	}
+
+	if !target.WipLimit.Valid {
+		return nil
+	}
+
+	count, err := queries.CountTodosInStatus(ctx, database.CountTodosInStatusParams{
+		StatusID:    sql.NullInt64{Int64: target.ID, Valid: true},
+		WorkspaceID: target.WorkspaceID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if count >= target.WipLimit.Int64 {
+		return fmt.Errorf("%w: %q already holds its limit of %d todos", errWorkflow, target.Name, target.WipLimit.Int64)
+	}
+
+	return nil
+}
+
+// createDefaultWorkflow gives a new list the two state workflow that behaves
+// like the plain done flag.
+func createDefaultWorkflow(ctx context.Context, queries *database.Queries, list database.List) error {
+	states := make([]database.WorkflowState, 0, 2)
+	for i, params := range []struct{ name, kind string }{
+		{"Todo", stateKindInitial},
+		{"Done", stateKindTerminal},
+	} {
+		state, err := queries.CreateWorkflowState(ctx, database.CreateWorkflowStateParams{
+			ListID:      list.ID,
+			WorkspaceID: list.WorkspaceID,
+			Name:        params.name,
+			Kind:        params.kind,
+			Position:    int64(i),
+		})
+		if err != nil {
+			return err
+		}
+		states = append(states, state)
+	}
+
+	for _, transition := range [][2]database.WorkflowState{{states[0], states[1]}, {states[1], states[0]}} {
+		err := queries.CreateWorkflowTransition(ctx, database.CreateWorkflowTransitionParams{
+			FromStateID: transition[0].ID,
+			ToStateID:   transition[1].ID,
+			WorkspaceID: list.WorkspaceID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getWorkflow(ctx context.Context, queries *database.Queries, workspaceID, listID int64) (workflow, error) {
+	states, err := queries.ListWorkflowStates(ctx, database.ListWorkflowStatesParams{
+		ListID:      listID,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return workflow{}, err
+	}
+
+	transitions, err := queries.ListWorkflowTransitions(ctx, database.ListWorkflowTransitionsParams{
+		ListID:      listID,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return workflow{}, err
+	}
+
+	if states == nil {
+		states = []database.WorkflowState{}
+	}
+
+	if transitions == nil {
+		transitions = []database.WorkflowTransition{}
+	}
+
+	return workflow{States: states, Transitions: transitions}, nil
+}
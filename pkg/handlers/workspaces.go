@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+// errQuotaExceeded is returned when a workspace already holds as many todos
+// as it is allowed to.
+var errQuotaExceeded = errors.New("workspace todo quota exceeded")
+
+// errSlugTaken is returned when creating a workspace with the slug of
+// another.
+var errSlugTaken = errors.New("slug is already taken")
+
+// workspaceUsage is a workspace with how many todos it holds.
+type workspaceUsage struct {
+	database.Workspace
+	Todos int64
+}
+
+// createTodo creates a todo in the workspace of its user. The insert only
+// happens while the workspace is under its quota, so the check can not race
+// with other creates.
+func createTodo(ctx context.Context, queries *database.Queries, params database.CreateTodoParams) (database.Todo, error) {
+	todo, err := queries.CreateTodo(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo, errQuotaExceeded
+	}
+	return todo, err
+}
+
+func writeQuotaExceeded(w http.ResponseWriter, logger gsdlogger.Logger, r *http.Request, err error) {
+	logger.DebugContext(r.Context(), "workspace is full", "err", err)
+	apierror.Write(w, http.StatusForbidden, apierror.CodeQuotaExceeded, err.Error())
+}
+
+// requestInstanceAdmin returns the user of a request when it may manage
+// workspaces, which takes an admin of the default workspace that is not
+// linked to another issuer. Others are answered with 403.
+func requestInstanceAdmin(w http.ResponseWriter, logger gsdlogger.Logger, queries *database.Queries, r *http.Request) (database.User, bool) {
+	user, ok := requestUser(w, logger, r)
+	if !ok {
+		return user, false
+	}
+
+	if user.WorkspaceID != workspace.DefaultID {
+		writeForbidden(w, logger, r, fmt.Errorf("%w: only admins of the %s workspace manage workspaces", errForbidden, workspace.DefaultSlug))
+		return user, false
+	}
+
+	// users linked to another issuer were created on the fly for whoever it
+	// vouched for, which must not reach past their own workspace.
+	linked, err := queries.CountUserIdentities(r.Context(), user.ID)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "could not count user identities", "err", err)
+		apierror.Error(w, "could not get user identities from db", http.StatusInternalServerError)
+		return user, false
+	}
+
+	if linked > 0 {
+		writeForbidden(w, logger, r, fmt.Errorf("%w: users signing in through another issuer do not manage workspaces", errForbidden))
+		return user, false
+	}
+
+	return user, true
+}
+
+// HandleGetWorkspace answers with the workspace of the request and how many
+// todos it holds.
+func HandleGetWorkspace(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, ok := requestWorkspace(w, logger, r)
+		if !ok {
+			return
+		}
+
+		count, err := queries.CountWorkspaceTodos(r.Context(), ws.ID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not count workspace todos", "err", err)
+			apierror.Error(w, "could not count workspace todos", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusOK, workspaceUsage{Workspace: ws, Todos: count})
+	})
+}
+
+func HandleListWorkspaces(logger gsdlogger.Logger, queries *database.Queries) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requestInstanceAdmin(w, logger, queries, r); !ok {
+			return
+		}
+
+		workspaces, err := queries.ListWorkspaces(r.Context())
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not get workspaces", "err", err)
+			apierror.Error(w, "could not get workspaces from db", http.StatusInternalServerError)
+			return
+		}
+
+		if workspaces == nil {
+			workspaces = []database.Workspace{}
+		}
+
+		writeJson(w, logger, r, http.StatusOK, workspaces)
+	})
+}
+
+// HandleCreateWorkspace creates an empty workspace. Users join it by
+// registering or logging in through it.
+func HandleCreateWorkspace(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requestInstanceAdmin(w, logger, queries, r); !ok {
+			return
+		}
+
+		var workspaceParams struct {
+			Slug     string `validate:"min=1,max=63,hostname_rfc1123,lowercase,excludes=."`
+			Name     string `validate:"min=1,max=255"`
+			MaxTodos *int64 `validate:"omitnil,min=0"`
+		}
+
+		if !decodeBody(w, logger, r, &workspaceParams, "workspace") {
+			return
+		}
+
+		if err := validate.Struct(workspaceParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.DebugContext(r.Context(), "creating workspace", "slug", workspaceParams.Slug)
+		var created database.Workspace
+		err := queries.ExecTx(r.Context(), func(q *database.Queries) error {
+			_, err := q.GetWorkspaceBySlug(r.Context(), workspaceParams.Slug)
+			if err == nil {
+				return errSlugTaken
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			created, err = q.CreateWorkspace(r.Context(), database.CreateWorkspaceParams{
+				Slug:     workspaceParams.Slug,
+				Name:     workspaceParams.Name,
+				MaxTodos: toNullInt64(workspaceParams.MaxTodos),
+			})
+			return err
+		})
+
+		if errors.Is(err, errSlugTaken) {
+			logger.DebugContext(r.Context(), "could not create workspace", "err", err)
+			apierror.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not save workspace in database", "err", err)
+			apierror.Error(w, "could not save workspace in database", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusCreated, created)
+	})
+}
+
+// HandleUpdateWorkspace renames a workspace and sets its quota. Lowering the
+// quota below the todos a workspace holds keeps them, it only stops new ones.
+func HandleUpdateWorkspace(
+	logger gsdlogger.Logger,
+	queries *database.Queries,
+	validate *validator.Validate,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requestInstanceAdmin(w, logger, queries, r); !ok {
+			return
+		}
+
+		var workspaceParams struct {
+			Name     string `validate:"min=1,max=255"`
+			MaxTodos *int64 `validate:"omitnil,min=0"`
+		}
+
+		if !decodeBody(w, logger, r, &workspaceParams, "workspace") {
+			return
+		}
+
+		if err := validate.Struct(workspaceParams); err != nil {
+			logger.DebugContext(r.Context(), "validation fail", "err", err)
+			formattedError := fmt.Errorf("validation fail: %w", err)
+			apierror.Error(w, formattedError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		updated, err := queries.UpdateWorkspace(r.Context(), database.UpdateWorkspaceParams{
+			Name:     workspaceParams.Name,
+			MaxTodos: toNullInt64(workspaceParams.MaxTodos),
+			Slug:     r.PathValue("slug"),
+		})
+
+		if errors.Is(err, sql.ErrNoRows) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeWorkspaceNotFound, fmt.Sprintf("workspace %s not found", r.PathValue("slug")))
+			return
+		}
+
+		if err != nil {
+			logger.ErrorContext(r.Context(), "could not update workspace", "err", err)
+			apierror.Error(w, "could not update workspace in database", http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, logger, r, http.StatusOK, updated)
+	})
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package health
+
+import "context"
+
+// DiskSpace can not tell how much space is free on this platform, so it
+// always passes.
+func DiskSpace(dir string, minFree uint64) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return nil
+	})
+}
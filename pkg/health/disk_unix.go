@@ -0,0 +1,26 @@
+//go:build linux || darwin
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+)
+
+// DiskSpace checks that the file system holding dir has at least minFree
+// bytes available.
+func DiskSpace(dir string, minFree uint64) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(dir, &stat); err != nil {
+			return err
+		}
+
+		free := uint64(stat.Bavail) * uint64(stat.Bsize)
+		if free < minFree {
+			return fmt.Errorf("%d bytes free in %s, want at least %d", free, dir, minFree)
+		}
+		return nil
+	})
+}
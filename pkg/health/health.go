@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds how long a single checker may take before it counts
+// as failing.
+const checkTimeout = 2 * time.Second
+
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "draining"
+)
+
+// ErrDraining is what readiness reports once Drain was called.
+var ErrDraining = errors.New("server is shutting down")
+
+// Checker tells whether something the server depends on works.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Ping checks that db answers.
+func Ping(db *sql.DB) Checker {
+	return CheckerFunc(db.PingContext)
+}
+
+// Report is the body of probe responses.
+type Report struct {
+	Status string
+	Checks []Result
+}
+
+type Result struct {
+	Name   string
+	Status string
+	Error  string
+}
+
+type check struct {
+	name    string
+	checker Checker
+}
+
+// Probes answers liveness probes, failing when the process has to be
+// restarted, and readiness probes, failing while it should not be sent
+// traffic.
+type Probes struct {
+	liveness  []check
+	readiness []check
+	draining  atomic.Bool
+}
+
+func NewProbes() *Probes {
+	return &Probes{}
+}
+
+// AddLiveness adds a checker to liveness probes. Checkers are added before
+// the probes are served.
+func (p *Probes) AddLiveness(name string, checker Checker) {
+	p.liveness = append(p.liveness, check{name: name, checker: checker})
+}
+
+// AddReadiness adds a checker to readiness probes. Checkers are added
+// before the probes are served.
+func (p *Probes) AddReadiness(name string, checker Checker) {
+	p.readiness = append(p.readiness, check{name: name, checker: checker})
+}
+
+// Drain makes readiness probes fail from now on, so load balancers stop
+// sending traffic before the server stops accepting it.
+func (p *Probes) Drain() {
+	p.draining.Store(true)
+}
+
+func (p *Probes) HandleLiveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, run(r.Context(), p.liveness))
+	})
+}
+
+func (p *Probes) HandleReadiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := run(r.Context(), p.readiness)
+		if p.draining.Load() {
+			report.Status = StatusDraining
+			report.Checks = append(report.Checks, Result{Name: "shutdown", Status: StatusFailing, Error: ErrDraining.Error()})
+		}
+		writeReport(w, report)
+	})
+}
+
+// run runs checks concurrently, each with its own timeout.
+func run(ctx context.Context, checks []check) Report {
+	results := make([]Result, len(checks))
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			results[i] = Result{Name: c.name, Status: StatusOK}
+			if err := c.checker.Check(ctx); err != nil {
+				results[i].Status = StatusFailing
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+
+	return report
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,120 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// systemdFirstFD is the first file descriptor systemd passes sockets on.
+const systemdFirstFD = 3
+
+// Config says where and how the server listens.
+type Config struct {
+	// Address is the host:port to listen on over TCP.
+	Address string
+	// SocketPath, when set, makes the server listen on a unix domain socket
+	// with SocketMode permissions instead.
+	SocketPath string
+	SocketMode fs.FileMode
+	// Systemd is set when systemd passed a socket it listens on for the
+	// server, which then wins over Address and SocketPath.
+	Systemd bool
+	// TLS is nil for plain HTTP.
+	TLS *TLSConfig
+	// H2C serves HTTP/2 without TLS to clients asking for it. Over TLS
+	// HTTP/2 is always offered.
+	H2C bool
+}
+
+// Listen opens the listener config asks for.
+func Listen(config Config) (net.Listener, error) {
+	switch {
+	case config.Systemd:
+		file := os.NewFile(systemdFirstFD, "systemd")
+		defer file.Close()
+
+		l, err := net.FileListener(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not listen on the socket passed by systemd: %w", err)
+		}
+		return l, nil
+
+	case config.SocketPath != "":
+		// a socket left behind by a server that did not stop cleanly would
+		// make listening fail, anything else at the path is kept.
+		if info, err := os.Lstat(config.SocketPath); err == nil && info.Mode().Type() == fs.ModeSocket {
+			if err := os.Remove(config.SocketPath); err != nil {
+				return nil, err
+			}
+		}
+
+		l, err := net.Listen("unix", config.SocketPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.Chmod(config.SocketPath, config.SocketMode); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+
+	default:
+		return net.Listen("tcp", config.Address)
+	}
+}
+
+// Configure sets server up to serve what config asks for. The returned
+// certificates are nil without TLS.
+func Configure(server *http.Server, config Config) (*Certificates, error) {
+	if config.H2C {
+		server.Handler = h2c.NewHandler(server.Handler, &http2.Server{})
+	}
+
+	if config.TLS == nil {
+		return nil, nil
+	}
+
+	tlsConfig, certificates, err := config.TLS.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	server.TLSConfig = tlsConfig
+	return certificates, nil
+}
+
+// Serve serves server on l, over TLS when server has a TLS config.
+func Serve(server *http.Server, l net.Listener) error {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ServeTLS(l, "", "")
+	} else {
+		err = server.Serve(l)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Describe returns where l listens, for logging.
+func Describe(l net.Listener, config Config) string {
+	if l.Addr().Network() == "unix" {
+		return "unix:" + l.Addr().String()
+	}
+
+	scheme := "http"
+	if config.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + l.Addr().String()
+}
@@ -0,0 +1,118 @@
+package listener
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// checkEvery is how often handshakes look at whether the certificate files
+// changed.
+const checkEvery = time.Second
+
+// TLSConfig names the files TLS is served with.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, when set, makes clients authenticate with a certificate
+	// issued by one of its CAs.
+	ClientCAFile string
+	// ClientAuth is how much clients have to authenticate.
+	ClientAuth tls.ClientAuthType
+}
+
+// Load loads the files of c into a tls.Config serving the certificate
+// Certificates keeps up to date.
+func (c TLSConfig) Load() (*tls.Config, *Certificates, error) {
+	certificates := &Certificates{certFile: c.CertFile, keyFile: c.KeyFile}
+	if err := certificates.Reload(); err != nil {
+		return nil, nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certificates.GetCertificate,
+		ClientAuth:     c.ClientAuth,
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read client CAs: %w", err)
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("%s holds no certificates", c.ClientCAFile)
+		}
+	}
+
+	return config, certificates, nil
+}
+
+// Certificates serves the certificate in a pair of files, loading it again
+// once the files change. A pair that fails to load keeps the previous
+// certificate in use, as the files are often replaced one after the other.
+type Certificates struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modified    [2]time.Time
+	checked     time.Time
+}
+
+// Reload loads the files again whatever their modification time.
+func (c *Certificates) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modified, err := c.modTimes()
+	if err != nil {
+		return err
+	}
+	return c.load(modified)
+}
+
+func (c *Certificates) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) >= checkEvery {
+		c.checked = time.Now()
+		if modified, err := c.modTimes(); err == nil && modified != c.modified {
+			// the previous certificate is served until the pair loads.
+			c.load(modified)
+		}
+	}
+
+	return c.certificate, nil
+}
+
+func (c *Certificates) load(modified [2]time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load tls certificate: %w", err)
+	}
+
+	c.certificate = &certificate
+	c.modified = modified
+	c.checked = time.Now()
+	return nil
+}
+
+func (c *Certificates) modTimes() ([2]time.Time, error) {
+	var modified [2]time.Time
+	for i, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modified, err
+		}
+		modified[i] = info.ModTime()
+	}
+	return modified, nil
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+)
+
+const namespace = "gogsd"
+
+// Metrics keeps what gets exposed on /metrics: request counts, latencies
+// and in flight requests per route, the database pool's stats, how many
+// todos are open and done, and the Go runtime's metrics.
+type Metrics struct {
+	registry  *prometheus.Registry
+	requests  *prometheus.CounterVec
+	durations *prometheus.HistogramVec
+	inFlight  prometheus.Gauge
+}
+
+// New returns metrics reporting the stats of db's pool. Todos are counted
+// through queries every time the metrics are scraped.
+func New(db *sql.DB, queries *database.Queries) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Requests handled, by route pattern and status class.",
+		}, []string{"route", "status"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle requests, by route pattern and status class.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Requests being handled right now.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.durations,
+		m.inFlight,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "sqlite"),
+		&todoCollector{queries: queries},
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Start counts a request to the route matching pattern as in flight. The
+// returned function takes it out again, recording its status and how long
+// it took.
+func (m *Metrics) Start(pattern string) func(status int) {
+	m.inFlight.Inc()
+	start := time.Now()
+
+	return func(status int) {
+		m.inFlight.Dec()
+		labels := prometheus.Labels{"route": pattern, "status": statusClass(status)}
+		m.requests.With(labels).Inc()
+		m.durations.With(labels).Observe(time.Since(start).Seconds())
+	}
+}
+
+// statusClass turns 404 into "4xx". Handlers that never call WriteHeader
+// answer 200.
+func statusClass(status int) string {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+var todosDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "todos"),
+	"Todos stored, by whether they are open or done.",
+	[]string{"state"}, nil,
+)
+
+// todoCollector counts todos every time metrics are scraped, so the gauges
+// never drift from what is stored.
+type todoCollector struct {
+	queries *database.Queries
+}
+
+func (c *todoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- todosDesc
+}
+
+func (c *todoCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := c.queries.CountTodosByDone(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(todosDesc, err)
+		return
+	}
+
+	counts := map[string]int64{"open": 0, "done": 0}
+	for _, row := range rows {
+		if row.Done {
+			counts["done"] += row.Count
+		} else {
+			counts["open"] += row.Count
+		}
+	}
+
+	for state, count := range counts {
+		ch <- prometheus.MustNewConstMetric(todosDesc, prometheus.GaugeValue, float64(count), state)
+	}
+}
@@ -0,0 +1,115 @@
+// Package rank generates lexicographically ordered keys used to keep items in
+// a user defined order. A key can always be generated between any two other
+// keys, so moving an item only rewrites that item's key.
+package rank
+
+import (
+	"fmt"
+	"strings"
+)
+
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+const base = len(digits)
+
+// MaxLength is the length past which keys should be spread out again with
+// Spread. Keys grow by a character every time there is no room left between
+// two neighbours, so a list that is reordered a lot slowly gets longer keys.
+const MaxLength = 16
+
+// Between returns a key that sorts after lo and before hi. An empty lo means
+// the start of the order and an empty hi means the end of it.
+//
+// Generated keys never end in the smallest digit, which guarantees that there
+// is always room for another key before any of them.
+func Between(lo, hi string) (string, error) {
+	if err := check(lo); err != nil {
+		return "", err
+	}
+
+	if err := check(hi); err != nil {
+		return "", err
+	}
+
+	if lo != "" && hi != "" && lo >= hi {
+		return "", fmt.Errorf("rank: %q does not sort before %q", lo, hi)
+	}
+
+	var key strings.Builder
+	hiTied := hi != ""
+
+	for i := 0; ; i++ {
+		l := 0
+		if i < len(lo) {
+			l = strings.IndexByte(digits, lo[i])
+		}
+
+		h := base
+		if hiTied && i < len(hi) {
+			h = strings.IndexByte(digits, hi[i])
+		}
+
+		if h-l < 2 {
+			key.WriteByte(digits[l])
+			if l < h {
+				hiTied = false
+			}
+			continue
+		}
+
+		// appending and prepending step as little as possible so the keys
+		// at either end of the order stay short for as long as possible.
+		switch {
+		case hi == "":
+			key.WriteByte(digits[l+1])
+		case lo == "":
+			key.WriteByte(digits[h-1])
+		default:
+			key.WriteByte(digits[(l+h)/2])
+		}
+
+		return key.String(), nil
+	}
+}
+
+// After returns a key that sorts after lo.
+func After(lo string) (string, error) {
+	return Between(lo, "")
+}
+
+// Spread returns n ordered keys of the same length spaced evenly across the
+// whole key space, leaving as much room as possible around each of them.
+func Spread(n int) []string {
+	width := 1
+	capacity := base
+	for capacity <= 2*n {
+		width++
+		capacity *= base
+	}
+
+	step := capacity / (n + 1)
+	keys := make([]string, n)
+
+	for i := range keys {
+		value := (i + 1) * step
+		key := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			key[j] = digits[value%base]
+			value /= base
+		}
+
+		keys[i] = strings.TrimRight(string(key), digits[:1])
+	}
+
+	return keys
+}
+
+func check(key string) error {
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return fmt.Errorf("rank: invalid character %q in key %q", key[i], key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how often MemoryStore forgets buckets that refilled.
+const sweepEvery = time.Minute
+
+// MemoryStore keeps token buckets in the process.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]bucket), lastSweep: time.Now()}
+}
+
+// rate is how many tokens the bucket gets back per second.
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// refill returns the bucket as it is at now.
+func (b bucket) refill(now time.Time) bucket {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.rate())
+	b.updated = now
+	return b
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, found := s.buckets[key]
+	if !found || b.limit != limit {
+		b = bucket{tokens: float64(limit.Burst), updated: now, limit: limit}
+	}
+	b = b.refill(now)
+
+	var result Result
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / limit.rate())
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsToDuration((float64(limit.Burst) - b.tokens) / limit.rate())
+	s.buckets[key] = b
+	return result, nil
+}
+
+// sweep forgets the buckets that are full again, which are the same as no
+// bucket at all.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepEvery {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if b.refill(now).tokens >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// route groups sharing a limit. Requests to routes in different groups never
+// count against each other, but every authenticated request also counts
+// against GroupClient before its credentials are checked.
+const (
+	GroupAuth   = "auth"
+	GroupRead   = "read"
+	GroupWrite  = "write"
+	GroupClient = "client"
+)
+
+// Limit lets a key burst Burst requests and refills its bucket at Burst
+// requests per Period. The zero Limit does not limit at all.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit parses limits written as <burst>/<period>, such as 60/1m, or
+// off for no limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "off" {
+		return Limit{}, nil
+	}
+
+	burst, period, found := strings.Cut(s, "/")
+	if !found {
+		return Limit{}, fmt.Errorf("limit %q is not of the form <burst>/<period>", s)
+	}
+
+	var limit Limit
+	var err error
+	limit.Burst, err = strconv.Atoi(burst)
+	if err != nil || limit.Burst < 1 {
+		return Limit{}, fmt.Errorf("limit %q does not have a positive burst", s)
+	}
+
+	limit.Period, err = time.ParseDuration(period)
+	if err != nil || limit.Period <= 0 {
+		return Limit{}, fmt.Errorf("limit %q does not have a positive period", s)
+	}
+
+	return limit, nil
+}
+
+func (l Limit) String() string {
+	if l.Burst == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// Result is what a store answers when a request takes a token.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a denied request would be allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets of every key. MemoryStore keeps them in the
+// process; servers sharing limits need a store they all talk to.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Config is the limit of each route group and the proxies trusted to tell
+// the client address in X-Forwarded-For.
+type Config struct {
+	Limits         map[string]Limit
+	TrustedProxies []netip.Prefix
+}
+
+// Limiter hands out middlewares limiting each route group. Its config can
+// be swapped while it serves requests.
+type Limiter struct {
+	store  Store
+	config atomic.Pointer[Config]
+}
+
+func New(store Store, config Config) *Limiter {
+	l := &Limiter{store: store}
+	l.config.Store(&config)
+	return l
+}
+
+// SetConfig makes requests from now on count against the limits of config.
+func (l *Limiter) SetConfig(config Config) {
+	l.config.Store(&config)
+}
+
+// Middleware returns a middleware counting requests against the limit of
+// group. Requests are keyed by the user they were made by when it runs
+// inside auth.Require, or by client address when there is no user yet. Every
+// response carries RateLimit-* headers, and requests over the limit are
+// answered with 429 and Retry-After through apierror. Errors of the store
+// let requests through, an outage there should not take the API down.
+func (l *Limiter) Middleware(logger gsdlogger.Logger, group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			config := l.config.Load()
+			limit := config.Limits[group]
+			if limit.Burst == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := group + ":" + key(r, config.TrustedProxies)
+			result, err := l.store.Take(r.Context(), key, limit)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "could not take rate limit token", "key", key, "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, seconds(limit.Period)))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+
+			if !result.Allowed {
+				logger.DebugContext(r.Context(), "rate limited", "key", key, "retryAfter", result.RetryAfter)
+				w.Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+				apierror.Write(w, http.StatusTooManyRequests, apierror.CodeRateLimited, "too many requests")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the address r came from, as told by the proxies the
+// limiter trusts.
+func (l *Limiter) ClientIP(r *http.Request) netip.Addr {
+	return ClientIP(r, l.config.Load().TrustedProxies)
+}
+
+func key(r *http.Request, trustedProxies []netip.Prefix) string {
+	if user, ok := auth.UserFromContext(r.Context()); ok {
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+	return "ip:" + ClientIP(r, trustedProxies).String()
+}
+
+// seconds rounds d up to whole seconds, as the headers want them.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,179 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// headers carrying the IDs, both on requests and on responses.
+const (
+	Header            = "X-Request-ID"
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// maxRequestIDLength caps the request IDs taken from clients, which end up
+// in every log line.
+const maxRequestIDLength = 128
+
+// Trace is the W3C trace context of a request. SpanID identifies the work
+// this server does for it and ParentID the span of the caller, empty when
+// the trace started here.
+type Trace struct {
+	TraceID  string
+	ParentID string
+	SpanID   string
+	Flags    string
+	State    string
+}
+
+// Traceparent formats the trace as a traceparent header for calls made on
+// behalf of the request, which are children of its span.
+func (t Trace) Traceparent() string {
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+// IDs are what a request is known by in logs, responses and the calls it
+// makes.
+type IDs struct {
+	RequestID string
+	Trace     Trace
+}
+
+type idsContextKey struct{}
+
+// With returns a copy of ctx carrying ids, which gsdlogger adds to every
+// line logged with it.
+func With(ctx context.Context, ids IDs) context.Context {
+	ctx = context.WithValue(ctx, idsContextKey{}, ids)
+	return gsdlogger.WithAttrs(ctx, "requestId", ids.RequestID, "traceId", ids.Trace.TraceID, "spanId", ids.Trace.SpanID)
+}
+
+// FromContext returns the IDs stored by With, if any.
+func FromContext(ctx context.Context) (IDs, bool) {
+	ids, ok := ctx.Value(idsContextKey{}).(IDs)
+	return ids, ok
+}
+
+// Middleware takes the request ID and trace context of each request from
+// its X-Request-ID and traceparent headers, making up the ones missing or
+// malformed, stores them in its context and echoes them in the response
+// headers before anything else writes them.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := IDs{RequestID: r.Header.Get(Header)}
+		if !validRequestID(ids.RequestID) {
+			ids.RequestID = randomHex(16)
+		}
+
+		ids.Trace = Trace{SpanID: randomHex(8), Flags: "00"}
+		if traceID, parentID, flags, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+			ids.Trace.TraceID, ids.Trace.ParentID, ids.Trace.Flags = traceID, parentID, flags
+			ids.Trace.State = r.Header.Get(TracestateHeader)
+		} else {
+			ids.Trace.TraceID = randomHex(16)
+		}
+
+		w.Header().Set(Header, ids.RequestID)
+		w.Header().Set(TraceparentHeader, ids.Trace.Traceparent())
+		next.ServeHTTP(w, r.WithContext(With(r.Context(), ids)))
+	})
+}
+
+// ParseTraceparent parses a traceparent header as specified by W3C Trace
+// Context. Headers of versions after 00 are read as far as 00 goes, as the
+// specification asks.
+func ParseTraceparent(header string) (traceID, parentID, flags string, ok bool) {
+	if len(header) < 55 || (len(header) > 55 && (header[:2] == "00" || header[55] != '-')) {
+		return "", "", "", false
+	}
+
+	version, traceID, parentID, flags := header[0:2], header[3:35], header[36:52], header[53:55]
+	if header[2] != '-' || header[35] != '-' || header[52] != '-' {
+		return "", "", "", false
+	}
+
+	for _, field := range []string{version, traceID, parentID, flags} {
+		if !isLowerHex(field) {
+			return "", "", "", false
+		}
+	}
+
+	if version == "ff" || isZero(traceID) || isZero(parentID) {
+		return "", "", "", false
+	}
+
+	return traceID, parentID, flags, true
+}
+
+// Transport is an http.RoundTripper sending the IDs of the request a call
+// is made for along with it.
+type Transport struct {
+	// Base makes the calls, http.DefaultTransport when nil.
+	Base http.RoundTripper
+}
+
+func (t Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ids, ok := FromContext(r.Context())
+	if !ok {
+		return base.RoundTrip(r)
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set(Header, ids.RequestID)
+	r.Header.Set(TraceparentHeader, ids.Trace.Traceparent())
+	if ids.Trace.State != "" {
+		r.Header.Set(TracestateHeader, ids.Trace.State)
+	}
+
+	return base.RoundTrip(r)
+}
+
+// validRequestID accepts the IDs clients may pick, which are short and made
+// of characters safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:/+=", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+// randomHex panics when crypto/rand fails, which only happens on systems
+// without randomness, where nothing can be served safely anyway.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
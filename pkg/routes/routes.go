@@ -5,47 +5,254 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/config"
 	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/features"
 	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
 	"github.com/juancortelezzi/gogsd/pkg/handlers"
+	"github.com/juancortelezzi/gogsd/pkg/metrics"
+	"github.com/juancortelezzi/gogsd/pkg/ratelimit"
+	"github.com/juancortelezzi/gogsd/pkg/telemetry"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
 )
 
-func AddRoutes(
-	mux *http.ServeMux,
-	logger gsdlogger.Logger,
-	queries *database.Queries,
-	validate *validator.Validate,
-) {
-	logMiddle := logMiddleware(logger)
+// Deps are what the routes are served with. OIDC is nil when logging in
+// through an OpenID Connect provider is not offered, and Bearers
+// authenticate requests next to API keys and sessions.
+type Deps struct {
+	Logger   gsdlogger.Logger
+	Queries  *database.Queries
+	Validate *validator.Validate
+	Limiter  *ratelimit.Limiter
+	Metrics  *metrics.Metrics
+	Flags    *features.Flags
+	OIDC     *auth.OIDCProvider
+	Bearers  []auth.Authenticator
+}
+
+func AddRoutes(mux *http.ServeMux, deps Deps) {
+	logger, queries, validate := deps.Logger, deps.Queries, deps.Validate
+	limiter, oidc := deps.Limiter, deps.OIDC
+
+	logMiddle := logMiddleware(logger, deps.Metrics)
+	handle := func(pattern string, wrapper func(l gsdlogger.Logger) http.Handler) {
+		mux.Handle(pattern, logMiddle(pattern, wrapper))
+	}
+
+	sessions := auth.NewSessions(queries)
+	throttle := auth.NewLoginThrottle(5, 15*time.Minute)
+	authenticators := append([]auth.Authenticator{auth.NewAPIKeyAuthenticator(logger, queries), sessions}, deps.Bearers...)
+	limitAuth := limiter.Middleware(logger, ratelimit.GroupAuth)
+	limitRead := limiter.Middleware(logger, ratelimit.GroupRead)
+	limitWrite := limiter.Middleware(logger, ratelimit.GroupWrite)
+	limitClient := limiter.Middleware(logger, ratelimit.GroupClient)
+	read := limited(limitClient, auth.Require(logger, auth.ScopeTodosRead, authenticators...), limitRead)
+	write := limited(limitClient, auth.Require(logger, auth.ScopeTodosWrite, authenticators...), limitWrite)
+	// managing keys and workspaces counts as writing.
+	authenticated := limited(limitClient, auth.Require(logger, "", authenticators...), limitWrite)
+	admin := limited(limitClient, auth.Require(logger, auth.ScopeAdmin, authenticators...), limitWrite)
 
 	mux.Handle("GET /ping", handlers.HandlePing())
 	mux.Handle("GET /hello/{name}", handlers.HandleHello(logger))
 
-	mux.Handle("GET /todos", logMiddle(func(l gsdlogger.Logger) http.Handler {
-		return handlers.HandleListTodos(l, queries)
-	}))
+	registration := deps.Flags.Require(func(f config.Features) bool { return f.Registration })
+	handle("POST /auth/register", func(l gsdlogger.Logger) http.Handler {
+		return registration(limitAuth(handlers.HandleRegister(l, queries, validate)))
+	})
+
+	handle("POST /auth/login", func(l gsdlogger.Logger) http.Handler {
+		return limitAuth(handlers.HandleLogin(l, queries, validate, sessions, throttle, limiter.ClientIP))
+	})
+
+	handle("POST /auth/logout", func(l gsdlogger.Logger) http.Handler {
+		return limitClient(auth.Require(l, "", sessions)(handlers.HandleLogout(l, sessions)))
+	})
+
+	if oidc != nil {
+		handle("GET /auth/oidc/login", func(l gsdlogger.Logger) http.Handler {
+			return limitAuth(handlers.HandleOIDCLogin(l, oidc))
+		})
+
+		handle("GET /auth/oidc/callback", func(l gsdlogger.Logger) http.Handler {
+			return limitAuth(handlers.HandleOIDCCallback(l, queries, oidc, sessions))
+		})
+	}
+
+	handle("GET /todos", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleListTodos(l, queries))
+	})
+
+	handle("POST /todos", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleCreateTodo(l, queries, validate))
+	})
+
+	handle("GET /todos/{id}", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleGetTodo(l, queries))
+	})
+
+	handle("PUT /todos/{id}", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleUpdateTodo(l, queries, validate))
+	})
+
+	handle("PATCH /todos/{id}", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandlePatchTodo(l, queries, validate))
+	})
+
+	handle("DELETE /todos/{id}", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleDeleteTodo(l, queries, validate))
+	})
+
+	handle("POST /todos/{id}/move", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleMoveTodo(l, queries, validate))
+	})
+
+	handle("POST /todos/{id}/transition", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleTransitionTodo(l, queries, validate))
+	})
+
+	handle("GET /todos/{id}/blockers", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleListTodoBlockers(l, queries))
+	})
+
+	handle("POST /todos/{id}/blockers", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleAddTodoBlocker(l, queries, validate))
+	})
+
+	handle("DELETE /todos/{id}/blockers/{blockerId}", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleRemoveTodoBlocker(l, queries))
+	})
+
+	handle("GET /todos/{id}/blocking", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleListTodoBlocking(l, queries))
+	})
+
+	handle("GET /todos:ready", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleListReadyTodos(l, queries))
+	})
 
-	mux.Handle("POST /todos", logMiddle(func(l gsdlogger.Logger) http.Handler {
-		return handlers.HandleCreateTodo(l, queries, validate)
-	}))
+	handle("POST /todos:batch", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleBatchTodos(l, queries, validate))
+	})
 
-	mux.Handle("PUT /todos/{id}", logMiddle(func(l gsdlogger.Logger) http.Handler {
-		return handlers.HandleUpdateTodo(l, queries, validate)
-	}))
+	handle("POST /todos:deleteCompleted", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleDeleteCompletedTodos(l, queries))
+	})
 
-	mux.Handle("DELETE /todos/{id}", logMiddle(func(l gsdlogger.Logger) http.Handler {
-		return handlers.HandleDeleteTodo(l, queries, validate)
-	}))
+	handle("GET /lists", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleListLists(l, queries))
+	})
+
+	handle("POST /lists", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleCreateList(l, queries, validate))
+	})
+
+	handle("GET /lists/{id}/todos", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleListListTodos(l, queries))
+	})
+
+	handle("GET /lists/{id}/workflow", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleGetWorkflow(l, queries))
+	})
+
+	handle("PUT /lists/{id}/workflow", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandlePutWorkflow(l, queries, validate))
+	})
+
+	handle("GET /lists/{id}/board", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleGetBoard(l, queries))
+	})
+
+	handle("DELETE /lists/{id}", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleDeleteList(l, queries))
+	})
+
+	handle("POST /lists/{id}/todos:markDone", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleMarkListDone(l, queries))
+	})
+
+	handle("GET /lists/{id}/members", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleListMembers(l, queries))
+	})
+
+	handle("PUT /lists/{id}/members/{userId}", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandlePutMember(l, queries, validate))
+	})
+
+	handle("DELETE /lists/{id}/members/{userId}", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleDeleteMember(l, queries))
+	})
+
+	handle("POST /lists/{id}/invitations", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleCreateInvitation(l, queries, validate))
+	})
+
+	handle("POST /invitations:accept", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleAcceptInvitation(l, queries, validate))
+	})
+
+	handle("POST /invitations:decline", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleDeclineInvitation(l, queries, validate))
+	})
+
+	handle("GET /api-keys", func(l gsdlogger.Logger) http.Handler {
+		return authenticated(handlers.HandleListAPIKeys(l, queries))
+	})
+
+	handle("POST /api-keys", func(l gsdlogger.Logger) http.Handler {
+		return authenticated(handlers.HandleCreateAPIKey(l, queries, validate))
+	})
+
+	handle("DELETE /api-keys/{id}", func(l gsdlogger.Logger) http.Handler {
+		return authenticated(handlers.HandleDeleteAPIKey(l, queries))
+	})
+
+	handle("POST /sync", func(l gsdlogger.Logger) http.Handler {
+		return write(handlers.HandleSync(l, queries, validate))
+	})
+
+	handle("GET /workspace", func(l gsdlogger.Logger) http.Handler {
+		return read(handlers.HandleGetWorkspace(l, queries))
+	})
+
+	handle("GET /workspaces", func(l gsdlogger.Logger) http.Handler {
+		return admin(handlers.HandleListWorkspaces(l, queries))
+	})
+
+	handle("POST /workspaces", func(l gsdlogger.Logger) http.Handler {
+		return admin(handlers.HandleCreateWorkspace(l, queries, validate))
+	})
+
+	handle("PUT /workspaces/{slug}", func(l gsdlogger.Logger) http.Handler {
+		return admin(handlers.HandleUpdateWorkspace(l, queries, validate))
+	})
+}
+
+// limited limits requests by client address before require checks their
+// credentials, as every check costs a lookup whether it succeeds or not, and
+// once require let them through by the user they were made by.
+func limited(limitClient, require, limit func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return limitClient(require(limit(next)))
+	}
 }
 
-func logMiddleware(logger gsdlogger.Logger) func(wrapper func(l gsdlogger.Logger) http.Handler) http.Handler {
-	return func(wrapper func(l gsdlogger.Logger) http.Handler) http.Handler {
+// logMiddleware logs every request to the route matching pattern, names its
+// span after the pattern and records it in m.
+func logMiddleware(logger gsdlogger.Logger, m *metrics.Metrics) func(pattern string, wrapper func(l gsdlogger.Logger) http.Handler) http.Handler {
+	return func(pattern string, wrapper func(l gsdlogger.Logger) http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 			l := logger.With("method", r.Method, "path", r.URL.EscapedPath())
+			if ws, ok := workspace.FromContext(r.Context()); ok {
+				l = l.With("workspace", ws.Slug)
+			}
 			now := time.Now()
 			rw := gsdlogger.NewLoggerResponseWritter(w)
+			telemetry.SetRoute(r.Context(), pattern)
+			done := m.Start(pattern)
 			wrapper(l).ServeHTTP(rw, r)
+			done(rw.Status())
 			l.InfoContext(
 				r.Context(), "hit",
 				"duration", time.Since(now),
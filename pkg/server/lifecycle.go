@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/health"
+	"github.com/juancortelezzi/gogsd/pkg/listener"
+	"github.com/juancortelezzi/gogsd/pkg/worker"
+)
+
+// sessionSweepInterval is how often sessions that expired are deleted.
+const sessionSweepInterval = 10 * time.Minute
+
+// Server is gogsd set up by New, listening but not serving yet.
+type Server struct {
+	logger   gsdlogger.Logger
+	cfg      config.Config
+	servers  []serving
+	probes   *health.Probes
+	workers  *worker.Group
+	sessions *auth.Sessions
+	reloader *reloader
+	hangups  chan os.Signal
+	ready    chan struct{}
+
+	// closers release what New acquired, in the order it acquired it.
+	closers []func()
+}
+
+// serving is a server and the listener it serves on.
+type serving struct {
+	server   *http.Server
+	listener net.Listener
+	addr     string
+}
+
+// Ready is closed once Run serves on every listener.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Run serves until ctx is done, the process is interrupted or terminated,
+// or a listener fails. The listeners, workers and reloads run together:
+// the first of them to fail stops the others and its error is returned.
+// Once the listeners drained the workers stop, then the database closes.
+// A Server runs once.
+func (s *Server) Run(ctx context.Context) error {
+	defer s.close()
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// workers keep running until the listeners drained, requests in flight
+	// may still count on them.
+	workersCtx, stopWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWorkers()
+	s.startWorkers(workersCtx)
+
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	for _, serving := range s.servers {
+		group.Go(func() error {
+			s.logger.InfoContext(ctx, "listening on", "addr", serving.addr)
+			if err := listener.Serve(serving.server, serving.listener); err != nil {
+				s.logger.ErrorContext(ctx, "error serving", "addr", serving.addr, "err", err)
+				return fmt.Errorf("could not serve on %s: %w", serving.addr, err)
+			}
+			return nil
+		})
+	}
+
+	group.Go(func() error {
+		for {
+			select {
+			case <-groupCtx.Done():
+				return nil
+			case <-s.hangups:
+				s.reloader.reload(groupCtx)
+			}
+		}
+	})
+
+	group.Go(func() error {
+		<-groupCtx.Done()
+		// the group context is also done when a listener failed, which
+		// takes the server down without waiting for load balancers.
+		s.shutdown(ctx, ctx.Err() != nil)
+		return nil
+	})
+
+	close(s.ready)
+
+	err := group.Wait()
+	stopWorkers()
+	s.workers.Wait()
+	return err
+}
+
+func (s *Server) startWorkers(ctx context.Context) {
+	s.workers.Every(ctx, "session-sweeper", sessionSweepInterval, func(ctx context.Context) error {
+		swept, err := s.sessions.Sweep(ctx)
+		if swept > 0 {
+			s.logger.DebugContext(ctx, "swept expired sessions", "count", swept)
+		}
+		return err
+	})
+}
+
+// shutdown fails readiness, for the drain timeout before the listeners close
+// when drain is set, giving load balancers time to stop sending traffic, then
+// waits for the requests in flight up to the shutdown timeout.
+func (s *Server) shutdown(ctx context.Context, drain bool) {
+	s.probes.Drain()
+	if drain {
+		time.Sleep(s.cfg.Timeouts.Drain)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeouts.Shutdown)
+	defer cancel()
+
+	for _, serving := range s.servers {
+		if err := serving.server.Shutdown(shutdownCtx); err != nil {
+			s.logger.ErrorContext(ctx, "error shutting down http server", "addr", serving.addr, "err", err)
+		}
+	}
+}
+
+func (s *Server) onClose(close func()) {
+	s.closers = append(s.closers, close)
+}
+
+// close releases what New acquired, last acquired first.
+func (s *Server) close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+	s.closers = nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/cors"
+	"github.com/juancortelezzi/gogsd/pkg/features"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/listener"
+	"github.com/juancortelezzi/gogsd/pkg/ratelimit"
+)
+
+// reloader applies configuration that changed to a running server. Reloads
+// happen one at a time, each setting is swapped atomically.
+type reloader struct {
+	logger  gsdlogger.Logger
+	options options
+	// running is the configuration the server runs with, settings that
+	// need a restart keep the value it started with.
+	running config.Config
+
+	limiter      *ratelimit.Limiter
+	policy       *cors.Policy
+	flags        *features.Flags
+	certificates *listener.Certificates
+}
+
+// reload loads the TLS certificates again and, when Run was given a way to
+// load the configuration, applies the settings that can change without a
+// restart. A configuration that is not valid is not applied at all.
+func (r *reloader) reload(ctx context.Context) {
+	r.logger.InfoContext(ctx, "reloading configuration")
+
+	if r.certificates != nil {
+		if err := r.certificates.Reload(); err != nil {
+			r.logger.ErrorContext(ctx, "error reloading tls certificates", "err", err)
+		}
+	}
+
+	if r.options.load == nil {
+		return
+	}
+
+	next, err := r.options.load()
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		r.logger.ErrorContext(ctx, "error reloading configuration, keeping the running one", "err", err)
+		return
+	}
+
+	applied, reloaded, restart := r.running.Reload(next)
+	if r.options.logLevel == nil && slices.Contains(reloaded, "log.level") {
+		applied.Log.Level = r.running.Log.Level
+		reloaded = slices.DeleteFunc(reloaded, func(key string) bool { return key == "log.level" })
+		restart = append(restart, "log.level")
+	}
+
+	// applied was validated along with next, so none of these fail.
+	if r.options.logLevel != nil {
+		level, _ := applied.LogLevel()
+		r.options.logLevel.Set(level)
+	}
+	rateLimits, _ := applied.RateLimitConfig()
+	r.limiter.SetConfig(rateLimits)
+	r.policy.SetOrigins(applied.CORS.AllowedOrigins)
+	r.flags.Set(applied.Features)
+	r.running = applied
+
+	r.logger.InfoContext(ctx, "reloaded configuration", "changed", reloaded)
+	if len(restart) > 0 {
+		r.logger.WarnContext(ctx, "configuration changes need a restart to apply", "settings", restart)
+	}
+}
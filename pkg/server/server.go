@@ -2,88 +2,303 @@ package server
 
 import (
 	"context"
+	"database/sql"
 	_ "embed"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
-	"time"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/go-playground/validator/v10"
 	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel"
 
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/cors"
 	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/features"
 	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/health"
+	"github.com/juancortelezzi/gogsd/pkg/listener"
+	"github.com/juancortelezzi/gogsd/pkg/metrics"
+	"github.com/juancortelezzi/gogsd/pkg/ratelimit"
+	"github.com/juancortelezzi/gogsd/pkg/requestid"
 	"github.com/juancortelezzi/gogsd/pkg/routes"
+	"github.com/juancortelezzi/gogsd/pkg/telemetry"
+	"github.com/juancortelezzi/gogsd/pkg/worker"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
 )
 
-func NewServerHandler(
-	logger gsdlogger.Logger,
-	queries *database.Queries,
-	validate *validator.Validate,
-) http.Handler {
+// HandlerDeps are what the server handler is built with, the routes' and
+// what the middlewares around them need.
+type HandlerDeps struct {
+	routes.Deps
+	Resolver     *workspace.Resolver
+	Policy       *cors.Policy
+	MaxBodyBytes int64
+}
+
+func NewServerHandler(deps HandlerDeps) http.Handler {
 	mux := http.NewServeMux()
-	routes.AddRoutes(mux, logger, queries, validate)
-	return mux
+	routes.AddRoutes(mux, deps.Deps)
+	tracer := otel.GetTracerProvider().Tracer("github.com/juancortelezzi/gogsd/pkg/server")
+	// preflights are answered before the workspace is looked up, browsers
+	// send them without the headers naming it.
+	return requestid.Middleware(deps.Policy.Middleware(telemetry.Middleware(tracer)(deps.Resolver.Middleware(deps.Logger)(limitBody(deps.MaxBodyBytes)(mux)))))
+}
+
+// limitBody makes reading more than max bytes of a request body fail, which
+// handlers answer with 413.
+func limitBody(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
-func Run(ctx context.Context, logger gsdlogger.Logger, lookupEnv func(string) (string, bool)) error {
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
-	defer cancel()
+// Option changes how Run runs the server.
+type Option func(*options)
+
+type options struct {
+	load     func() (config.Config, error)
+	logLevel *slog.LevelVar
+}
 
-	logger.DebugContext(ctx, "looking env variables")
+// WithReload makes SIGHUP load the configuration again with load and apply
+// the settings that can change without a restart. Without it, SIGHUP only
+// reloads the TLS certificates.
+func WithReload(load func() (config.Config, error)) Option {
+	return func(o *options) { o.load = load }
+}
 
-	port, found := lookupEnv("PORT")
-	if !found {
-		return fmt.Errorf("PORT environment variable not found")
+// WithLogLevel is the level of the logger passed to Run, which reloads set.
+// Without it, changing the log level needs a restart.
+func WithLogLevel(level *slog.LevelVar) Option {
+	return func(o *options) { o.logLevel = level }
+}
+
+// Run serves gogsd as cfg says until ctx is done or the process is
+// interrupted or terminated. It is New followed by Server.Run.
+func Run(ctx context.Context, logger gsdlogger.Logger, cfg config.Config, opts ...Option) error {
+	s, err := New(ctx, logger, cfg, opts...)
+	if err != nil {
+		return err
 	}
+	return s.Run(ctx)
+}
 
-	databaseUrl, found := lookupEnv("DATABASE_URL")
-	if !found {
-		return fmt.Errorf("DATABASE_URL environment variable not found")
+// New sets gogsd up as cfg says, up to listening, so that whatever fails
+// on startup is returned here. cfg is validated again, so it may come from
+// anywhere.
+func New(ctx context.Context, logger gsdlogger.Logger, cfg config.Config, opts ...Option) (_ *Server, err error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	s := &Server{logger: logger, cfg: cfg, ready: make(chan struct{})}
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+
+	// the configuration is valid, so none of these fail.
+	listenConfig, _ := cfg.ListenConfig()
+	telemetryConfig, _ := cfg.TelemetryConfig()
+	oidcConfig, oidcFound, _ := cfg.OIDCConfig()
+	jwtConfig, jwtFound, _ := cfg.JWTConfig()
+	rateLimits, _ := cfg.RateLimitConfig()
+
+	shutdownTracing, err := telemetry.Setup(ctx, telemetryConfig)
+	if err != nil {
+		return nil, err
+	}
+	s.onClose(func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("error flushing spans", "err", err)
+		}
+	})
+
 	logger.DebugContext(ctx, "initializing database conneciton")
 
-	queries, err := database.Connect(ctx, logger, databaseUrl)
+	db, err := database.Open(ctx, logger, cfg.Database.URL)
 	if err != nil {
 		logger.ErrorContext(ctx, "error connecting to database", "err", err)
-		return nil
+		return nil, fmt.Errorf("could not connect to database: %w", err)
 	}
+	s.onClose(func() {
+		if err := db.Close(); err != nil {
+			logger.Error("error closing database", "err", err)
+		}
+	})
+
+	queries := database.New(database.NewTracedDB(db, otel.GetTracerProvider().Tracer("github.com/juancortelezzi/gogsd/pkg/database")))
+
+	// the bootstrap key gives the local user an admin key, which is how the
+	// first keys of a fresh database get created.
+	if key := cfg.Auth.BootstrapAPIKey; key != "" {
+		if err := auth.EnsureAPIKey(ctx, queries, "local", key, []string{auth.ScopeAdmin}); err != nil {
+			logger.ErrorContext(ctx, "error storing bootstrap api key", "err", err)
+			return nil, fmt.Errorf("could not store bootstrap api key: %w", err)
+		}
+	}
+
+	// OpenID Connect login is only offered once an issuer is configured.
+	var oidc *auth.OIDCProvider
+	if oidcFound {
+		logger.DebugContext(ctx, "discovering oidc provider", "issuer", oidcConfig.Issuer)
+		oidc, err = auth.NewOIDCProvider(ctx, oidcConfig)
+		if err != nil {
+			logger.ErrorContext(ctx, "error discovering oidc provider", "err", err)
+			return nil, fmt.Errorf("could not discover oidc provider: %w", err)
+		}
+	}
+
+	// bearer JWTs minted by other services are accepted next to API keys
+	// once an issuer is configured.
+	var bearers []auth.Authenticator
+	if jwtFound {
+		jwtAuthenticator, err := auth.NewJWTAuthenticator(queries, jwtConfig)
+		if err != nil {
+			logger.ErrorContext(ctx, "error loading jwt keys", "err", err)
+			return nil, fmt.Errorf("could not load jwt keys: %w", err)
+		}
+		bearers = append(bearers, jwtAuthenticator)
+	}
+
+	// the workspace domain lets requests to acme.<domain> name the acme
+	// workspace, next to the X-Workspace header and /w/acme path prefixes.
+	resolver := workspace.NewResolver(queries, cfg.Workspace.Domain)
+
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), rateLimits)
+	policy := cors.New(cfg.CORS.AllowedOrigins)
+	flags := features.New(cfg.Features)
 
 	validate := validator.New(validator.WithRequiredStructEnabled())
 
-	serverHandler := NewServerHandler(logger, queries, validate)
+	// scraping counts todos without tracing, or every scrape would start
+	// a trace of its own.
+	m := metrics.New(db, database.New(db))
+
+	serverHandler := NewServerHandler(HandlerDeps{
+		Deps: routes.Deps{
+			Logger:   logger,
+			Queries:  queries,
+			Validate: validate,
+			Limiter:  limiter,
+			Metrics:  m,
+			Flags:    flags,
+			OIDC:     oidc,
+			Bearers:  bearers,
+		},
+		Resolver:     resolver,
+		Policy:       policy,
+		MaxBodyBytes: cfg.Limits.MaxBodyBytes,
+	})
+
+	s.workers = worker.NewGroup(logger)
+	s.sessions = auth.NewSessions(queries)
+	s.probes = newProbes(cfg, db, s.workers)
+
+	// probes are answered before the workspace middleware, so they work
+	// whatever happened to the database.
+	mux := http.NewServeMux()
+	mux.Handle("GET /healthz", s.probes.HandleLiveness())
+	mux.Handle("GET /readyz", s.probes.HandleReadiness())
+	mux.Handle("/", serverHandler)
+
+	httpServer := newHTTPServer(cfg, mux)
+	certificates, err := listener.Configure(httpServer, listenConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// hangups are caught before listening, as they would otherwise
+	// terminate the process.
+	s.hangups = make(chan os.Signal, 1)
+	signal.Notify(s.hangups, syscall.SIGHUP)
+	s.onClose(func() { signal.Stop(s.hangups) })
 
-	httpServer := &http.Server{
-		Addr:    net.JoinHostPort("127.0.0.1", port),
-		Handler: serverHandler,
+	l, err := listener.Listen(listenConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen: %w", err)
 	}
+	s.onClose(func() { l.Close() })
+	s.servers = []serving{{server: httpServer, listener: l, addr: listener.Describe(l, listenConfig)}}
 
-	go func() {
-		logger.InfoContext(ctx, "listening on", "addr", httpServer.Addr)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.ErrorContext(ctx, "error listening and serving", "err", err)
+	// /metrics is only served on a listener of its own, as the public one
+	// would show it to anyone.
+	if metricsAddr := cfg.Metrics.Listen; metricsAddr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("GET /metrics", m.Handler())
+
+		adminListener, err := net.Listen("tcp", metricsAddr)
+		if err != nil {
+			return nil, fmt.Errorf("could not listen for metrics: %w", err)
 		}
-	}()
+		s.onClose(func() { adminListener.Close() })
+		s.servers = append(s.servers, serving{server: newHTTPServer(cfg, adminMux), listener: adminListener, addr: "http://" + adminListener.Addr().String()})
+	}
+
+	s.reloader = &reloader{
+		logger:       logger,
+		options:      o,
+		running:      cfg,
+		limiter:      limiter,
+		policy:       policy,
+		flags:        flags,
+		certificates: certificates,
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		<-ctx.Done()
+	return s, nil
+}
 
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-		defer cancel()
+func newHTTPServer(cfg config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		ReadTimeout:       cfg.Timeouts.Read,
+		WriteTimeout:      cfg.Timeouts.Write,
+		IdleTimeout:       cfg.Timeouts.Idle,
+		MaxHeaderBytes:    cfg.Limits.MaxHeaderBytes,
+	}
+}
 
-		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			logger.ErrorContext(ctx, "error shutting down http server", "err", err)
+// newProbes checks that the database answers and is migrated, that the disk
+// holding it has the configured space left, and that workers run. Workers
+// failing, usually because the database does, takes the server out of
+// rotation instead of restarting it.
+func newProbes(cfg config.Config, db *sql.DB, workers *worker.Group) *health.Probes {
+	probes := health.NewProbes()
+	probes.AddReadiness("workers", workers)
+	probes.AddReadiness("database", health.Ping(db))
+	probes.AddReadiness("migrations", health.CheckerFunc(func(ctx context.Context) error {
+		pending, err := database.PendingMigrations(ctx, db)
+		if err != nil {
+			return err
 		}
-	}()
+		if len(pending) > 0 {
+			return fmt.Errorf("migrations not applied: %s", strings.Join(pending, ", "))
+		}
+		return nil
+	}))
 
-	wg.Wait()
+	if path, ok := database.FilePath(cfg.Database.URL); ok {
+		probes.AddReadiness("disk", health.DiskSpace(filepath.Dir(path), cfg.Health.MinFreeDiskMB<<20))
+	}
 
-	return nil
+	return probes
 }
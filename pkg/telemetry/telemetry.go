@@ -0,0 +1,193 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/requestid"
+)
+
+// ServiceName is what spans are reported under unless configured otherwise.
+const ServiceName = "gogsd"
+
+// NewTracerProvider returns a tracer provider whose spans use the trace and
+// span IDs requestid.Middleware gave each request, so trace IDs in logs,
+// response headers and exported spans agree. opts are applied after the
+// defaults and can override them.
+func NewTracerProvider(opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	defaults := []sdktrace.TracerProviderOption{
+		sdktrace.WithIDGenerator(requestIDGenerator{}),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", ServiceName))),
+	}
+	return sdktrace.NewTracerProvider(append(defaults, opts...)...)
+}
+
+// Config is where spans are exported to.
+type Config struct {
+	// Endpoint is the URL spans are sent to over OTLP/HTTP, exporting is off
+	// without one.
+	Endpoint string
+	// Headers are added to the exports.
+	Headers     map[string]string
+	ServiceName string
+	// SampleRatio is the ratio of the traces started here that are sampled.
+	SampleRatio float64
+}
+
+// Setup installs a tracer provider exporting spans as config says as the
+// global one. Without an endpoint the global provider is left alone. The
+// returned function flushes and stops the provider.
+func Setup(ctx context.Context, config Config) (shutdown func(context.Context) error, err error) {
+	if config.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(config.Endpoint)}
+	if len(config.Headers) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(config.Headers))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create otlp exporter: %w", err)
+	}
+
+	provider := NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// ParseHeaders parses headers written as key1=value1,key2=value2.
+func ParseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("%q is not of the form key=value", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// Middleware traces every request in a server span, as a child of the
+// caller's span when requestid.Middleware found one. The span is named after
+// the method until SetRoute names it after the route the request matched.
+// Responses with server errors mark the span as failed.
+func Middleware(tracer trace.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if ids, ok := requestid.FromContext(ctx); ok && ids.Trace.ParentID != "" {
+				parent, err := spanContext(ids.Trace.TraceID, ids.Trace.ParentID, ids.Trace.Flags)
+				if err == nil {
+					ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
+				}
+			}
+
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.path", r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			rw := gsdlogger.NewLoggerResponseWritter(w)
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			status := rw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
+
+// SetRoute names the span of a request after the pattern of the route it
+// matched.
+func SetRoute(ctx context.Context, pattern string) {
+	span := trace.SpanFromContext(ctx)
+	span.SetName(pattern)
+	span.SetAttributes(attribute.String("http.route", pattern))
+}
+
+func spanContext(traceID, spanID, flags string) (trace.SpanContext, error) {
+	tid, err := trace.TraceIDFromHex(traceID)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+
+	sid, err := trace.SpanIDFromHex(spanID)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+
+	f, err := hex.DecodeString(flags)
+	if err != nil || len(f) != 1 {
+		return trace.SpanContext{}, fmt.Errorf("bad trace flags %q", flags)
+	}
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: trace.TraceFlags(f[0]),
+		Remote:     true,
+	}), nil
+}
+
+// requestIDGenerator gives the first span of a request the IDs
+// requestid.Middleware made up for it, and random IDs to every other span.
+type requestIDGenerator struct{}
+
+func (requestIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if ids, ok := requestid.FromContext(ctx); ok && ids.Trace.ParentID == "" && !trace.SpanContextFromContext(ctx).IsValid() {
+		tid, terr := trace.TraceIDFromHex(ids.Trace.TraceID)
+		sid, serr := trace.SpanIDFromHex(ids.Trace.SpanID)
+		if terr == nil && serr == nil {
+			return tid, sid
+		}
+	}
+
+	var tid trace.TraceID
+	var sid trace.SpanID
+	rand.Read(tid[:])
+	rand.Read(sid[:])
+	return tid, sid
+}
+
+func (requestIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	if ids, ok := requestid.FromContext(ctx); ok && trace.SpanContextFromContext(ctx).IsRemote() && ids.Trace.TraceID == traceID.String() {
+		if sid, err := trace.SpanIDFromHex(ids.Trace.SpanID); err == nil {
+			return sid
+		}
+	}
+
+	var sid trace.SpanID
+	rand.Read(sid[:])
+	return sid
+}
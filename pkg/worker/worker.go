@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// stallAfter is how many intervals a job may go without finishing a run
+// before Check reports it stalled.
+const stallAfter = 3
+
+// Group runs background jobs until the context they were started with is
+// done, and reports the ones that died or stalled.
+type Group struct {
+	logger gsdlogger.Logger
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+type job struct {
+	interval time.Duration
+	lastRun  time.Time
+	stopped  error
+}
+
+func NewGroup(logger gsdlogger.Logger) *Group {
+	return &Group{logger: logger, jobs: make(map[string]*job)}
+}
+
+// Every runs fn every interval until ctx is done. Errors fn returns are
+// logged and the job keeps going, a panic stops it.
+func (g *Group) Every(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	j := &job{interval: interval, lastRun: time.Now()}
+
+	g.mu.Lock()
+	g.jobs[name] = j
+	g.mu.Unlock()
+
+	logger := g.logger.With("worker", name)
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			if v := recover(); v != nil {
+				logger.ErrorContext(ctx, "worker panicked", "panic", v)
+				g.mu.Lock()
+				j.stopped = fmt.Errorf("panicked: %v", v)
+				g.mu.Unlock()
+			}
+		}()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := fn(ctx); err != nil && ctx.Err() == nil {
+				logger.ErrorContext(ctx, "worker run failed", "err", err)
+			}
+
+			g.mu.Lock()
+			j.lastRun = time.Now()
+			g.mu.Unlock()
+		}
+	}()
+}
+
+// Wait blocks until every job returned, which they do once their context
+// is done and the run in progress, if any, finished.
+func (g *Group) Wait() {
+	g.wg.Wait()
+}
+
+// Check fails when a job panicked or has not finished a run in a while.
+func (g *Group) Check(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for name, j := range g.jobs {
+		if j.stopped != nil {
+			return fmt.Errorf("worker %s stopped: %w", name, j.stopped)
+		}
+
+		if since := time.Since(j.lastRun); since > stallAfter*j.interval {
+			return fmt.Errorf("worker %s has not run for %s", name, since.Round(time.Second))
+		}
+	}
+
+	return nil
+}
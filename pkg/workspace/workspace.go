@@ -0,0 +1,156 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+const (
+	// DefaultID is the workspace everything created before workspaces
+	// existed lives in, and the one requests naming no workspace go to.
+	DefaultID = 1
+	// DefaultSlug is the slug of the default workspace.
+	DefaultSlug = "default"
+	// Header names the workspace of a request.
+	Header = "X-Workspace"
+
+	pathPrefix = "/w/"
+)
+
+// ErrConflict is returned when a request names different workspaces in
+// different places.
+var ErrConflict = errors.New("request names more than one workspace")
+
+type workspaceContextKey struct{}
+
+// With returns a copy of ctx carrying the workspace a request was made to.
+func With(ctx context.Context, ws database.Workspace) context.Context {
+	return context.WithValue(ctx, workspaceContextKey{}, ws)
+}
+
+// FromContext returns the workspace stored by With, if any.
+func FromContext(ctx context.Context) (database.Workspace, bool) {
+	ws, ok := ctx.Value(workspaceContextKey{}).(database.Workspace)
+	return ws, ok
+}
+
+// Resolver finds out which workspace a request was made to.
+type Resolver struct {
+	queries *database.Queries
+	domain  string
+}
+
+// NewResolver returns a resolver looking workspaces up in queries. Requests
+// to a subdomain of domain name the workspace through it; an empty domain
+// turns subdomains off.
+func NewResolver(queries *database.Queries, domain string) *Resolver {
+	return &Resolver{queries: queries, domain: strings.ToLower(strings.TrimPrefix(domain, "."))}
+}
+
+// Slug returns the slug a request names its workspace with: a /w/{slug}
+// path prefix, the X-Workspace header or a subdomain, in that order. Every
+// place naming a workspace must name the same one. Requests naming none get
+// the default workspace.
+func (rs *Resolver) Slug(r *http.Request) (string, error) {
+	var slugs []string
+	if slug, _, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, pathPrefix), "/"); ok && strings.HasPrefix(r.URL.Path, pathPrefix) {
+		slugs = append(slugs, slug)
+	}
+
+	if slug := r.Header.Get(Header); slug != "" {
+		slugs = append(slugs, slug)
+	}
+
+	if slug := rs.subdomain(r.Host); slug != "" {
+		slugs = append(slugs, slug)
+	}
+
+	if len(slugs) == 0 {
+		return DefaultSlug, nil
+	}
+
+	for _, slug := range slugs[1:] {
+		if !strings.EqualFold(slug, slugs[0]) {
+			return "", fmt.Errorf("%w: %s and %s", ErrConflict, slugs[0], slug)
+		}
+	}
+
+	return strings.ToLower(slugs[0]), nil
+}
+
+func (rs *Resolver) subdomain(host string) string {
+	if rs.domain == "" {
+		return ""
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	slug, ok := strings.CutSuffix(strings.ToLower(host), "."+rs.domain)
+	if !ok || strings.Contains(slug, ".") {
+		return ""
+	}
+
+	return slug
+}
+
+// Middleware returns a middleware storing the workspace of each request in
+// its context, stripping any /w/{slug} prefix from the path so routes are
+// the same in every workspace. Requests to unknown workspaces are answered
+// with 404 through apierror.
+func (rs *Resolver) Middleware(logger gsdlogger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slug, err := rs.Slug(r)
+			if err != nil {
+				logger.DebugContext(r.Context(), "could not resolve workspace", "err", err)
+				apierror.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			ws, err := rs.queries.GetWorkspaceBySlug(r.Context(), slug)
+			if errors.Is(err, sql.ErrNoRows) {
+				logger.DebugContext(r.Context(), "workspace not found", "slug", slug)
+				apierror.Write(w, http.StatusNotFound, apierror.CodeWorkspaceNotFound, fmt.Sprintf("workspace %s not found", slug))
+				return
+			}
+
+			if err != nil {
+				logger.ErrorContext(r.Context(), "could not get workspace", "slug", slug, "err", err)
+				apierror.Error(w, "could not get workspace", http.StatusInternalServerError)
+				return
+			}
+
+			r = r.WithContext(With(r.Context(), ws))
+			if strings.HasPrefix(r.URL.Path, pathPrefix) {
+				r = stripPrefix(r, pathPrefix+slug)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// stripPrefix is http.StripPrefix for a prefix only known per request,
+// ignoring the case of the slug.
+func stripPrefix(r *http.Request, prefix string) *http.Request {
+	u := *r.URL
+	u.Path = "/" + strings.TrimPrefix(u.Path[len(prefix):], "/")
+	if u.RawPath != "" && len(u.RawPath) >= len(prefix) {
+		u.RawPath = "/" + strings.TrimPrefix(u.RawPath[len(prefix):], "/")
+	}
+
+	r2 := *r
+	r2.URL = &u
+	return &r2
+}
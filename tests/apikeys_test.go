@@ -0,0 +1,232 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+type apiError struct {
+	Error struct {
+		Code      string
+		Message   string
+		RequestID string
+	}
+}
+
+// requestWithKey sends a request authenticated with key, or with no
+// credentials at all when key is empty.
+func requestWithKey(t *testing.T, s target, method, path, key, body string) *http.Response {
+	t.Helper()
+	return s.NewClient(key).Do(method, path, body)
+}
+
+func expectAPIError(t *testing.T, resp *http.Response, status int, code string) {
+	if resp.StatusCode != status {
+		t.Fatalf("expected status code to be %d but got %d", status, resp.StatusCode)
+	}
+
+	var body apiError
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Error.Code != code {
+		t.Fatalf("expected error code to be %s but got %s", code, body.Error.Code)
+	}
+}
+
+func TestAPIKeyRoutes(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	resp := requestWithKey(t, s, http.MethodGet, "/todos", "", "")
+	if resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected 401 to carry a WWW-Authenticate header")
+	}
+	expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+
+	resp = requestWithKey(t, s, http.MethodGet, "/todos", "gsd_0123456789ab_not-the-right-secret", "")
+	expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+
+	resp = requestWithKey(t, s, http.MethodPost, "/api-keys", testAPIKey, `{ "name": "reader", "scopes": ["todos:read"] }`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	var created struct {
+		Key    string
+		APIKey struct {
+			ID     int64
+			Prefix string
+			Scopes []string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(created.Key, "gsd_"+created.APIKey.Prefix+"_") {
+		t.Fatalf("expected key %q to start with its prefix %q", created.Key, created.APIKey.Prefix)
+	}
+
+	resp = requestWithKey(t, s, http.MethodGet, "/todos", created.Key, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", created.Key, `{ "description": "nope" }`)
+	expectAPIError(t, resp, http.StatusForbidden, "forbidden")
+
+	resp = requestWithKey(t, s, http.MethodPost, "/api-keys", created.Key, `{ "name": "escalate", "scopes": ["admin"] }`)
+	expectAPIError(t, resp, http.StatusForbidden, "forbidden")
+
+	resp = requestWithKey(t, s, http.MethodGet, "/api-keys", testAPIKey, "")
+	var keys []struct {
+		ID         int64
+		LastUsedAt sql.NullTime
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range keys {
+		if !key.LastUsedAt.Valid {
+			t.Fatalf("expected key %d to have been used", key.ID)
+		}
+	}
+
+	resp = requestWithKey(t, s, http.MethodDelete, fmt.Sprintf("/api-keys/%d", created.APIKey.ID), testAPIKey, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp = requestWithKey(t, s, http.MethodGet, "/todos", created.Key, "")
+	expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+}
+
+func TestExpiredAPIKey(t *testing.T) {
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	queries, err := database.Connect(ctx, logger, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := queries.CreateUser(ctx, database.CreateUserParams{WorkspaceID: workspace.DefaultID, Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+	key, params, err := auth.NewAPIKey(user.ID, "old", []string{auth.ScopeTodosRead}, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := queries.CreateAPIKey(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	request.Header.Set("X-API-Key", key)
+
+	_, err = auth.NewAPIKeyAuthenticator(logger, queries).Authenticate(request)
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("expected expired key to be rejected but got %v", err)
+	}
+}
+
+func TestEnsureAPIKeyRefusesAnotherSecret(t *testing.T) {
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	queries, err := database.Connect(ctx, logger, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "gsd_0123456789ab_" + strings.Repeat("a", 32)
+	for range 2 {
+		if err := auth.EnsureAPIKey(ctx, queries, "local", key, []string{auth.ScopeAdmin}); err != nil {
+			t.Fatalf("expected the key to be stored once and then kept but got %v", err)
+		}
+	}
+
+	other := "gsd_0123456789ab_" + strings.Repeat("b", 32)
+	if err := auth.EnsureAPIKey(ctx, queries, "local", other, []string{auth.ScopeAdmin}); err == nil {
+		t.Fatal("expected a key with a stored prefix and another secret to be refused")
+	}
+}
+
+func TestAPIKeyLastUsedIsCoarse(t *testing.T) {
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	db, err := database.Open(ctx, logger, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := database.New(db)
+
+	user, err := queries.CreateUser(ctx, database.CreateUserParams{WorkspaceID: workspace.DefaultID, Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, params, err := auth.NewAPIKey(user.ID, "busy", []string{auth.ScopeTodosRead}, sql.NullTime{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := queries.CreateAPIKey(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := auth.NewAPIKeyAuthenticator(logger, queries)
+	lastUsedAfterRequest := func(lastUsed time.Time) time.Time {
+		t.Helper()
+		if _, err := db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", lastUsed, stored.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		request := httptest.NewRequest(http.MethodGet, "/todos", nil)
+		request.Header.Set("X-API-Key", key)
+		if _, err := authenticator.Authenticate(request); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := queries.GetAPIKeyByPrefix(ctx, stored.Prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.LastUsedAt.Time
+	}
+
+	recently := time.Now().UTC().Add(-10 * time.Second).Truncate(time.Second)
+	if got := lastUsedAfterRequest(recently); !got.Equal(recently) {
+		t.Fatalf("expected a key used seconds ago to not be touched but last_used_at moved to %v", got)
+	}
+
+	earlier := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	if got := lastUsedAfterRequest(earlier); !got.After(recently) {
+		t.Fatalf("expected a key used an hour ago to be touched but last_used_at is %v", got)
+	}
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+)
+
+type batchResponse struct {
+	Results []struct {
+		Index  int
+		Op     string
+		ID     int64
+		Status int
+		Todo   *database.Todo
+		Error  string
+	}
+}
+
+func postBatch(t *testing.T, s target, body string, expectedStatus int) batchResponse {
+	t.Helper()
+
+	var batch batchResponse
+	s.NewClient(testAPIKey).JSON(http.MethodPost, "/todos:batch", body, expectedStatus, &batch)
+	return batch
+}
+
+func listTodos(t *testing.T, s target) []database.Todo {
+	t.Helper()
+
+	var todos []database.Todo
+	s.NewClient(testAPIKey).JSON(http.MethodGet, "/todos", nil, http.StatusOK, &todos)
+	return todos
+}
+
+func TestBatchTodosRoute(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	created := postBatch(t, s, `{
+		"operations": [
+			{ "op": "create", "description": "first" },
+			{ "op": "create", "description": "second" },
+			{ "op": "create", "description": "third", "done": true }
+		]
+	}`, http.StatusOK)
+
+	for _, result := range created.Results {
+		if result.Status != http.StatusCreated {
+			t.Fatalf("expected status %d but got %d: %s", http.StatusCreated, result.Status, result.Error)
+		}
+	}
+
+	first, second := created.Results[0].ID, created.Results[1].ID
+
+	aborted := postBatch(t, s, fmt.Sprintf(`{
+		"mode": "atomic",
+		"operations": [
+			{ "op": "update", "id": %d, "done": true },
+			{ "op": "delete", "id": 9999 }
+		]
+	}`, first), http.StatusUnprocessableEntity)
+
+	if aborted.Results[0].Status != http.StatusFailedDependency || aborted.Results[1].Status != http.StatusNotFound {
+		t.Fatalf("expected statuses 424 and 404 but got %+v", aborted.Results)
+	}
+
+	for _, todo := range listTodos(t, s) {
+		if todo.ID == first && todo.Done {
+			t.Fatalf("expected the atomic batch to be rolled back")
+		}
+	}
+
+	partial := postBatch(t, s, fmt.Sprintf(`{
+		"mode": "best_effort",
+		"operations": [
+			{ "op": "update", "id": %d, "done": true },
+			{ "op": "delete", "id": 9999 },
+			{ "op": "delete", "id": %d }
+		]
+	}`, first, second), http.StatusOK)
+
+	if partial.Results[0].Status != http.StatusOK || !partial.Results[0].Todo.Done {
+		t.Fatalf("expected the update to be applied but got %+v", partial.Results[0])
+	}
+
+	if partial.Results[1].Status != http.StatusNotFound || partial.Results[2].Status != http.StatusOK {
+		t.Fatalf("expected statuses 404 and 200 but got %+v", partial.Results)
+	}
+
+	if todos := listTodos(t, s); len(todos) != 2 {
+		t.Fatalf("expected 2 todos left but got %d", len(todos))
+	}
+}
+
+func TestBulkTodoRoutes(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	list := s.Client.CreateList("groceries")
+
+	postBatch(t, s, fmt.Sprintf(`{
+		"operations": [
+			{ "op": "create", "description": "milk", "listId": %d },
+			{ "op": "create", "description": "eggs", "listId": %d },
+			{ "op": "create", "description": "not groceries" }
+		]
+	}`, list.ID, list.ID), http.StatusOK)
+
+	var updated struct{ Updated int64 }
+	s.Client.JSON(http.MethodPost, fmt.Sprintf("/lists/%d/todos:markDone", list.ID), nil, http.StatusOK, &updated)
+
+	if updated.Updated != 2 {
+		t.Fatalf("expected 2 todos to be marked as done but got %d", updated.Updated)
+	}
+
+	var deleted struct{ Deleted int64 }
+	s.Client.JSON(http.MethodPost, "/todos:deleteCompleted", nil, http.StatusOK, &deleted)
+
+	if deleted.Deleted != 2 {
+		t.Fatalf("expected 2 todos to be deleted but got %d", deleted.Deleted)
+	}
+
+	todos := listTodos(t, s)
+	if len(todos) != 1 || todos[0].Description != "not groceries" {
+		t.Fatalf("expected only the todo outside the list to be left but got %+v", todos)
+	}
+}
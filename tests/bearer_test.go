@@ -0,0 +1,291 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+const (
+	testJWTIssuer   = "https://platform.example"
+	testJWTAudience = "gogsd"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signEdDSA(t *testing.T, kid string, key ed25519.PrivateKey, claims map[string]any) string {
+	signed := jwtSigningInput(t, "EdDSA", kid, claims)
+	return signed + "." + b64(ed25519.Sign(key, []byte(signed)))
+}
+
+func signES256(t *testing.T, kid string, key *ecdsa.PrivateKey, claims map[string]any) string {
+	signed := jwtSigningInput(t, "ES256", kid, claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signed + "." + b64(signature)
+}
+
+func jwtSigningInput(t *testing.T, alg, kid string, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b64(header) + "." + b64(payload)
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func bearerClaims(subject string, scopes any) map[string]any {
+	return map[string]any{
+		"iss":   testJWTIssuer,
+		"aud":   []string{testJWTAudience, "other-service"},
+		"sub":   subject,
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"scope": scopes,
+	}
+}
+
+func TestJWTBearerTokens(t *testing.T) {
+	t.Parallel()
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath,
+		map[string]string{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "x": b64(edPublic)},
+		map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"kid": "ec",
+			"x":   b64(ecKey.X.FillBytes(make([]byte, 32))),
+			"y":   b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+	)
+
+	lookupEnv := func(key string) (string, bool) {
+		switch key {
+		case "JWT_ISSUER":
+			return testJWTIssuer, true
+		case "JWT_AUDIENCE":
+			return testJWTAudience, true
+		case "JWT_JWKS_FILE":
+			return jwksPath, true
+		default:
+			return testLookupEnv(key)
+		}
+	}
+
+	s := startServer(t, gsdlogger.NewLogger(os.Stdout, slog.LevelDebug), testConfig(t, lookupEnv))
+
+	reader := signEdDSA(t, "ed", edKey, bearerClaims("reporting", "todos:read"))
+	resp := requestWithKey(t, s, http.MethodGet, "/todos", reader, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", reader, `{ "description": "not allowed" }`)
+	expectAPIError(t, resp, http.StatusForbidden, "forbidden")
+
+	claims := bearerClaims("importer", nil)
+	claims["scp"] = []string{"todos:read", "todos:write", "unknown:scope"}
+	writer := signES256(t, "ec", ecKey, claims)
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", writer, `{ "description": "imported" }`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	// a token that expired within the clock skew is still accepted.
+	claims = bearerClaims("reporting", "todos:read")
+	claims["exp"] = time.Now().Add(-10 * time.Second).Unix()
+	resp = requestWithKey(t, s, http.MethodGet, "/todos", signEdDSA(t, "ed", edKey, claims), "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := map[string]string{
+		"expired": signEdDSA(t, "ed", edKey, func() map[string]any {
+			claims := bearerClaims("reporting", "todos:read")
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return claims
+		}()),
+		"not valid yet": signEdDSA(t, "ed", edKey, func() map[string]any {
+			claims := bearerClaims("reporting", "todos:read")
+			claims["nbf"] = time.Now().Add(time.Hour).Unix()
+			return claims
+		}()),
+		"wrong issuer": signEdDSA(t, "ed", edKey, func() map[string]any {
+			claims := bearerClaims("reporting", "todos:read")
+			claims["iss"] = "https://elsewhere.example"
+			return claims
+		}()),
+		"wrong audience": signEdDSA(t, "ed", edKey, func() map[string]any {
+			claims := bearerClaims("reporting", "todos:read")
+			claims["aud"] = "other-service"
+			return claims
+		}()),
+		"bad signature":  signEdDSA(t, "ed", otherKey, bearerClaims("reporting", "todos:read")),
+		"unknown key":    signEdDSA(t, "rotated", edKey, bearerClaims("reporting", "todos:read")),
+		"alg none":       jwtSigningInput(t, "none", "ed", bearerClaims("reporting", "todos:read")) + ".",
+		"mismatched alg": signES256(t, "ed", ecKey, bearerClaims("reporting", "todos:read")),
+	}
+
+	for name, token := range rejected {
+		t.Run(name, func(t *testing.T) {
+			resp := requestWithKey(t, s, http.MethodGet, "/todos", token, "")
+			expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+		})
+	}
+
+	// tokens only work in the workspace of the config, so they create no
+	// users anywhere else.
+	expectStatus(t, requestWithKey(t, s, http.MethodPost, "/workspaces", testAPIKey, `{ "slug": "acme", "name": "Acme" }`), http.StatusCreated)
+	resp = requestWithKey(t, s, http.MethodGet, "/w/acme/todos", signEdDSA(t, "ed", edKey, bearerClaims("intruder", "todos:read")), "")
+	expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+
+	// an admin scope reaches everything in the workspace of the token, but
+	// users created from tokens never manage the instance.
+	admin := signEdDSA(t, "ed", edKey, bearerClaims("operator", "admin"))
+	resp = requestWithKey(t, s, http.MethodGet, "/todos", admin, "")
+	expectStatus(t, resp, http.StatusOK)
+	resp = requestWithKey(t, s, http.MethodGet, "/workspaces", admin, "")
+	expectAPIError(t, resp, http.StatusForbidden, "forbidden")
+
+	// replacing the file rotates keys without a restart.
+	rotatedPublic, rotatedKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeJWKS(t, jwksPath, map[string]string{"kty": "OKP", "crv": "Ed25519", "kid": "rotated", "x": b64(rotatedPublic)})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(jwksPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = requestWithKey(t, s, http.MethodGet, "/todos", signEdDSA(t, "rotated", rotatedKey, bearerClaims("reporting", "todos:read")), "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp = requestWithKey(t, s, http.MethodGet, "/todos", reader, "")
+	expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+}
+
+func TestRemoteJWKSKeepsServingKeys(t *testing.T) {
+	t.Parallel()
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys are stale as soon as they are served, and the issuer goes
+	// down right after serving them once.
+	var fetches atomic.Int64
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=0")
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "x": b64(edPublic)}},
+		})
+	}))
+	t.Cleanup(issuer.Close)
+
+	lookupEnv := func(key string) (string, bool) {
+		switch key {
+		case "JWT_ISSUER":
+			return testJWTIssuer, true
+		case "JWT_AUDIENCE":
+			return testJWTAudience, true
+		case "JWT_JWKS_URL":
+			return issuer.URL, true
+		default:
+			return testLookupEnv(key)
+		}
+	}
+
+	s := startServer(t, gsdlogger.NewLogger(os.Stdout, slog.LevelDebug), testConfig(t, lookupEnv))
+	reader := signEdDSA(t, "ed", edKey, bearerClaims("reporting", "todos:read"))
+
+	// concurrent requests share a single fetch.
+	var wg sync.WaitGroup
+	statuses := make(chan int, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- requestWithKey(t, s, http.MethodGet, "/todos", reader, "").StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	for status := range statuses {
+		if status != http.StatusOK {
+			t.Fatalf("expected status code to be %d but got %d", http.StatusOK, status)
+		}
+	}
+
+	// stale keys are served while the issuer can not be fetched from again.
+	resp := requestWithKey(t, s, http.MethodGet, "/todos", reader, "")
+	expectStatus(t, resp, http.StatusOK)
+
+	if got := fetches.Load(); got != 1 {
+		t.Fatalf("expected the keys to be fetched once but they were fetched %d times", got)
+	}
+}
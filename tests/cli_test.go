@@ -0,0 +1,267 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/cli"
+	"github.com/juancortelezzi/gogsd/pkg/client"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+// gogsd runs the command line client with args and an empty configuration
+// file, so the configuration of whoever runs the tests is not read.
+func gogsd(t *testing.T, env map[string]string, args ...string) (status int, stdout, stderr string) {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "cli.toml")
+	if err := os.WriteFile(configPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(args) > 0 && args[0] != "help" {
+		args = append([]string{args[0], "-config", configPath}, args[1:]...)
+	}
+
+	var out, errOut bytes.Buffer
+	status = cli.Run(context.Background(), args, &out, &errOut, envOf(env))
+	return status, out.String(), errOut.String()
+}
+
+// mustGogsd runs gogsd against s and fails the test unless it exits with 0.
+func mustGogsd(t *testing.T, s *gogsdtest.Server, args ...string) string {
+	t.Helper()
+
+	env := map[string]string{"GOGSD_SERVER": s.URL, "GOGSD_API_KEY": gogsdtest.APIKey}
+	status, stdout, stderr := gogsd(t, env, args...)
+	if status != 0 {
+		t.Fatalf("gogsd %s exited with %d: %s", strings.Join(args, " "), status, stderr)
+	}
+	return stdout
+}
+
+func decodeTodos(t *testing.T, stdout string) []client.Todo {
+	t.Helper()
+
+	var todos []client.Todo
+	if err := json.Unmarshal([]byte(stdout), &todos); err != nil {
+		t.Fatalf("decoding %q: %v", stdout, err)
+	}
+	return todos
+}
+
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func TestCLITodos(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	added := decodeTodos(t, mustGogsd(t, s, "add", "-o", "json", "buy", "milk"))
+	if len(added) != 1 || added[0].Description != "buy milk" || added[0].Role != "owner" {
+		t.Fatalf("add printed %+v", added)
+	}
+	id := added[0].ID
+	other := s.NewTodo().Description("walk the dog").Create()
+
+	tagged := decodeTodos(t, mustGogsd(t, s, "tag", "-o", "json", itoa(id), "#Errands", "home"))
+	if tagged[0].Description != "buy milk #Errands #home" {
+		t.Fatalf("tag printed %q", tagged[0].Description)
+	}
+	untagged := decodeTodos(t, mustGogsd(t, s, "tag", "-o", "json", "-remove", itoa(id), "home"))
+	if untagged[0].Description != "buy milk #Errands" {
+		t.Fatalf("tag -remove printed %q", untagged[0].Description)
+	}
+
+	// removing tags leaves the rest of the text as it was written.
+	spaced := s.NewTodo().Description("#home  call\tmom\n#Home about #homework #home").Create()
+	untagged = decodeTodos(t, mustGogsd(t, s, "tag", "-o", "json", "-remove", itoa(spaced.ID), "home"))
+	if untagged[0].Description != "call\tmom about #homework" {
+		t.Fatalf("tag -remove printed %q", untagged[0].Description)
+	}
+	mustGogsd(t, s, "rm", itoa(spaced.ID))
+
+	if ls := decodeTodos(t, mustGogsd(t, s, "ls", "-o", "json", "-tag", "errands")); len(ls) != 1 || ls[0].ID != id {
+		t.Fatalf("ls -tag errands printed %+v", ls)
+	}
+	if found := decodeTodos(t, mustGogsd(t, s, "search", "-o", "json", "DOG")); len(found) != 1 || found[0].ID != other.ID {
+		t.Fatalf("search DOG printed %+v", found)
+	}
+
+	done := decodeTodos(t, mustGogsd(t, s, "done", "-o", "json", itoa(id)))
+	if !done[0].Done {
+		t.Fatalf("done printed %+v", done)
+	}
+	if open := decodeTodos(t, mustGogsd(t, s, "ls", "-o", "json", "-open")); len(open) != 1 || open[0].ID != other.ID {
+		t.Fatalf("ls -open printed %+v", open)
+	}
+
+	edited := decodeTodos(t, mustGogsd(t, s, "edit", "-o", "json", itoa(other.ID), "walk", "the", "cat"))
+	if edited[0].Description != "walk the cat" {
+		t.Fatalf("edit printed %q", edited[0].Description)
+	}
+
+	plain := mustGogsd(t, s, "ls", "-o", "plain")
+	want := itoa(id) + "\ttrue\tbuy milk #Errands\n" + itoa(other.ID) + "\tfalse\twalk the cat\n"
+	if plain != want {
+		t.Fatalf("ls -o plain printed %q, want %q", plain, want)
+	}
+
+	table := mustGogsd(t, s, "ls")
+	if !strings.HasPrefix(table, "ID") || !strings.Contains(table, "walk the cat") {
+		t.Fatalf("ls printed %q", table)
+	}
+
+	// the todos of a list are fetched from the list, with the caller's role.
+	list := s.Client.CreateList("groceries")
+	inList := s.NewTodo().Description("buy eggs").InList(list.ID).Create()
+	if ls := decodeTodos(t, mustGogsd(t, s, "ls", "-o", "json", "-list", itoa(list.ID))); len(ls) != 1 || ls[0].ID != inList.ID || ls[0].Role != "owner" {
+		t.Fatalf("ls -list printed %+v", ls)
+	}
+	mustGogsd(t, s, "rm", itoa(inList.ID))
+
+	mustGogsd(t, s, "rm", itoa(id), itoa(other.ID))
+	if ls := decodeTodos(t, mustGogsd(t, s, "ls", "-o", "json")); len(ls) != 0 {
+		t.Fatalf("ls after rm printed %+v", ls)
+	}
+}
+
+func TestCLIErrors(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+	env := map[string]string{"GOGSD_SERVER": s.URL, "GOGSD_API_KEY": gogsdtest.APIKey}
+
+	tests := []struct {
+		name   string
+		env    map[string]string
+		args   []string
+		status int
+		stderr string
+	}{
+		{"unknown command", env, []string{"frobnicate"}, 2, "unknown command"},
+		{"bad id", env, []string{"done", "first"}, 2, `"first" is not the id of a todo`},
+		{"bad output", env, []string{"ls", "-o", "yaml"}, 2, "invalid configuration"},
+		{"offline without database", env, []string{"ls", "-offline"}, 2, "invalid configuration"},
+		{"missing todo", env, []string{"done", "12345"}, 1, "gogsd done:"},
+		{"no key", map[string]string{"GOGSD_SERVER": s.URL}, []string{"ls"}, 1, "gogsd ls:"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, _, stderr := gogsd(t, test.env, test.args...)
+			if status != test.status || !strings.Contains(stderr, test.stderr) {
+				t.Fatalf("got status %d and %q, want %d and %q", status, stderr, test.status, test.stderr)
+			}
+		})
+	}
+}
+
+func TestCLIOffline(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "gogsd.db")
+	env := map[string]string{"DATABASE_URL": path}
+
+	// offline commands never create or migrate a database.
+	status, _, stderr := gogsd(t, env, "ls", "-offline")
+	if status == 0 || !strings.Contains(stderr, "could not open database") {
+		t.Fatalf("expected a missing database to be refused but got %d: %s", status, stderr)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no database to be created but got %v", err)
+	}
+
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(io.Discard, slog.LevelError)
+	oldPath := filepath.Join(t.TempDir(), "old.db")
+	for _, dsl := range []string{path, oldPath} {
+		db, err := database.Open(ctx, logger, dsl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		// the old database was left behind by an older server.
+		if dsl == oldPath {
+			if _, err := db.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = (SELECT MAX(version) FROM schema_migrations)"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	status, _, stderr = gogsd(t, map[string]string{"DATABASE_URL": oldPath}, "ls", "-offline")
+	if status == 0 || !strings.Contains(stderr, "missing 1 migrations") {
+		t.Fatalf("expected a database missing migrations to be refused but got %d: %s", status, stderr)
+	}
+
+	run := func(args ...string) string {
+		t.Helper()
+		status, stdout, stderr := gogsd(t, env, append(args, "-offline")...)
+		if status != 0 {
+			t.Fatalf("gogsd %s exited with %d: %s", strings.Join(args, " "), status, stderr)
+		}
+		return stdout
+	}
+
+	added := decodeTodos(t, run("add", "-o", "json", "water", "plants"))
+	run("done", itoa(added[0].ID))
+
+	// every command opens the database again, so this reads what add wrote.
+	if plain := run("ls", "-o", "plain"); plain != itoa(added[0].ID)+"\ttrue\twater plants\n" {
+		t.Fatalf("ls printed %q", plain)
+	}
+}
+
+func TestCLIConfigFile(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+	s.NewTodo().Description("from the server").Create()
+
+	configPath := filepath.Join(t.TempDir(), "cli.toml")
+	config := "server = \"" + s.URL + "\"\napi_key = \"" + gogsdtest.APIKey + "\"\noutput = \"json\"\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the environment overrides the file, and flags override both.
+	env := envOf(map[string]string{"GOGSD_CONFIG": configPath, "GOGSD_OUTPUT": "table"})
+	var stdout, stderr bytes.Buffer
+	if status := cli.Run(context.Background(), []string{"ls", "-o", "plain"}, &stdout, &stderr, env); status != 0 {
+		t.Fatalf("ls exited with %d: %s", status, stderr.String())
+	}
+	if !strings.HasSuffix(stdout.String(), "\tfalse\tfrom the server\n") {
+		t.Fatalf("ls printed %q", stdout.String())
+	}
+}
+
+func TestCLICompletion(t *testing.T) {
+	t.Parallel()
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		status, stdout, stderr := gogsd(t, nil, "completion", shell)
+		if status != 0 {
+			t.Fatalf("completion %s exited with %d: %s", shell, status, stderr)
+		}
+		for _, want := range []string{"search", "remove", "offline"} {
+			if !strings.Contains(stdout, want) {
+				t.Errorf("completion %s does not complete %s", shell, want)
+			}
+		}
+	}
+
+	if status, _, _ := gogsd(t, nil, "completion", "powershell"); status != 2 {
+		t.Fatalf("completion powershell exited with %d, want 2", status)
+	}
+}
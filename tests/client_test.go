@@ -0,0 +1,253 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/client"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+)
+
+// newSDKClient returns a client of s authenticated with key.
+func newSDKClient(t *testing.T, s *gogsdtest.Server, key string, opts ...client.Option) *client.Client {
+	t.Helper()
+
+	var transport http.RoundTripper = s.Server.Client().Transport
+	if key != "" {
+		transport = &client.BearerTransport{Token: key, Base: transport}
+	}
+
+	opts = append([]client.Option{
+		client.WithTransport(transport),
+		client.WithRetries(3, time.Millisecond, 10*time.Millisecond),
+	}, opts...)
+
+	c, err := client.New(s.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientTodos(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+	c := newSDKClient(t, s, gogsdtest.APIKey)
+	ctx := context.Background()
+
+	created, err := c.CreateTodo(ctx, client.TodoParams{Description: "write the client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.GetTodo(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Description != "write the client" || got.Role != "owner" {
+		t.Fatalf("expected the created todo owned by the caller but got %+v", got)
+	}
+
+	updated, err := c.UpdateTodo(ctx, created.ID, client.TodoParams{Description: "test the client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Description != "test the client" {
+		t.Fatalf("expected the description to be replaced but got %q", updated.Description)
+	}
+
+	done := true
+	patched, err := c.PatchTodo(ctx, created.ID, client.TodoPatch{Done: &done}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patched.Done || patched.Description != "test the client" {
+		t.Fatalf("expected only done to change but got %+v", patched)
+	}
+
+	// a patch made from a copy read before the last change conflicts.
+	stale := "from a stale copy"
+	_, err = c.PatchTodo(ctx, created.ID, client.TodoPatch{Description: &stale, Version: &updated.Version}, false)
+	if !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("expected a stale patch to conflict but got %v", err)
+	}
+
+	if err := c.DeleteTodo(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.GetTodo(ctx, created.ID)
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("expected the todo to be gone but got %v", err)
+	}
+}
+
+func TestClientTodoIterator(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+	c := newSDKClient(t, s, gogsdtest.APIKey)
+	ctx := context.Background()
+
+	want := s.NewTodo().CreateN(5)
+	list := s.Client.CreateList("groceries")
+	want = append(want, s.NewTodo().InList(list.ID).CreateN(2)...)
+
+	// deleting the todos already seen does not make the iterator skip any
+	it := c.Todos(ctx, 2)
+	var got []int64
+	for it.Next() {
+		got = append(got, it.Todo().ID)
+		if err := c.DeleteTodo(ctx, it.Todo().ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d todos but got %v", len(want), got)
+	}
+	for i, todo := range want {
+		if got[i] != todo.ID {
+			t.Fatalf("expected todo %d at %d but got %v", todo.ID, i, got)
+		}
+	}
+
+	want = s.NewTodo().CreateN(5)
+	page, err := c.ListTodos(ctx, client.Page{Limit: 2, Offset: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != want[4].ID {
+		t.Fatalf("expected the last todo alone but got %+v", page)
+	}
+
+	resp := s.Client.Do(http.MethodGet, "/todos?limit=0", nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp = s.Client.Do(http.MethodGet, "/todos?after=1:2", nil)
+	expectStatus(t, resp, http.StatusBadRequest)
+}
+
+func TestClientBatch(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+	c := newSDKClient(t, s, gogsdtest.APIKey)
+	ctx := context.Background()
+
+	description := "created in a batch"
+	results, err := c.Batch(ctx, client.BatchAtomic, []client.BatchOperation{
+		{Op: client.OpCreate, Description: &description},
+		{Op: client.OpDelete, ID: 999},
+	})
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected the batch to fail with 422 but got %v", err)
+	}
+	if len(results) != 2 || results[1].Status != http.StatusNotFound {
+		t.Fatalf("expected the delete to be reported as not found but got %+v", results)
+	}
+
+	results, err = c.Batch(ctx, "", []client.BatchOperation{{Op: client.OpCreate, Description: &description}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Todo == nil || results[0].Todo.Description != description {
+		t.Fatalf("expected the todo to be created but got %+v", results)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+	ctx := context.Background()
+
+	_, err := newSDKClient(t, s, "").ListTodos(ctx, client.Page{})
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected a client.Error but got %v", err)
+	}
+	if apiErr.Code != apierror.CodeUnauthenticated || apiErr.RequestID == "" {
+		t.Fatalf("expected the error body to be decoded but got %+v", apiErr)
+	}
+	if !errors.Is(err, client.ErrUnauthenticated) {
+		t.Fatalf("expected %v to be ErrUnauthenticated", err)
+	}
+
+	_, err = newSDKClient(t, s, gogsdtest.APIKey).CreateTodo(ctx, client.TodoParams{})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != apierror.CodeBadRequest || apiErr.RequestID == "" {
+		t.Fatalf("expected a validation error but got %v", err)
+	}
+	if !strings.Contains(apiErr.Message, "validation fail") {
+		t.Fatalf("expected the message of the server but got %q", apiErr.Message)
+	}
+}
+
+// flakyTransport answers the first failures requests with 503 without
+// sending them.
+type flakyTransport struct {
+	failures int32
+	calls    atomic.Int32
+	next     http.RoundTripper
+}
+
+func (t *flakyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.calls.Add(1) <= t.failures {
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{"Retry-After": {"0"}},
+			Body:       io.NopCloser(strings.NewReader("try again")),
+			Request:    r,
+		}, nil
+	}
+	return t.next.RoundTrip(r)
+}
+
+func TestClientRetriesIdempotentCalls(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+	ctx := context.Background()
+
+	flaky := &flakyTransport{failures: 2, next: s.Server.Client().Transport}
+	c := newSDKClient(t, s, "", client.WithTransport(&client.BearerTransport{Token: gogsdtest.APIKey, Base: flaky}))
+
+	if _, err := c.ListTodos(ctx, client.Page{}); err != nil {
+		t.Fatalf("expected the list to be retried until it worked but got %v", err)
+	}
+	if calls := flaky.calls.Load(); calls != 3 {
+		t.Fatalf("expected 3 calls but got %d", calls)
+	}
+
+	flaky.calls.Store(0)
+	_, err := c.CreateTodo(ctx, client.TodoParams{Description: "only once"})
+	if !isStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("expected the create to fail without retries but got %v", err)
+	}
+	if calls := flaky.calls.Load(); calls != 1 {
+		t.Fatalf("expected the create to be sent once but got %d calls", calls)
+	}
+
+	flaky.calls.Store(0)
+	flaky.failures = 10
+	_, err = c.ListTodos(ctx, client.Page{})
+	if !isStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("expected the list to give up with 503 but got %v", err)
+	}
+	if calls := flaky.calls.Load(); calls != 4 {
+		t.Fatalf("expected 1 call and 3 retries but got %d calls", calls)
+	}
+}
+
+func isStatus(err error, status int) bool {
+	var apiErr *client.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+)
+
+func envOf(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, found := env[key]
+		return value, found
+	}
+}
+
+func TestConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"gogsd.toml": `
+[listen]
+port = 4000
+
+[database]
+url = "from-file.db"
+
+[log]
+level = "warn"
+
+[timeouts]
+shutdown = "30s"
+
+[rate_limit]
+read = "10/1m"
+trusted_proxies = ["10.0.0.0/8"]
+`,
+		"gogsd.yaml": `
+listen:
+  port: 4000
+database:
+  url: from-file.db
+log:
+  level: warn
+timeouts:
+  shutdown: 30s
+rate_limit:
+  read: 10/1m
+  trusted_proxies: [10.0.0.0/8]
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		env := envOf(map[string]string{
+			"CONFIG_FILE":     path,
+			"PORT":            "5000",
+			"RATE_LIMIT_READ": "20/1m",
+		})
+
+		cfg, err := config.Load([]string{"-log.level", "error", "-features.registration=false"}, env)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if cfg.Listen.Port != 5000 || cfg.RateLimit.Read != "20/1m" {
+			t.Fatalf("%s: expected the environment to win over the file but got %+v", name, cfg)
+		}
+
+		if cfg.Log.Level != "error" || cfg.Features.Registration {
+			t.Fatalf("%s: expected flags to win over everything but got %+v", name, cfg)
+		}
+
+		if cfg.Database.URL != "from-file.db" || cfg.Timeouts.Shutdown != 30*time.Second || len(cfg.RateLimit.TrustedProxies) != 1 {
+			t.Fatalf("%s: expected the file to win over the defaults but got %+v", name, cfg)
+		}
+
+		if cfg.Listen.Host != "127.0.0.1" || cfg.RateLimit.Write != "120/1m" {
+			t.Fatalf("%s: expected defaults for what nothing set but got %+v", name, cfg)
+		}
+	}
+}
+
+func TestConfigReportsEveryProblem(t *testing.T) {
+	env := envOf(map[string]string{
+		"PORT":                    "not-a-port",
+		"SHUTDOWN_TIMEOUT":        "soon",
+		"OTEL_TRACES_SAMPLER_ARG": "lots",
+	})
+
+	_, err := config.Load(nil, env)
+	if err == nil {
+		t.Fatal("expected the configuration to be rejected")
+	}
+
+	for _, problem := range []string{"PORT", "SHUTDOWN_TIMEOUT", "OTEL_TRACES_SAMPLER_ARG"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Fatalf("expected %s to be reported but got:\n%v", problem, err)
+		}
+	}
+
+	env = envOf(map[string]string{
+		"LOG_LEVEL":       "loud",
+		"RATE_LIMIT_AUTH": "lots",
+		"OIDC_ISSUER":     "https://issuer.example",
+	})
+
+	_, err = config.Load(nil, env)
+	if err == nil {
+		t.Fatal("expected the configuration to be rejected")
+	}
+
+	for _, problem := range []string{"listen.port", "database.url", "log.level", "rate_limit.auth", "auth.oidc.client_id"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Fatalf("expected %s to be reported but got:\n%v", problem, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "gogsd.toml")
+	if err := os.WriteFile(path, []byte("[listen]\nprot = 3000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := config.Load([]string{"-config", path}, testLookupEnv); err == nil || !strings.Contains(err.Error(), "listen.prot") {
+		t.Fatalf("expected the misspelled setting to be reported but got %v", err)
+	}
+}
+
+func TestConfigPrintRedactsSecrets(t *testing.T) {
+	env := envOf(map[string]string{
+		"PORT":               "3000",
+		"DATABASE_URL":       "gogsd.db",
+		"BOOTSTRAP_API_KEY":  "super-secret-key",
+		"OIDC_ISSUER":        "https://issuer.example",
+		"OIDC_CLIENT_ID":     "gogsd",
+		"OIDC_CLIENT_SECRET": "super-secret-client",
+		"OIDC_REDIRECT_URL":  "https://gogsd.example/auth/oidc/callback",
+	})
+
+	cfg, err := config.Load(nil, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(out.String(), "super-secret") {
+		t.Fatalf("expected secrets to be redacted but got:\n%s", out.String())
+	}
+
+	for _, line := range []string{`bootstrap_api_key = "REDACTED"`, `client_secret = "REDACTED"`, `client_id = "gogsd"`, "port = 3000"} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("expected %q to be printed but got:\n%s", line, out.String())
+		}
+	}
+
+	if cfg.Auth.BootstrapAPIKey != "super-secret-key" {
+		t.Fatalf("expected printing to leave the configuration alone")
+	}
+}
+
+func TestRegistrationCanBeTurnedOff(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t, gogsdtest.WithConfig(func(cfg *config.Config) {
+		cfg.Features.Registration = false
+	}))
+
+	resp := requestWithKey(t, s, http.MethodPost, "/auth/register", "", `{ "name": "someone", "password": "correct horse battery" }`)
+	expectStatus(t, resp, http.StatusNotFound)
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+)
+
+func TestTodoDependencyRoutes(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	ids := map[string]int64{}
+	for _, description := range []string{"deploy", "migrate", "backup", "docs"} {
+		ids[description] = s.Client.CreateTodo(gogsdtest.TodoParams{Description: description}).ID
+	}
+
+	block := func(todo, blocker string, expectedStatus int) {
+		resp := s.Client.Do(http.MethodPost, fmt.Sprintf("/todos/%d/blockers", ids[todo]), fmt.Sprintf(`{ "blockerId": %d }`, ids[blocker]))
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("expected blocking %s by %s to answer %d but got %d", todo, blocker, expectedStatus, resp.StatusCode)
+		}
+	}
+
+	block("deploy", "migrate", http.StatusCreated)
+	block("migrate", "backup", http.StatusCreated)
+
+	// backup -> migrate -> deploy -> backup would never finish
+	block("backup", "deploy", http.StatusConflict)
+	block("docs", "docs", http.StatusConflict)
+
+	var blocking []database.Todo
+	s.Client.JSON(http.MethodGet, fmt.Sprintf("/todos/%d/blocking", ids["migrate"]), nil, http.StatusOK, &blocking)
+
+	if len(blocking) != 1 || blocking[0].ID != ids["deploy"] {
+		t.Fatalf("expected migrate to only block deploy but got %v", blocking)
+	}
+
+	var ready []struct {
+		Todo  database.Todo
+		Depth int
+	}
+	s.Client.JSON(http.MethodGet, "/todos:ready", nil, http.StatusOK, &ready)
+
+	var order []string
+	for _, item := range ready {
+		order = append(order, fmt.Sprintf("%s:%d", item.Todo.Description, item.Depth))
+	}
+
+	expectedOrder := "backup:0 docs:0 migrate:1 deploy:2"
+	if got := strings.Join(order, " "); got != expectedOrder {
+		t.Fatalf("expected ready todos to be %q but got %q", expectedOrder, got)
+	}
+
+	complete := func(todo, query string, expectedStatus int) {
+		path := fmt.Sprintf("/todos/%d%s", ids[todo], query)
+		resp := s.Client.Do(http.MethodPut, path, fmt.Sprintf(`{ "description": "%s", "done": true }`, todo))
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("expected completing %s%s to answer %d but got %d", todo, query, expectedStatus, resp.StatusCode)
+		}
+	}
+
+	complete("migrate", "", http.StatusConflict)
+	complete("backup", "", http.StatusOK)
+	complete("migrate", "", http.StatusOK)
+
+	resp := s.Client.Do(http.MethodDelete, fmt.Sprintf("/todos/%d/blockers/%d", ids["deploy"], ids["migrate"]), nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	block("deploy", "docs", http.StatusCreated)
+	complete("deploy", "", http.StatusConflict)
+	complete("deploy", "?force=true", http.StatusOK)
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+func TestRequestBodiesAreStrict(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t, gogsdtest.WithConfig(func(cfg *config.Config) {
+		cfg.Limits.MaxBodyBytes = 128
+	}))
+
+	resp := requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "fits" }`)
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "`+strings.Repeat("a", 200)+`" }`)
+	expectAPIError(t, resp, http.StatusRequestEntityTooLarge, "request_too_large")
+
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "fits" }`+strings.Repeat(" ", 200))
+	expectAPIError(t, resp, http.StatusRequestEntityTooLarge, "request_too_large")
+
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "typo", "dnoe": true }`)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "one" } { "description": "two" }`)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "trailing space" }`+"\n")
+	expectStatus(t, resp, http.StatusCreated)
+}
+
+func TestServerTimeoutsAndHeaderLimit(t *testing.T) {
+	t.Parallel()
+	var s *testServer
+	{
+		lookupEnv := func(key string) (string, bool) {
+			switch key {
+			case "READ_HEADER_TIMEOUT":
+				return "200ms", true
+			case "MAX_HEADER_BYTES":
+				return "1024", true
+			}
+			return testLookupEnv(key)
+		}
+
+		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+		s = startServer(t, logger, testConfig(t, lookupEnv))
+	}
+
+	// net/http reads a few buffers over the limit before answering 431.
+	resp := requestWithHeaders(t, s, http.MethodGet, "/ping", map[string]string{"X-Padding": strings.Repeat("a", 32<<10)}, "")
+	expectStatus(t, resp, http.StatusRequestHeaderFieldsTooLarge)
+
+	conn, err := s.Dial(context.Background(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "GET /ping HTTP/1.1\r\nHost: gogsd\r\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server gives up on a client that never finishes its headers.
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != io.EOF {
+		t.Fatalf("expected the connection to be closed but got %v", err)
+	}
+}
+
+func TestFileDatabasesTakeConcurrentWrites(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	db, err := database.Open(ctx, logger, filepath.Join(t.TempDir(), "gogsd.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var journalMode string
+	if err := db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if journalMode != "wal" {
+		t.Fatalf("expected the database to be in wal mode but got %q", journalMode)
+	}
+
+	queries := database.New(db)
+	user, err := queries.CreateUser(ctx, database.CreateUserParams{WorkspaceID: workspace.DefaultID, Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// transactions on several connections wait for each other rather than
+	// failing with SQLITE_BUSY.
+	errs := make(chan error, 20)
+	for i := range 20 {
+		go func() {
+			errs <- queries.ExecTx(ctx, func(tx *database.Queries) error {
+				if _, err := tx.ListTodos(ctx, user.ID); err != nil {
+					return err
+				}
+
+				_, err := tx.CreateTodo(ctx, database.CreateTodoParams{UserID: user.ID, Description: fmt.Sprint(i)})
+				return err
+			})
+		}()
+	}
+
+	for range 20 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := db.Stats(); stats.MaxOpenConnections == 1 {
+		t.Fatal("expected file databases to not be limited to a single connection")
+	}
+}
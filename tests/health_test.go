@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/health"
+	"github.com/juancortelezzi/gogsd/pkg/server"
+	"github.com/juancortelezzi/gogsd/pkg/worker"
+)
+
+func probe(t *testing.T, c *gogsdtest.Client, path string) (int, health.Report) {
+	t.Helper()
+
+	resp := c.Do(http.MethodGet, path, nil)
+
+	var report health.Report
+	decodeBody(t, resp, &report)
+	return resp.StatusCode, report
+}
+
+func checkStatus(report health.Report, name string) string {
+	for _, result := range report.Checks {
+		if result.Name == name {
+			return result.Status
+		}
+	}
+	return ""
+}
+
+func TestHealthProbes(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	stopped := make(chan struct{})
+	var c *gogsdtest.Client
+	{
+		lookupEnv := func(key string) (string, bool) {
+			switch key {
+			case "DATABASE_URL":
+				return filepath.Join(t.TempDir(), "gogsd.db"), true
+			case "SHUTDOWN_DRAIN_DELAY":
+				return "500ms", true
+			}
+			return testLookupEnv(key)
+		}
+
+		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+		cfg := testConfig(t, lookupEnv)
+		s, err := server.New(ctx, logger, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			s.Run(ctx)
+			close(stopped)
+		}()
+		<-s.Ready()
+		c = newTestServer(t, cfg.Listen.SocketPath).NewClient("")
+	}
+
+	status, report := probe(t, c, "/healthz")
+	if status != http.StatusOK || report.Status != health.StatusOK || checkStatus(report, "workers") != "" {
+		t.Fatalf("expected the server to be alive but got %d %+v", status, report)
+	}
+
+	status, report = probe(t, c, "/readyz")
+	if status != http.StatusOK || report.Status != health.StatusOK || checkStatus(report, "workers") != health.StatusOK {
+		t.Fatalf("expected the server to be ready but got %d %+v", status, report)
+	}
+
+	for _, name := range []string{"database", "migrations", "disk"} {
+		if checkStatus(report, name) != health.StatusOK {
+			t.Fatalf("expected the %s check to pass but got %+v", name, report)
+		}
+	}
+
+	cancel()
+
+	// shutdown starts as soon as Run notices, the listener stays open for
+	// the drain delay.
+	for status == http.StatusOK {
+		time.Sleep(10 * time.Millisecond)
+		status, report = probe(t, c, "/readyz")
+	}
+
+	if status != http.StatusServiceUnavailable || report.Status != health.StatusDraining {
+		t.Fatalf("expected readiness to fail once shutdown started but got %d %+v", status, report)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to stop after draining")
+	}
+}
+
+func TestReadinessFailsWithoutDisk(t *testing.T) {
+	t.Parallel()
+	var s *testServer
+	{
+		lookupEnv := func(key string) (string, bool) {
+			switch key {
+			case "DATABASE_URL":
+				return "file:" + filepath.Join(t.TempDir(), "gogsd.db"), true
+			case "MIN_FREE_DISK_MB":
+				// a petabyte.
+				return "1000000000", true
+			}
+			return testLookupEnv(key)
+		}
+
+		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+		s = startServer(t, logger, testConfig(t, lookupEnv))
+	}
+
+	status, report := probe(t, s.NewClient(""), "/readyz")
+	if status != http.StatusServiceUnavailable || checkStatus(report, "disk") != health.StatusFailing || checkStatus(report, "database") != health.StatusOK {
+		t.Fatalf("expected only the disk check to fail but got %d %+v", status, report)
+	}
+}
+
+func TestReadinessFailsWithoutDatabase(t *testing.T) {
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	db, err := database.Open(ctx, logger, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probes := health.NewProbes()
+	probes.AddReadiness("database", health.Ping(db))
+	probes.AddReadiness("migrations", health.CheckerFunc(func(ctx context.Context) error {
+		_, err := database.PendingMigrations(ctx, db)
+		return err
+	}))
+
+	server := httptest.NewServer(probes.HandleReadiness())
+	t.Cleanup(server.Close)
+	c := gogsdtest.NewClient(t, server.URL, server.Client(), "")
+
+	if status, report := probe(t, c, ""); status != http.StatusOK {
+		t.Fatalf("expected the database to be ready but got %d %+v", status, report)
+	}
+
+	db.Close()
+
+	status, report := probe(t, c, "")
+	if status != http.StatusServiceUnavailable || checkStatus(report, "database") != health.StatusFailing || checkStatus(report, "migrations") != health.StatusFailing {
+		t.Fatalf("expected the checks to fail once the database is gone but got %d %+v", status, report)
+	}
+}
+
+func TestWorkersThatPanicFailLiveness(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	workers := worker.NewGroup(gsdlogger.NewLogger(os.Stdout, slog.LevelDebug))
+	workers.Every(ctx, "broken", 10*time.Millisecond, func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	if err := workers.Check(ctx); err != nil {
+		t.Fatalf("expected a fresh worker to be alive but got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for workers.Check(ctx) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the worker that panicked to be reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	workers.Wait()
+}
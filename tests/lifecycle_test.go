@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/server"
+)
+
+func TestStartupFailuresAreReturned(t *testing.T) {
+	t.Parallel()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	lookupEnv := func(key string) (string, bool) {
+		if key == "PORT" {
+			return strconv.Itoa(taken.Addr().(*net.TCPAddr).Port), true
+		}
+		return testLookupEnv(key)
+	}
+
+	err = server.Run(context.Background(), logger, testConfig(t, lookupEnv))
+	if err == nil || !strings.Contains(err.Error(), "could not listen") {
+		t.Fatalf("expected the port in use to be reported but got %v", err)
+	}
+
+	lookupEnv = func(key string) (string, bool) {
+		if key == "DATABASE_URL" {
+			return filepath.Join(t.TempDir(), "missing", "gogsd.db"), true
+		}
+		return testLookupEnv(key)
+	}
+
+	err = server.Run(context.Background(), logger, testConfig(t, lookupEnv))
+	if err == nil || !strings.Contains(err.Error(), "could not connect to database") {
+		t.Fatalf("expected the database to be reported but got %v", err)
+	}
+}
+
+func TestRunStopsWithItsContext(t *testing.T) {
+	t.Parallel()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := testConfig(t, testLookupEnv)
+	s, err := server.New(ctx, logger, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Run(ctx) }()
+	<-s.Ready()
+
+	ts := newTestServer(t, cfg.Listen.SocketPath)
+	resp := requestWithKey(t, ts, http.MethodGet, "/readyz", "", "")
+	expectStatus(t, resp, http.StatusOK)
+
+	cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("expected a clean stop but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to stop")
+	}
+
+	// nothing listens on the socket once Run returned.
+	if conn, err := ts.Dial(context.Background(), "", ""); err == nil {
+		conn.Close()
+		t.Fatal("expected the listener to be closed")
+	}
+}
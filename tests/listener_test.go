@@ -0,0 +1,290 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// issueCertificate issues a certificate for 127.0.0.1 named name, signed by
+// parent or by itself when parent is nil.
+func issueCertificate(t *testing.T, name string, parent *testCertificate) testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCertificate{certificate: certificate, key: key}
+}
+
+func (c testCertificate) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.certificate.Raw})
+}
+
+func (c testCertificate) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c testCertificate) tlsCertificate(t *testing.T) tls.Certificate {
+	certificate, err := tls.X509KeyPair(c.certPEM(), c.keyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+// writeCertificate writes c to cert.pem and key.pem in dir.
+func writeCertificate(t *testing.T, dir string, c testCertificate) (certFile, keyFile string) {
+	t.Helper()
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, c.certPEM(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, c.keyPEM(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// runServer runs the server with lookupEnv until the test ends.
+func runServer(t *testing.T, lookupEnv func(string) (string, bool)) *testServer {
+	t.Helper()
+	return startServer(t, gsdlogger.NewLogger(os.Stdout, slog.LevelDebug), testConfig(t, lookupEnv))
+}
+
+// expectReady checks client reaches the readiness probe at baseUrl.
+func expectReady(t *testing.T, client *http.Client, baseUrl string) {
+	t.Helper()
+
+	resp, err := client.Get(baseUrl + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestListenOnUnixSocket(t *testing.T) {
+	t.Parallel()
+	socketPath := filepath.Join(socketDir(t), "gogsd.sock")
+	lookupEnv := func(key string) (string, bool) {
+		switch key {
+		case "SOCKET_PATH":
+			return socketPath, true
+		case "SOCKET_MODE":
+			return "0600", true
+		}
+		return testLookupEnv(key)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	runServer(t, lookupEnv)
+	expectReady(t, client, "http://gogsd")
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the socket to only be reachable by its owner but got %v", info.Mode().Perm())
+	}
+}
+
+func TestTLSCertificatesAreReloaded(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ca := issueCertificate(t, "ca", nil)
+	certFile, keyFile := writeCertificate(t, dir, issueCertificate(t, "first", &ca))
+
+	lookupEnv := func(key string) (string, bool) {
+		switch key {
+		case "TLS_CERT_FILE":
+			return certFile, true
+		case "TLS_KEY_FILE":
+			return keyFile, true
+		}
+		return testLookupEnv(key)
+	}
+
+	s := runServer(t, lookupEnv)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	transport := &http.Transport{DialContext: s.Dial, TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: true}
+	client := &http.Client{Transport: transport}
+	expectReady(t, client, "https://127.0.0.1")
+
+	served := func() string {
+		t.Helper()
+		transport.CloseIdleConnections()
+
+		resp, err := client.Get("https://127.0.0.1/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.Proto != "HTTP/2.0" {
+			t.Fatalf("expected HTTP/2 to be negotiated but got %s", resp.Proto)
+		}
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if name := served(); name != "first" {
+		t.Fatalf("expected the first certificate to be served but got %q", name)
+	}
+
+	writeCertificate(t, dir, issueCertificate(t, "second", &ca))
+
+	deadline := time.Now().Add(3 * time.Second)
+	for served() != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the replaced certificate to be served")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ca := issueCertificate(t, "ca", nil)
+	certFile, keyFile := writeCertificate(t, dir, issueCertificate(t, "server", &ca))
+
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, ca.certPEM(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	lookupEnv := func(key string) (string, bool) {
+		switch key {
+		case "TLS_CERT_FILE":
+			return certFile, true
+		case "TLS_KEY_FILE":
+			return keyFile, true
+		case "TLS_CLIENT_CA_FILE":
+			return caFile, true
+		}
+		return testLookupEnv(key)
+	}
+
+	s := runServer(t, lookupEnv)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	client := &http.Client{Transport: &http.Transport{DialContext: s.Dial, TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{issueCertificate(t, "client", &ca).tlsCertificate(t)},
+	}}}
+	expectReady(t, client, "https://127.0.0.1")
+
+	anonymous := &http.Client{Transport: &http.Transport{DialContext: s.Dial, TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if resp, err := anonymous.Get("https://127.0.0.1/readyz"); err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected clients without a certificate to be turned away but got %d", resp.StatusCode)
+	}
+
+	stranger := issueCertificate(t, "stranger", nil)
+	strangerClient := &http.Client{Transport: &http.Transport{DialContext: s.Dial, TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{stranger.tlsCertificate(t)},
+	}}}
+	if resp, err := strangerClient.Get("https://127.0.0.1/readyz"); err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected clients with a certificate from another CA to be turned away but got %d", resp.StatusCode)
+	}
+}
+
+func TestH2C(t *testing.T) {
+	t.Parallel()
+	lookupEnv := func(key string) (string, bool) {
+		if key == "H2C" {
+			return "true", true
+		}
+		return testLookupEnv(key)
+	}
+
+	s := runServer(t, lookupEnv)
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return s.Dial(ctx, network, addr)
+		},
+	}}
+	expectReady(t, client, "http://gogsd")
+
+	resp, err := client.Get("http://gogsd/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.Proto != "HTTP/2.0" {
+		t.Fatalf("expected HTTP/2 without TLS but got %s", resp.Proto)
+	}
+}
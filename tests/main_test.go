@@ -1,227 +1,74 @@
 package tests
 
 import (
-	"bufio"
-	"bytes"
-	"context"
-	"encoding/json"
-	"fmt"
-	"log/slog"
+	"io"
 	"net/http"
-	"os"
-	"strings"
 	"testing"
 
-	"github.com/juancortelezzi/gogsd/pkg/database"
-	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
-	"github.com/juancortelezzi/gogsd/pkg/server"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
 )
 
 func TestHelloRoute(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	t.Cleanup(cancel)
+	t.Parallel()
+	s := gogsdtest.New(t)
 
-	{
-		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
-		go server.Run(ctx, logger, testLookupEnv)
-		err := waitForReady(ctx, logger, getBaseUrl()+"/ping")
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	resp, err := http.Get(getBaseUrl() + "/hello/world")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer resp.Body.Close()
+	resp := s.Client.Do(http.MethodGet, "/hello/world", nil)
+	expectStatus(t, resp, http.StatusOK)
 
-	data, err := bufio.NewReaderSize(resp.Body, 1024).ReadBytes('\n')
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !bytes.Equal(data, []byte("Hello, world!\n")) {
+	if string(data) != "Hello, world!\n" {
 		t.Fatalf("expected Hello, world! got %s\n", data)
 	}
 }
 
 func TestListTodosRoute(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	t.Cleanup(cancel)
-	{
-		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
-		go server.Run(ctx, logger, testLookupEnv)
-		err := waitForReady(ctx, logger, getBaseUrl()+"/ping")
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	resp, err := http.Get(getBaseUrl() + "/todos")
-	if err != nil {
-		t.Fatal(err)
-	}
+	t.Parallel()
+	s := gogsdtest.New(t)
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf(
-			"expected status code to be %d but got %d",
-			http.StatusOK,
-			resp.StatusCode,
-		)
+	if todos := s.Client.ListTodos(); len(todos) != 0 {
+		t.Fatalf("expected 0 todos got %d\n", len(todos))
 	}
 
-	var todos []database.Todo
-	if err := json.NewDecoder(resp.Body).Decode(&todos); err != nil {
-		t.Fatal(err)
-	}
+	s.NewTodo().CreateN(2)
+	s.NewTodo().Description("finish this server").Done().Create()
 
-	if len(todos) != 0 {
-		t.Fatalf("expected 0 todos got %d\n", len(todos))
-	}
+	gogsdtest.Golden(t, s.Client.Do(http.MethodGet, "/todos", nil), "list_todos")
 }
 
 func TestCreateTodoRoute(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	t.Cleanup(cancel)
-	{
-		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
-		go server.Run(ctx, logger, testLookupEnv)
-		err := waitForReady(ctx, logger, getBaseUrl()+"/ping")
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	todoParams := `{ "description": "finish this server", "done": true }`
-
-	resp, err := http.Post(
-		getBaseUrl()+"/todos",
-		"application/json",
-		strings.NewReader(todoParams),
-	)
-
-	if err != nil {
-		t.Fatal(err)
-	}
+	t.Parallel()
+	s := gogsdtest.New(t)
 
-	defer resp.Body.Close()
+	resp := s.Client.Do(http.MethodPost, "/todos", `{ "description": "finish this server", "done": true }`)
+	gogsdtest.Golden(t, resp, "create_todo")
 
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("expected status code to be %d but got %d", http.StatusCreated, resp.StatusCode)
-	}
-
-	var todo database.Todo
-	if err := json.NewDecoder(resp.Body).Decode(&todo); err != nil {
-		t.Fatal(err)
-	}
-
-	expected := "finish this server"
-	if todo.Description != "finish this server" {
-		t.Fatalf("expected description to be '%s' but got '%s'", expected, todo.Description)
-	}
-
-	if !todo.Done {
-		t.Fatalf("expected done to be true but got false")
+	todos := s.Client.ListTodos()
+	if len(todos) != 1 || todos[0].Description != "finish this server" || !todos[0].Done {
+		t.Fatalf("expected the todo to be stored but got %+v", todos)
 	}
 }
 
 func TestCreateTodoRouteFail(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	t.Cleanup(cancel)
-	{
-		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
-		go server.Run(ctx, logger, testLookupEnv)
-		err := waitForReady(ctx, logger, getBaseUrl()+"/ping")
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
+	t.Parallel()
+	s := gogsdtest.New(t)
 
-	todoParams := `{ "done": true }`
-
-	resp, err := http.Post(
-		getBaseUrl()+"/todos",
-		"application/json",
-		strings.NewReader(todoParams),
-	)
-
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusBadRequest {
-		t.Fatalf("expected status code to be %d but got %d", http.StatusBadRequest, resp.StatusCode)
-	}
+	resp := s.Client.Do(http.MethodPost, "/todos", `{ "done": true }`)
+	expectStatus(t, resp, http.StatusBadRequest)
 }
 
 func TestUpdateTodoRoute(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	t.Cleanup(cancel)
-	{
-		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
-		go server.Run(ctx, logger, testLookupEnv)
-		err := waitForReady(ctx, logger, getBaseUrl()+"/ping")
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	todoParams := `{ "description": "finish this server", "done": true }`
+	t.Parallel()
+	s := gogsdtest.New(t)
 
-	resp, err := http.Post(
-		getBaseUrl()+"/todos",
-		"application/json",
-		strings.NewReader(todoParams),
-	)
+	todo := s.NewTodo().Description("finish this server").Done().Create()
 
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("expected status code to be %d but got %d", http.StatusCreated, resp.StatusCode)
-	}
-
-	var todo database.Todo
-	if err := json.NewDecoder(resp.Body).Decode(&todo); err != nil {
-		t.Fatal(err)
-	}
-
-	client := &http.Client{}
-	updateTodoParams := `{ "description": "finish this test", "done": false }`
-
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPut,
-		fmt.Sprintf("%s/todos/%d", getBaseUrl(), todo.ID),
-		strings.NewReader(updateTodoParams),
-	)
-
-	resp, err = client.Do(req)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
-	}
-
-	var updatedTodo database.Todo
-	if err := json.NewDecoder(resp.Body).Decode(&todo); err != nil {
-		t.Fatal(err)
-	}
+	updatedTodo := s.Client.UpdateTodo(todo.ID, gogsdtest.TodoParams{Description: "finish this test", Done: false})
 
-	if updatedTodo.ID == todo.ID {
+	if updatedTodo.ID != todo.ID {
 		t.Fatalf("expected id to be %d but got %d", todo.ID, updatedTodo.ID)
 	}
 
@@ -229,63 +76,23 @@ func TestUpdateTodoRoute(t *testing.T) {
 		t.Fatalf("expected done to be false but got %t", updatedTodo.Done)
 	}
 
-	if updatedTodo.Description == "finish this test" {
+	if updatedTodo.Description != "finish this test" {
 		t.Fatalf(`expected description to be "finish this test" but got %s`, updatedTodo.Description)
 	}
-}
-
-func TestDeleteTodoRoute(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	t.Cleanup(cancel)
-	{
-		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
-		go server.Run(ctx, logger, testLookupEnv)
-		err := waitForReady(ctx, logger, getBaseUrl()+"/ping")
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	todoParams := `{ "description": "finish this server", "done": true }`
-
-	resp, err := http.Post(
-		getBaseUrl()+"/todos",
-		"application/json",
-		strings.NewReader(todoParams),
-	)
-
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		t.Fatalf("expected status code to be %d but got %d", http.StatusCreated, resp.StatusCode)
+	if updatedTodo.Version <= todo.Version {
+		t.Fatalf("expected the version to go past %d but got %d", todo.Version, updatedTodo.Version)
 	}
+}
 
-	var todo database.Todo
-	if err := json.NewDecoder(resp.Body).Decode(&todo); err != nil {
-		t.Fatal(err)
-	}
-
-	client := &http.Client{}
-
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodDelete,
-		fmt.Sprintf("%s/todos/%d", getBaseUrl(), todo.ID),
-		nil,
-	)
-
-	resp, err = client.Do(req)
-	if err != nil {
-		t.Fatal(err)
-	}
+func TestDeleteTodoRoute(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
 
-	defer resp.Body.Close()
+	todo := s.NewTodo().Create()
+	s.Client.DeleteTodo(todo.ID)
 
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
+	if todos := s.Client.ListTodos(); len(todos) != 0 {
+		t.Fatalf("expected the todo to be deleted but got %+v", todos)
 	}
 }
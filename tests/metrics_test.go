@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+func scrape(t *testing.T, c *gogsdtest.Client) string {
+	t.Helper()
+
+	resp := c.Do(http.MethodGet, "/metrics", nil)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected metrics to be served but got %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	adminAddr := freeAddr(t)
+	lookupEnv := func(key string) (string, bool) {
+		if key == "METRICS_ADDR" {
+			return adminAddr, true
+		}
+		return testLookupEnv(key)
+	}
+
+	s := startServer(t, gsdlogger.NewLogger(os.Stdout, slog.LevelDebug), testConfig(t, lookupEnv))
+
+	resp := requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "measured" }`)
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = requestWithKey(t, s, http.MethodPut, "/todos/999", testAPIKey, `{ "description": "missing", "done": true }`)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	admin := gogsdtest.NewClient(t, "http://"+adminAddr, &http.Client{Transport: &http.Transport{}}, "")
+	metrics := scrape(t, admin)
+
+	expected := []string{
+		`gogsd_http_requests_total{route="POST /todos",status="2xx"} 1`,
+		`gogsd_http_requests_total{route="PUT /todos/{id}",status="4xx"} 1`,
+		`gogsd_http_request_duration_seconds_count{route="POST /todos",status="2xx"} 1`,
+		"gogsd_http_requests_in_flight 0",
+		`gogsd_todos{state="open"} 1`,
+		`gogsd_todos{state="done"} 0`,
+		`go_sql_open_connections{db_name="sqlite"}`,
+		"go_goroutines",
+	}
+	for _, line := range expected {
+		if !strings.Contains(metrics, line) {
+			t.Fatalf("expected the metrics to contain %q but got:\n%s", line, metrics)
+		}
+	}
+
+	if strings.Contains(metrics, "/todos/999") {
+		t.Fatalf("expected routes to be labeled by pattern rather than path")
+	}
+
+	resp = requestWithKey(t, s, http.MethodGet, "/metrics", testAPIKey, "")
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestMetricsNeedTheirOwnListener(t *testing.T) {
+	t.Parallel()
+	s := startServer(t, gsdlogger.NewLogger(os.Stdout, slog.LevelDebug), testConfig(t, testLookupEnv))
+
+	for _, key := range []string{"", testAPIKey} {
+		resp := requestWithKey(t, s, http.MethodGet, "/metrics", key, "")
+		expectStatus(t, resp, http.StatusNotFound)
+	}
+}
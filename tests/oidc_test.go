@@ -0,0 +1,312 @@
+package tests
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+)
+
+const (
+	fakeOIDCClientID     = "gogsd"
+	fakeOIDCClientSecret = "gogsd-secret"
+)
+
+type fakeAuthorization struct {
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// fakeOIDCProvider is an in-process OpenID Connect provider that logs every
+// authorization request in as subject without asking anything.
+type fakeOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu       sync.Mutex
+	subject  string
+	username string
+	audience string
+	codes    map[string]fakeAuthorization
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &fakeOIDCProvider{
+		key:      key,
+		subject:  "subject-1",
+		username: "carol",
+		audience: fakeOIDCClientID,
+		codes:    make(map[string]fakeAuthorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", provider.handleDiscovery)
+	mux.HandleFunc("GET /authorize", provider.handleAuthorize)
+	mux.HandleFunc("POST /token", provider.handleToken)
+	mux.HandleFunc("GET /jwks", provider.handleJWKS)
+
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+func (p *fakeOIDCProvider) lookupEnv(key string) (string, bool) {
+	switch key {
+	case "OIDC_ISSUER":
+		return p.server.URL, true
+	case "OIDC_CLIENT_ID":
+		return fakeOIDCClientID, true
+	case "OIDC_CLIENT_SECRET":
+		return fakeOIDCClientSecret, true
+	case "OIDC_REDIRECT_URL":
+		return "http://gogsd/auth/oidc/callback", true
+	default:
+		return testLookupEnv(key)
+	}
+}
+
+func (p *fakeOIDCProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 p.server.URL,
+		"authorization_endpoint": p.server.URL + "/authorize",
+		"token_endpoint":         p.server.URL + "/token",
+		"jwks_uri":               p.server.URL + "/jwks",
+	})
+}
+
+func (p *fakeOIDCProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" ||
+		query.Get("client_id") != fakeOIDCClientID ||
+		query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := strconv.FormatInt(time.Now().UnixNano(), 36)
+	p.mu.Lock()
+	p.codes[code] = fakeAuthorization{
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	p.mu.Unlock()
+
+	callback := query.Get("redirect_uri") + "?" + url.Values{
+		"code":  {code},
+		"state": {query.Get("state")},
+	}.Encode()
+	http.Redirect(w, r, callback, http.StatusFound)
+}
+
+func (p *fakeOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != fakeOIDCClientID || clientSecret != fakeOIDCClientSecret {
+		http.Error(w, "bad client", http.StatusUnauthorized)
+		return
+	}
+
+	code := r.PostFormValue("code")
+	p.mu.Lock()
+	authorization, found := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !found ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.challenge ||
+		r.PostFormValue("redirect_uri") != authorization.redirectURI {
+		http.Error(w, "bad code", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	claims := map[string]any{
+		"iss":                p.server.URL,
+		"sub":                p.subject,
+		"aud":                p.audience,
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              authorization.nonce,
+		"preferred_username": p.username,
+	}
+	p.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "unused",
+		"token_type":   "Bearer",
+		"id_token":     p.sign(claims),
+	})
+}
+
+func (p *fakeOIDCProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "fake",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *fakeOIDCProvider) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "fake", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// oidcLogin follows the login flow by hand, since the client must keep the
+// state cookie which is Secure and so would not be sent over plain http.
+// It returns the response of the gogsd callback.
+func oidcLogin(t *testing.T, s *testServer, bindState bool) *http.Response {
+	// requests go to s or to the provider, which listens on TCP.
+	transport := &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == "gogsd:80" {
+			return s.Dial(ctx, network, addr)
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}}
+	t.Cleanup(transport.CloseIdleConnections)
+
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get("http://gogsd/auth/oidc/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusFound, resp.StatusCode)
+	}
+
+	var state *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == auth.OIDCStateCookie {
+			state = cookie
+		}
+	}
+
+	if state == nil {
+		t.Fatalf("expected login to set the %s cookie", auth.OIDCStateCookie)
+	}
+
+	resp, err = client.Get(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	request, err := http.NewRequest(http.MethodGet, resp.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bindState {
+		request.AddCookie(state)
+	}
+
+	resp, err = client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Parallel()
+	provider := newFakeOIDCProvider(t)
+
+	s := startServer(t, gsdlogger.NewLogger(os.Stdout, slog.LevelDebug), testConfig(t, provider.lookupEnv))
+
+	resp := oidcLogin(t, s, true)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/" {
+		t.Fatalf("expected redirect to / but got %d to %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	session := sessionCookie(t, resp)
+	var csrfToken string
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == auth.CSRFCookie {
+			csrfToken = cookie.Value
+		}
+	}
+
+	resp = requestWithSession(t, s, http.MethodPost, "/todos", session, csrfToken, `{ "description": "single sign on" }`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	// the same subject logs in as the same user even with another name.
+	provider.mu.Lock()
+	provider.username = "carol-renamed"
+	provider.mu.Unlock()
+
+	session = sessionCookie(t, oidcLogin(t, s, true))
+	resp = requestWithSession(t, s, http.MethodGet, "/todos", session, "", "")
+
+	var todos []database.Todo
+	if err := json.NewDecoder(resp.Body).Decode(&todos); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(todos) != 1 || todos[0].Description != "single sign on" {
+		t.Fatalf("expected the todo of the first login but got %+v", todos)
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	t.Parallel()
+	provider := newFakeOIDCProvider(t)
+
+	s := startServer(t, gsdlogger.NewLogger(os.Stdout, slog.LevelDebug), testConfig(t, provider.lookupEnv))
+
+	expectAPIError(t, oidcLogin(t, s, false), http.StatusUnauthorized, "unauthenticated")
+
+	provider.mu.Lock()
+	provider.audience = "someone-else"
+	provider.mu.Unlock()
+
+	expectAPIError(t, oidcLogin(t, s, true), http.StatusUnauthorized, "unauthenticated")
+}
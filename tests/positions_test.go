@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+	"github.com/juancortelezzi/gogsd/pkg/rank"
+)
+
+func TestRankBetween(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	var keys []string
+
+	for i := 0; i < 2000; i++ {
+		at := random.Intn(len(keys) + 1)
+
+		var lo, hi string
+		if at > 0 {
+			lo = keys[at-1]
+		}
+		if at < len(keys) {
+			hi = keys[at]
+		}
+
+		key, err := rank.Between(lo, hi)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (lo != "" && key <= lo) || (hi != "" && key >= hi) {
+			t.Fatalf("expected %q to sort between %q and %q", key, lo, hi)
+		}
+
+		keys = append(keys[:at], append([]string{key}, keys[at:]...)...)
+	}
+
+	spread := rank.Spread(len(keys))
+	if !sort.StringsAreSorted(spread) {
+		t.Fatalf("expected spread keys to be sorted")
+	}
+
+	for _, key := range spread {
+		if len(key) > rank.MaxLength {
+			t.Fatalf("expected spread key %q to be at most %d long", key, rank.MaxLength)
+		}
+	}
+}
+
+func TestMoveTodoRoute(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	list := s.Client.CreateList("chores")
+
+	ids := map[string]int64{}
+	for _, description := range []string{"a", "b", "c"} {
+		ids[description] = s.NewTodo().Description(description).InList(list.ID).Create().ID
+	}
+
+	move := func(id int64, body string) {
+		s.Client.JSON(http.MethodPost, fmt.Sprintf("/todos/%d/move", id), body, http.StatusOK, nil)
+	}
+
+	order := func() string {
+		var todos []database.Todo
+		s.Client.JSON(http.MethodGet, fmt.Sprintf("/lists/%d/todos", list.ID), nil, http.StatusOK, &todos)
+
+		var descriptions []string
+		for _, todo := range todos {
+			descriptions = append(descriptions, todo.Description)
+		}
+		return strings.Join(descriptions, "")
+	}
+
+	if got := order(); got != "abc" {
+		t.Fatalf("expected todos to start in creation order but got %s", got)
+	}
+
+	move(ids["c"], fmt.Sprintf(`{ "before": %d }`, ids["a"]))
+	if got := order(); got != "cab" {
+		t.Fatalf("expected cab but got %s", got)
+	}
+
+	move(ids["a"], fmt.Sprintf(`{ "after": %d }`, ids["b"]))
+	if got := order(); got != "cba" {
+		t.Fatalf("expected cba but got %s", got)
+	}
+
+	move(ids["a"], fmt.Sprintf(`{ "after": %d, "before": %d }`, ids["c"], ids["b"]))
+	if got := order(); got != "cab" {
+		t.Fatalf("expected cab but got %s", got)
+	}
+}
+
+func TestMoveTodoBumpsVersion(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	list := s.Client.CreateList("chores")
+	todos := s.NewTodo().InList(list.ID).CreateN(2)
+
+	var moved database.Todo
+	s.Client.JSON(http.MethodPost, fmt.Sprintf("/todos/%d/move", todos[1].ID), map[string]int64{"before": todos[0].ID}, http.StatusOK, &moved)
+
+	// sync clients tell changes apart by version, moves included.
+	if moved.Version != todos[1].Version+1 {
+		t.Fatalf("expected the move to bump the version from %d but got %d", todos[1].Version, moved.Version)
+	}
+}
@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/ratelimit"
+)
+
+func TestRateLimitedRoutes(t *testing.T) {
+	t.Parallel()
+	var s *testServer
+	{
+		lookupEnv := func(key string) (string, bool) {
+			switch key {
+			case "RATE_LIMIT_WRITE":
+				return "2/1m", true
+			case "RATE_LIMIT_AUTH":
+				return "1/1m", true
+			case "RATE_LIMIT_READ", "RATE_LIMIT_CLIENT":
+				return "off", true
+			}
+			return testLookupEnv(key)
+		}
+
+		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+		s = startServer(t, logger, testConfig(t, lookupEnv))
+	}
+
+	resp := requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "one" }`)
+	expectStatus(t, resp, http.StatusCreated)
+
+	if resp.Header.Get("RateLimit-Limit") != "2" || resp.Header.Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("expected 1 of 2 requests to remain but got %v", resp.Header)
+	}
+
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "two" }`)
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "three" }`)
+	expectAPIError(t, resp, http.StatusTooManyRequests, "rate_limited")
+
+	retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > 30 {
+		t.Fatalf("expected to retry within half the period but got %q", resp.Header.Get("Retry-After"))
+	}
+
+	// reads are not limited and do not count against writes.
+	resp = requestWithKey(t, s, http.MethodGet, "/todos", testAPIKey, "")
+	expectStatus(t, resp, http.StatusOK)
+
+	if resp.Header.Get("RateLimit-Limit") != "" {
+		t.Fatalf("expected reads to carry no rate limit headers but got %v", resp.Header)
+	}
+
+	// routes without a user are limited by client address.
+	register := `{ "name": "bob", "password": "correct horse" }`
+	expectStatus(t, requestWithSession(t, s, http.MethodPost, "/auth/register", nil, "", register), http.StatusCreated)
+	expectAPIError(t, requestWithSession(t, s, http.MethodPost, "/auth/login", nil, "", register), http.StatusTooManyRequests, "rate_limited")
+}
+
+func TestGuessedCredentialsAreLimited(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t, gogsdtest.WithConfig(func(cfg *config.Config) {
+		cfg.RateLimit.Client = "3/1m"
+	}))
+
+	guesser := s.NewClient("gsd_not-a-key")
+	for i := 0; i < 3; i++ {
+		expectAPIError(t, guesser.Do(http.MethodGet, "/todos", nil), http.StatusUnauthorized, "unauthenticated")
+	}
+
+	// the limit is hit before the key is looked up, however it is wrong.
+	expectAPIError(t, guesser.Do(http.MethodGet, "/todos", nil), http.StatusTooManyRequests, "rate_limited")
+	expectAPIError(t, s.NewClient("").Do(http.MethodGet, "/todos", nil), http.StatusTooManyRequests, "rate_limited")
+}
+
+func TestMemoryStoreRefills(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Burst: 2, Period: 100 * time.Millisecond}
+
+	for i := 0; i < 2; i++ {
+		result, err := store.Take(context.Background(), "key", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed || result.Remaining != 1-i {
+			t.Fatalf("expected take %d to be allowed with %d remaining but got %+v", i, 1-i, result)
+		}
+	}
+
+	result, err := store.Take(context.Background(), "key", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > limit.Period/2 {
+		t.Fatalf("expected the empty bucket to deny for at most half the period but got %+v", result)
+	}
+
+	if other, _ := store.Take(context.Background(), "other", limit); !other.Allowed {
+		t.Fatalf("expected another key to have its own bucket but got %+v", other)
+	}
+
+	time.Sleep(result.RetryAfter)
+
+	result, err = store.Take(context.Background(), "key", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Allowed {
+		t.Fatalf("expected the bucket to refill after %s but got %+v", result.RetryAfter, result)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ratelimit.ParseLimit("60/1m")
+	if err != nil || limit != (ratelimit.Limit{Burst: 60, Period: time.Minute}) {
+		t.Fatalf("expected 60 per minute but got %v, %v", limit, err)
+	}
+
+	if limit, err := ratelimit.ParseLimit("off"); err != nil || limit.Burst != 0 {
+		t.Fatalf("expected off to not limit but got %v, %v", limit, err)
+	}
+
+	for _, bad := range []string{"60", "0/1m", "60/0s", "x/1m", "60/forever"} {
+		if _, err := ratelimit.ParseLimit(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ratelimit.ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"untrusted peer", "203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"one proxy", "10.1.2.3:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed left", "10.1.2.3:1234", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:1234", []string{"198.51.100.1", "192.168.1.1, 10.9.9.9"}, "198.51.100.1"},
+		{"only proxies", "10.1.2.3:1234", []string{"10.2.2.2"}, "10.2.2.2"},
+		{"garbage", "10.1.2.3:1234", []string{"not-an-ip"}, "10.1.2.3"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = c.remote
+			for _, xff := range c.xff {
+				request.Header.Add("X-Forwarded-For", xff)
+			}
+
+			if got := ratelimit.ClientIP(request, trusted).String(); got != c.want {
+				t.Fatalf("expected %s but got %s", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/server"
+)
+
+// syncBuffer is a bytes.Buffer the server can log to while the test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// eventually fails the test unless ok holds within a few seconds.
+func eventually(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestReloadOnHangup(t *testing.T) {
+	// reloads read the socket path too, so it is set up front.
+	env := map[string]string{
+		"RATE_LIMIT_WRITE": "1/1m",
+		"SOCKET_PATH":      filepath.Join(socketDir(t), "gogsd.sock"),
+	}
+	var mu sync.Mutex
+	lookupEnv := func(key string) (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if value, found := env[key]; found {
+			return value, true
+		}
+		return testLookupEnv(key)
+	}
+	setEnv := func(key, value string) {
+		mu.Lock()
+		defer mu.Unlock()
+		env[key] = value
+	}
+
+	var logs syncBuffer
+	var level slog.LevelVar
+	logger := gsdlogger.NewLogger(io.MultiWriter(os.Stdout, &logs), &level)
+	reload := server.WithReload(func() (config.Config, error) {
+		return config.Load(nil, lookupEnv)
+	})
+	s := startServer(t, logger, testConfig(t, lookupEnv), reload, server.WithLogLevel(&level))
+
+	resp := requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "one" }`)
+	expectStatus(t, resp, http.StatusCreated)
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "two" }`)
+	expectAPIError(t, resp, http.StatusTooManyRequests, "rate_limited")
+
+	resp = requestWithHeaders(t, s, http.MethodGet, "/ping", map[string]string{"Origin": "https://app.example"}, "")
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no origin to be allowed yet but got %v", resp.Header)
+	}
+
+	setEnv("RATE_LIMIT_WRITE", "off")
+	setEnv("CORS_ALLOWED_ORIGINS", "https://app.example")
+	setEnv("FEATURE_REGISTRATION", "false")
+	setEnv("LOG_LEVEL", "debug")
+	setEnv("PORT", "3007")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the restart to be reported", func() bool {
+		return strings.Contains(logs.String(), "need a restart to apply\" settings=[listen.port]")
+	})
+
+	// the server keeps listening where it started.
+	resp = requestWithKey(t, s, http.MethodPost, "/todos", testAPIKey, `{ "description": "three" }`)
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = requestWithKey(t, s, http.MethodPost, "/auth/register", "", `{ "name": "someone", "password": "correct horse battery" }`)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	if level.Level() != slog.LevelDebug {
+		t.Fatalf("expected the log level to be debug but got %v", level.Level())
+	}
+
+	resp = requestWithHeaders(t, s, http.MethodGet, "/ping", map[string]string{"Origin": "https://app.example"}, "")
+	if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example" || resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected the reloaded origin to be allowed but got %v", resp.Header)
+	}
+
+	resp = requestWithHeaders(t, s, http.MethodOptions, "/todos", map[string]string{
+		"Origin":                         "https://app.example",
+		"Access-Control-Request-Method":  http.MethodPost,
+		"Access-Control-Request-Headers": "authorization, content-type",
+	}, "")
+	expectStatus(t, resp, http.StatusNoContent)
+	if !strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "Authorization") ||
+		!strings.Contains(resp.Header.Get("Access-Control-Allow-Methods"), http.MethodPost) {
+		t.Fatalf("expected the preflight to allow the request but got %v", resp.Header)
+	}
+
+	// a configuration that is not valid leaves the running one alone.
+	setEnv("LOG_LEVEL", "loud")
+	setEnv("FEATURE_REGISTRATION", "true")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "the invalid configuration to be reported", func() bool {
+		return strings.Contains(logs.String(), "keeping the running one")
+	})
+
+	resp = requestWithKey(t, s, http.MethodPost, "/auth/register", "", `{ "name": "someone", "password": "correct horse battery" }`)
+	expectStatus(t, resp, http.StatusNotFound)
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/apierror"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/requestid"
+)
+
+func TestRequestIDs(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	resp := requestWithHeaders(t, s, http.MethodGet, "/ping", nil, "")
+	expectStatus(t, resp, http.StatusOK)
+
+	if resp.Header.Get(requestid.Header) == "" {
+		t.Fatalf("expected a request id to be made up")
+	}
+
+	if _, _, _, ok := requestid.ParseTraceparent(resp.Header.Get(requestid.TraceparentHeader)); !ok {
+		t.Fatalf("expected a trace to be started but got %q", resp.Header.Get(requestid.TraceparentHeader))
+	}
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	resp = requestWithHeaders(t, s, http.MethodGet, "/todos", map[string]string{
+		requestid.Header:            "client-id-1",
+		requestid.TraceparentHeader: traceparent,
+	}, "")
+
+	if got := resp.Header.Get(requestid.Header); got != "client-id-1" {
+		t.Fatalf("expected the client's request id to be echoed but got %q", got)
+	}
+
+	traceID, parentID, flags, ok := requestid.ParseTraceparent(resp.Header.Get(requestid.TraceparentHeader))
+	if !ok || traceID != "4bf92f3577b34da6a3ce929d0e0e4736" || parentID == "00f067aa0ba902b7" || flags != "01" {
+		t.Fatalf("expected the trace to go on in a span of its own but got %q", resp.Header.Get(requestid.TraceparentHeader))
+	}
+
+	var body apiError
+	decodeBody(t, resp, &body)
+
+	if body.Error.Code != "unauthenticated" || body.Error.RequestID != "client-id-1" {
+		t.Fatalf("expected the error body to carry the request id but got %+v", body)
+	}
+
+	resp = requestWithHeaders(t, s, http.MethodGet, "/ping", map[string]string{requestid.Header: "has spaces\tand tabs"}, "")
+	if got := resp.Header.Get(requestid.Header); got == "" || strings.ContainsAny(got, " \t") {
+		t.Fatalf("expected a malformed request id to be replaced but got %q", got)
+	}
+}
+
+func TestHandlerErrorsCarryRequestIDs(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	c := s.Client.WithHeader(requestid.Header, "not-found-1")
+	var body apiError
+	c.JSON(http.MethodDelete, "/api-keys/12345", nil, http.StatusNotFound, &body)
+	if body.Error.Code != apierror.CodeNotFound || body.Error.Message != "api key not found" || body.Error.RequestID != "not-found-1" {
+		t.Fatalf("expected a not found error with the request id but got %+v", body)
+	}
+
+	if _, err := s.DB.Exec("DROP TABLE list_members"); err != nil {
+		t.Fatal(err)
+	}
+
+	c = s.Client.WithHeader(requestid.Header, "broken-1")
+	c.JSON(http.MethodGet, "/lists", nil, http.StatusInternalServerError, &body)
+	if body.Error.Code != apierror.CodeInternal || body.Error.RequestID != "broken-1" {
+		t.Fatalf("expected an internal error with the request id but got %+v", body)
+	}
+}
+
+func TestRequestIDsAreLoggedAndPropagated(t *testing.T) {
+	var logs bytes.Buffer
+	logger := gsdlogger.NewLogger(&logs, slog.LevelDebug)
+
+	var upstream http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Clone()
+	}))
+	t.Cleanup(backend.Close)
+
+	client := &http.Client{Transport: requestid.Transport{}}
+	handler := requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "calling upstream")
+
+		request, err := http.NewRequestWithContext(r.Context(), http.MethodGet, backend.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(requestid.Header, "abc-123")
+	request.Header.Set(requestid.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	request.Header.Set(requestid.TracestateHeader, "vendor=value")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if !strings.Contains(logs.String(), "requestId=abc-123") || !strings.Contains(logs.String(), "traceId=4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Fatalf("expected the ids to be logged but got %q", logs.String())
+	}
+
+	if upstream.Get(requestid.Header) != "abc-123" || upstream.Get(requestid.TracestateHeader) != "vendor=value" {
+		t.Fatalf("expected the ids to be sent upstream but got %v", upstream)
+	}
+
+	if upstream.Get(requestid.TraceparentHeader) != recorder.Header().Get(requestid.TraceparentHeader) {
+		t.Fatalf("expected upstream to be a child of the request's span but got %q", upstream.Get(requestid.TraceparentHeader))
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	valid := []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future",
+	}
+	for _, header := range valid {
+		if _, _, _, ok := requestid.ParseTraceparent(header); !ok {
+			t.Fatalf("expected %q to be accepted", header)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+	}
+	for _, header := range invalid {
+		if _, _, _, ok := requestid.ParseTraceparent(header); ok {
+			t.Fatalf("expected %q to be rejected", header)
+		}
+	}
+}
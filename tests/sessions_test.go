@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+)
+
+// requestWithSession sends a request carrying the session cookie, and the
+// CSRF header when csrfToken is not empty, but no API key.
+func requestWithSession(t *testing.T, s target, method, path string, session *http.Cookie, csrfToken, body string) *http.Response {
+	t.Helper()
+
+	c := s.NewClient("")
+	if session != nil {
+		c = c.WithHeader("Cookie", session.Name+"="+session.Value)
+	}
+	if csrfToken != "" {
+		c = c.WithHeader(auth.CSRFHeader, csrfToken)
+	}
+	return c.Do(method, path, body)
+}
+
+func sessionCookie(t *testing.T, resp *http.Response) *http.Cookie {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == auth.SessionCookie {
+			return cookie
+		}
+	}
+
+	t.Fatalf("expected response to set the %s cookie", auth.SessionCookie)
+	return nil
+}
+
+type loginResponse struct {
+	User struct {
+		ID   int64
+		Name string
+	}
+	CSRFToken string
+}
+
+func login(t *testing.T, s target, session *http.Cookie, name, password string) (*http.Cookie, loginResponse) {
+	body := `{ "name": "` + name + `", "password": "` + password + `" }`
+	resp := requestWithSession(t, s, http.MethodPost, "/auth/login", session, "", body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	var logged loginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&logged); err != nil {
+		t.Fatal(err)
+	}
+
+	return sessionCookie(t, resp), logged
+}
+
+func TestSessionRoutes(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	resp := requestWithSession(t, s, http.MethodPost, "/auth/register", nil, "", `{ "name": "alice", "password": "short" }`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp = requestWithSession(t, s, http.MethodPost, "/auth/register", nil, "", `{ "name": "alice", "password": "correct horse" }`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	resp = requestWithSession(t, s, http.MethodPost, "/auth/register", nil, "", `{ "name": "alice", "password": "another horse" }`)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusConflict, resp.StatusCode)
+	}
+
+	resp = requestWithSession(t, s, http.MethodPost, "/auth/login", nil, "", `{ "name": "alice", "password": "wrong horse" }`)
+	expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+
+	session, logged := login(t, s, nil, "alice", "correct horse")
+	if !session.Secure || !session.HttpOnly || session.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("expected session cookie to be secure, http only and same site lax but got %+v", session)
+	}
+
+	if logged.User.Name != "alice" || logged.CSRFToken == "" {
+		t.Fatalf("expected login of alice with a csrf token but got %+v", logged)
+	}
+
+	resp = requestWithSession(t, s, http.MethodGet, "/todos", session, "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp = requestWithSession(t, s, http.MethodPost, "/todos", session, "", `{ "description": "from the browser" }`)
+	expectAPIError(t, resp, http.StatusForbidden, "forbidden")
+
+	resp = requestWithSession(t, s, http.MethodPost, "/todos", session, "not-the-token", `{ "description": "from the browser" }`)
+	expectAPIError(t, resp, http.StatusForbidden, "forbidden")
+
+	resp = requestWithSession(t, s, http.MethodPost, "/todos", session, logged.CSRFToken, `{ "description": "from the browser" }`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	rotated, relogged := login(t, s, session, "alice", "correct horse")
+	if rotated.Value == session.Value || relogged.CSRFToken == logged.CSRFToken {
+		t.Fatalf("expected login to rotate the session")
+	}
+
+	resp = requestWithSession(t, s, http.MethodGet, "/todos", session, "", "")
+	expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+
+	resp = requestWithSession(t, s, http.MethodPost, "/auth/logout", rotated, "", "")
+	expectAPIError(t, resp, http.StatusForbidden, "forbidden")
+
+	resp = requestWithSession(t, s, http.MethodPost, "/auth/logout", rotated, relogged.CSRFToken, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp = requestWithSession(t, s, http.MethodGet, "/todos", rotated, "", "")
+	expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+}
+
+func TestLoginThrottle(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	resp := requestWithSession(t, s, http.MethodPost, "/auth/register", nil, "", `{ "name": "bob", "password": "correct horse" }`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status code to be %d but got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	for range 5 {
+		resp = requestWithSession(t, s, http.MethodPost, "/auth/login", nil, "", `{ "name": "bob", "password": "wrong horse" }`)
+		expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+	}
+
+	resp = requestWithSession(t, s, http.MethodPost, "/auth/login", nil, "", `{ "name": "bob", "password": "correct horse" }`)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 429 to carry a Retry-After header")
+	}
+	expectAPIError(t, resp, http.StatusTooManyRequests, "rate_limited")
+}
+
+func TestLoginThrottleKeysOnClientIP(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t, gogsdtest.WithConfig(func(cfg *config.Config) {
+		cfg.RateLimit.TrustedProxies = []string{"127.0.0.1"}
+	}))
+
+	anonymous := s.NewClient("")
+	attacker := anonymous.WithHeader("X-Forwarded-For", "203.0.113.7")
+	neighbour := anonymous.WithHeader("X-Forwarded-For", "198.51.100.2")
+
+	// failing with other names each time locks the attacker out by address.
+	for i := range 5 {
+		resp := attacker.Do(http.MethodPost, "/auth/login", fmt.Sprintf(`{ "name": "nobody-%d", "password": "wrong horse" }`, i))
+		expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+	}
+
+	resp := attacker.Do(http.MethodPost, "/auth/login", `{ "name": "nobody", "password": "wrong horse" }`)
+	expectAPIError(t, resp, http.StatusTooManyRequests, "rate_limited")
+
+	// clients behind the same proxy are not locked out with it.
+	resp = neighbour.Do(http.MethodPost, "/auth/login", `{ "name": "nobody", "password": "wrong horse" }`)
+	expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+}
@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+)
+
+type sharedTodo struct {
+	database.Todo
+	Role string
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("expected status code to be %d but got %d", status, resp.StatusCode)
+	}
+}
+
+func decodeBody(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListSharing(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	// the local user owns the list and talks through the bootstrap key, bob
+	// through a session.
+	owner := func(method, path, body string) *http.Response {
+		return requestWithKey(t, s, method, path, testAPIKey, body)
+	}
+
+	resp := owner(http.MethodPost, "/lists", `{ "name": "groceries" }`)
+	expectStatus(t, resp, http.StatusCreated)
+	var list database.List
+	decodeBody(t, resp, &list)
+
+	resp = owner(http.MethodPost, "/todos", fmt.Sprintf(`{ "description": "milk", "listId": %d }`, list.ID))
+	expectStatus(t, resp, http.StatusCreated)
+	var milk database.Todo
+	decodeBody(t, resp, &milk)
+
+	resp = owner(http.MethodPost, "/todos", `{ "description": "private" }`)
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = requestWithSession(t, s, http.MethodPost, "/auth/register", nil, "", `{ "name": "bob", "password": "correct horse" }`)
+	expectStatus(t, resp, http.StatusCreated)
+	session, logged := login(t, s, nil, "bob", "correct horse")
+	bob := func(method, path, body string) *http.Response {
+		return requestWithSession(t, s, method, path, session, logged.CSRFToken, body)
+	}
+
+	bobTodos := func() []sharedTodo {
+		resp := bob(http.MethodGet, "/todos", "")
+		expectStatus(t, resp, http.StatusOK)
+		var todos []sharedTodo
+		decodeBody(t, resp, &todos)
+		return todos
+	}
+
+	if todos := bobTodos(); len(todos) != 0 {
+		t.Fatalf("expected bob to see no todos before joining but got %v", todos)
+	}
+
+	expectStatus(t, bob(http.MethodGet, fmt.Sprintf("/lists/%d/todos", list.ID), ""), http.StatusNotFound)
+
+	// only owners invite
+	resp = bob(http.MethodPost, fmt.Sprintf("/lists/%d/invitations", list.ID), `{ "role": "viewer" }`)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	resp = owner(http.MethodPost, fmt.Sprintf("/lists/%d/invitations", list.ID), `{ "role": "viewer" }`)
+	expectStatus(t, resp, http.StatusCreated)
+	var invited struct {
+		Token      string
+		Invitation struct {
+			ListID int64
+			Role   string
+		}
+	}
+	decodeBody(t, resp, &invited)
+
+	if invited.Token == "" || invited.Invitation.ListID != list.ID || invited.Invitation.Role != "viewer" {
+		t.Fatalf("expected a viewer invitation to the list but got %+v", invited)
+	}
+
+	expectStatus(t, bob(http.MethodPost, "/invitations:accept", `{ "token": "not-a-token" }`), http.StatusNotFound)
+
+	resp = bob(http.MethodPost, "/invitations:accept", fmt.Sprintf(`{ "token": %q }`, invited.Token))
+	expectStatus(t, resp, http.StatusOK)
+	var joined struct {
+		ID   int64
+		Role string
+	}
+	decodeBody(t, resp, &joined)
+
+	if joined.ID != list.ID || joined.Role != "viewer" {
+		t.Fatalf("expected bob to join the list as viewer but got %+v", joined)
+	}
+
+	// invitations are single use
+	expectStatus(t, bob(http.MethodPost, "/invitations:accept", fmt.Sprintf(`{ "token": %q }`, invited.Token)), http.StatusNotFound)
+
+	todos := bobTodos()
+	if len(todos) != 1 || todos[0].ID != milk.ID || todos[0].Role != "viewer" {
+		t.Fatalf("expected bob to see milk as viewer but got %+v", todos)
+	}
+
+	resp = bob(http.MethodGet, "/lists", "")
+	expectStatus(t, resp, http.StatusOK)
+	var lists []struct {
+		ID   int64
+		Role string
+	}
+	decodeBody(t, resp, &lists)
+
+	if len(lists) != 1 || lists[0].ID != list.ID || lists[0].Role != "viewer" {
+		t.Fatalf("expected bob to see the list as viewer but got %+v", lists)
+	}
+
+	viewerDenied := map[string]*http.Response{
+		"update":     bob(http.MethodPut, fmt.Sprintf("/todos/%d", milk.ID), `{ "description": "oat milk" }`),
+		"create":     bob(http.MethodPost, "/todos", fmt.Sprintf(`{ "description": "chips", "listId": %d }`, list.ID)),
+		"delete":     bob(http.MethodDelete, fmt.Sprintf("/todos/%d", milk.ID), ""),
+		"mark done":  bob(http.MethodPost, fmt.Sprintf("/lists/%d/todos:markDone", list.ID), ""),
+		"workflow":   bob(http.MethodPut, fmt.Sprintf("/lists/%d/workflow", list.ID), `{ "states": [{ "name": "a", "kind": "initial" }, { "name": "b", "kind": "terminal" }] }`),
+		"promote":    bob(http.MethodPut, fmt.Sprintf("/lists/%d/members/%d", list.ID, logged.User.ID), `{ "role": "owner" }`),
+		"remove":     bob(http.MethodDelete, fmt.Sprintf("/lists/%d/members/1", list.ID), ""),
+		"deleteList": bob(http.MethodDelete, fmt.Sprintf("/lists/%d", list.ID), ""),
+	}
+	for name, resp := range viewerDenied {
+		t.Run(name, func(t *testing.T) {
+			expectAPIError(t, resp, http.StatusForbidden, "forbidden")
+		})
+	}
+
+	resp = bob(http.MethodGet, fmt.Sprintf("/lists/%d/members", list.ID), "")
+	expectStatus(t, resp, http.StatusOK)
+	var members []struct {
+		UserID int64
+		Name   string
+		Role   string
+	}
+	decodeBody(t, resp, &members)
+
+	if len(members) != 2 || members[0].Name != "local" || members[0].Role != "owner" || members[1].Name != "bob" {
+		t.Fatalf("expected the local user to own the list and bob to be in it but got %+v", members)
+	}
+
+	resp = owner(http.MethodPut, fmt.Sprintf("/lists/%d/members/%d", list.ID, logged.User.ID), `{ "role": "editor" }`)
+	expectStatus(t, resp, http.StatusOK)
+
+	resp = bob(http.MethodPut, fmt.Sprintf("/todos/%d", milk.ID), fmt.Sprintf(`{ "description": "oat milk", "listId": %d }`, list.ID))
+	expectStatus(t, resp, http.StatusOK)
+
+	resp = bob(http.MethodPost, "/todos", fmt.Sprintf(`{ "description": "chips", "listId": %d }`, list.ID))
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = owner(http.MethodGet, fmt.Sprintf("/lists/%d/todos", list.ID), "")
+	expectStatus(t, resp, http.StatusOK)
+	var inList []database.Todo
+	decodeBody(t, resp, &inList)
+
+	if len(inList) != 2 || inList[0].Description != "oat milk" || inList[1].Description != "chips" {
+		t.Fatalf("expected the owner to see bob's changes in list order but got %+v", inList)
+	}
+
+	// editors still can not manage the list
+	expectAPIError(t, bob(http.MethodDelete, fmt.Sprintf("/lists/%d", list.ID), ""), http.StatusForbidden, "forbidden")
+
+	resp = owner(http.MethodPut, fmt.Sprintf("/lists/%d/members/1", list.ID), `{ "role": "viewer" }`)
+	expectStatus(t, resp, http.StatusConflict)
+
+	resp = owner(http.MethodPost, fmt.Sprintf("/lists/%d/invitations", list.ID), `{ "role": "editor" }`)
+	expectStatus(t, resp, http.StatusCreated)
+	decodeBody(t, resp, &invited)
+
+	expectStatus(t, bob(http.MethodPost, "/invitations:decline", fmt.Sprintf(`{ "token": %q }`, invited.Token)), http.StatusOK)
+	expectStatus(t, bob(http.MethodPost, "/invitations:accept", fmt.Sprintf(`{ "token": %q }`, invited.Token)), http.StatusNotFound)
+
+	// leaving the list takes its todos away, bob's own included
+	expectStatus(t, bob(http.MethodDelete, fmt.Sprintf("/lists/%d/members/%d", list.ID, logged.User.ID), ""), http.StatusOK)
+
+	if todos := bobTodos(); len(todos) != 0 {
+		t.Fatalf("expected bob to see no todos after leaving but got %v", todos)
+	}
+
+	resp = owner(http.MethodGet, "/todos", "")
+	expectStatus(t, resp, http.StatusOK)
+	var ownerTodos []sharedTodo
+	decodeBody(t, resp, &ownerTodos)
+
+	if len(ownerTodos) != 3 {
+		t.Fatalf("expected the owner to still see 3 todos but got %+v", ownerTodos)
+	}
+
+	for _, todo := range ownerTodos {
+		if todo.Role != "owner" {
+			t.Fatalf("expected the owner to own every todo but got %+v", todo)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/auth"
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+)
+
+type syncResponse struct {
+	Seq     int64
+	Results []struct {
+		Op       string
+		ClientID string
+		ID       int64
+		Status   string
+		Todo     *database.Todo
+	}
+	Todos   []database.Todo
+	Deleted []int64
+}
+
+func postSync(t *testing.T, s target, body string) syncResponse {
+	t.Helper()
+
+	var sync syncResponse
+	s.NewClient(testAPIKey).JSON(http.MethodPost, "/sync", body, http.StatusOK, &sync)
+	return sync
+}
+
+func TestSyncRoute(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	first := postSync(t, s, `{
+		"since": 0,
+		"changes": [
+			{ "op": "create", "clientId": "a", "description": "write the sync test" },
+			{ "op": "create", "clientId": "b", "description": "delete me" }
+		]
+	}`)
+
+	if len(first.Results) != 2 || first.Results[0].Status != "applied" || first.Results[1].Status != "applied" {
+		t.Fatalf("expected both creates to be applied but got %+v", first.Results)
+	}
+
+	if len(first.Todos) != 2 {
+		t.Fatalf("expected 2 todos in the delta but got %d", len(first.Todos))
+	}
+
+	kept, deleted := first.Results[0].Todo, first.Results[1].Todo
+
+	// someone else updates the todo while the client is offline
+	resp := requestWithKey(t, s, http.MethodPut, fmt.Sprintf("/todos/%d", kept.ID), testAPIKey, `{ "description": "written elsewhere", "done": true }`)
+	expectStatus(t, resp, http.StatusOK)
+
+	second := postSync(t, s, fmt.Sprintf(`{
+		"since": %d,
+		"changes": [
+			{ "op": "update", "id": %d, "baseVersion": %d, "description": "stale edit" },
+			{ "op": "delete", "id": %d, "baseVersion": %d }
+		]
+	}`, first.Seq, kept.ID, kept.Version, deleted.ID, deleted.Version))
+
+	if second.Results[0].Status != "conflict" {
+		t.Fatalf("expected stale update to conflict but got %s", second.Results[0].Status)
+	}
+
+	if second.Results[0].Todo.Description != "written elsewhere" {
+		t.Fatalf("expected conflict to carry the server copy but got %+v", second.Results[0].Todo)
+	}
+
+	if second.Results[1].Status != "applied" {
+		t.Fatalf("expected delete to be applied but got %s", second.Results[1].Status)
+	}
+
+	if len(second.Todos) != 1 || second.Todos[0].ID != kept.ID {
+		t.Fatalf("expected only todo %d in the delta but got %+v", kept.ID, second.Todos)
+	}
+
+	if len(second.Deleted) != 1 || second.Deleted[0] != deleted.ID {
+		t.Fatalf("expected a tombstone for todo %d but got %v", deleted.ID, second.Deleted)
+	}
+
+	if second.Seq <= first.Seq {
+		t.Fatalf("expected seq to advance past %d but got %d", first.Seq, second.Seq)
+	}
+
+	third := postSync(t, s, fmt.Sprintf(`{ "since": %d }`, second.Seq))
+	if len(third.Todos) != 0 || len(third.Deleted) != 0 {
+		t.Fatalf("expected an empty delta but got %+v", third)
+	}
+}
+
+// sharedListMember returns a list of the local user holding one todo, and a
+// client of bob, who registered but is not a member of it yet.
+func sharedListMember(t *testing.T, s *gogsdtest.Server) (database.List, database.Todo, *gogsdtest.Client, int64) {
+	t.Helper()
+
+	list := s.Client.CreateList("groceries")
+	milk := s.NewTodo().Description("milk").InList(list.ID).Create()
+
+	resp := requestWithSession(t, s, http.MethodPost, "/auth/register", nil, "", `{ "name": "bob", "password": "correct horse" }`)
+	expectStatus(t, resp, http.StatusCreated)
+	session, logged := login(t, s, nil, "bob", "correct horse")
+
+	bob := s.NewClient("").
+		WithHeader("Cookie", session.Name+"="+session.Value).
+		WithHeader(auth.CSRFHeader, logged.CSRFToken)
+	return list, milk, bob, logged.User.ID
+}
+
+func inviteToList(t *testing.T, s *gogsdtest.Server, bob *gogsdtest.Client, listID int64) {
+	t.Helper()
+
+	var invited struct{ Token string }
+	s.Client.JSON(http.MethodPost, fmt.Sprintf("/lists/%d/invitations", listID), `{ "role": "viewer" }`, http.StatusCreated, &invited)
+	bob.JSON(http.MethodPost, "/invitations:accept", map[string]string{"token": invited.Token}, http.StatusOK, nil)
+}
+
+func TestSyncAfterJoiningAList(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	list, milk, bob, _ := sharedListMember(t, s)
+
+	var before syncResponse
+	bob.JSON(http.MethodPost, "/sync", `{ "since": 0 }`, http.StatusOK, &before)
+	if len(before.Todos) != 0 {
+		t.Fatalf("expected bob to sync no todos before joining but got %+v", before.Todos)
+	}
+
+	inviteToList(t, s, bob, list.ID)
+
+	// milk was written before bob's last sync, joining is what makes it new.
+	var after syncResponse
+	bob.JSON(http.MethodPost, "/sync", fmt.Sprintf(`{ "since": %d }`, before.Seq), http.StatusOK, &after)
+	if len(after.Todos) != 1 || after.Todos[0].ID != milk.ID {
+		t.Fatalf("expected the delta to hold milk after joining but got %+v", after.Todos)
+	}
+}
+
+func TestSyncAfterLeavingAList(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	list, milk, bob, bobID := sharedListMember(t, s)
+	inviteToList(t, s, bob, list.ID)
+
+	var before syncResponse
+	bob.JSON(http.MethodPost, "/sync", `{ "since": 0 }`, http.StatusOK, &before)
+	if len(before.Todos) != 1 || before.Todos[0].ID != milk.ID {
+		t.Fatalf("expected bob to sync milk while a member but got %+v", before.Todos)
+	}
+
+	s.Client.JSON(http.MethodDelete, fmt.Sprintf("/lists/%d/members/%d", list.ID, bobID), nil, http.StatusOK, nil)
+
+	var after syncResponse
+	bob.JSON(http.MethodPost, "/sync", fmt.Sprintf(`{ "since": %d }`, before.Seq), http.StatusOK, &after)
+	if len(after.Deleted) != 1 || after.Deleted[0] != milk.ID {
+		t.Fatalf("expected a tombstone for milk after leaving but got %v", after.Deleted)
+	}
+
+	// the owner's devices keep the todo.
+	var owner syncResponse
+	s.Client.JSON(http.MethodPost, "/sync", fmt.Sprintf(`{ "since": %d }`, before.Seq), http.StatusOK, &owner)
+	if len(owner.Deleted) != 0 {
+		t.Fatalf("expected no tombstones for the owner but got %v", owner.Deleted)
+	}
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/requestid"
+	"github.com/juancortelezzi/gogsd/pkg/telemetry"
+)
+
+// recordSpans installs a tracer provider keeping every span in memory as the
+// global one until the test ends.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := telemetry.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+	return exporter
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestRouteAndQuerySpans(t *testing.T) {
+	exporter := recordSpans(t)
+
+	s := startServer(t, gsdlogger.NewLogger(os.Stdout, slog.LevelDebug), testConfig(t, testLookupEnv))
+
+	exporter.Reset()
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	resp := requestWithHeaders(t, s, http.MethodPost, "/todos", map[string]string{
+		"Authorization":             "Bearer " + testAPIKey,
+		requestid.TraceparentHeader: traceparent,
+	}, `{ "description": "traced" }`)
+	expectStatus(t, resp, http.StatusCreated)
+
+	_, responseSpan, _, _ := requestid.ParseTraceparent(resp.Header.Get(requestid.TraceparentHeader))
+
+	var route tracetest.SpanStub
+	var queries []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "POST /todos" {
+			route = span
+		} else {
+			queries = append(queries, span)
+		}
+	}
+
+	if route.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || route.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected the route span to continue the caller's trace but got %+v", route)
+	}
+
+	if route.SpanContext.SpanID().String() != responseSpan {
+		t.Fatalf("expected the route span to be the one in the response headers but got %s and %s", route.SpanContext.SpanID(), responseSpan)
+	}
+
+	if spanAttribute(route, "http.route").AsString() != "POST /todos" || spanAttribute(route, "http.response.status_code").AsInt64() != http.StatusCreated {
+		t.Fatalf("expected the route span to carry the route and status but got %v", route.Attributes)
+	}
+
+	var created bool
+	for _, span := range queries {
+		if span.Parent.SpanID() != route.SpanContext.SpanID() {
+			t.Fatalf("expected query span %s to be a child of the route span", span.Name)
+		}
+
+		if span.Name == "CreateTodo" {
+			created = strings.HasPrefix(spanAttribute(span, "db.query.text").AsString(), "INSERT INTO todos")
+		}
+	}
+
+	if !created {
+		t.Fatalf("expected a CreateTodo span with its statement among %d query spans", len(queries))
+	}
+}
+
+func TestTracedDBRecordsErrors(t *testing.T) {
+	exporter := recordSpans(t)
+
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	db, err := database.Open(ctx, logger, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	traced := database.NewTracedDB(db, otel.Tracer("test"))
+	queries := database.New(traced)
+
+	err = queries.ExecTx(ctx, func(q *database.Queries) error {
+		_, err := q.ListWorkspaces(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := traced.ExecContext(ctx, "SELECT * FROM no_such_table"); err == nil {
+		t.Fatal("expected the query to fail")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "ListWorkspaces" {
+		t.Fatalf("expected the query inside the transaction to be traced but got %+v", spans)
+	}
+
+	failed := spans[1]
+	if failed.Name != "SELECT" || failed.Status.Code != codes.Error || len(failed.Events) == 0 {
+		t.Fatalf("expected the failed statement to record its error but got %+v", failed)
+	}
+}
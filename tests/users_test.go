@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+func TestTodosAreScopedByOwner(t *testing.T) {
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	queries, err := database.Connect(ctx, logger, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := queries.CreateUser(ctx, database.CreateUserParams{WorkspaceID: workspace.DefaultID, Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := queries.CreateUser(ctx, database.CreateUserParams{WorkspaceID: workspace.DefaultID, Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	todo, err := queries.CreateTodo(ctx, database.CreateTodoParams{
+		UserID:      alice.ID,
+		Description: "alice's todo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	todos, err := queries.ListTodos(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(todos) != 0 {
+		t.Fatalf("expected bob to see no todos but got %d", len(todos))
+	}
+
+	_, err = queries.UpdateTodo(ctx, database.UpdateTodoParams{
+		Description: "bob was here",
+		Done:        true,
+		ID:          todo.ID,
+		UserID:      bob.ID,
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected bob's update to match no rows but got %v", err)
+	}
+
+	err = queries.DeleteTodo(ctx, database.DeleteTodoParams{ID: todo.ID, UserID: bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	todos, err = queries.ListTodos(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(todos) != 1 || todos[0].Description != "alice's todo" || todos[0].Done {
+		t.Fatalf("expected alice's todo to be untouched but got %v", todos)
+	}
+}
+
+func TestDeleteCompletedTodosCoversEditableLists(t *testing.T) {
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	queries, err := database.Connect(ctx, logger, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := make(map[string]database.User)
+	for _, name := range []string{"alice", "bob"} {
+		users[name], err = queries.CreateUser(ctx, database.CreateUserParams{WorkspaceID: workspace.DefaultID, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// alice edits the first list and only views the second, bob owns both.
+	lists := make([]database.List, 2)
+	for i, role := range []string{"editor", "viewer"} {
+		lists[i], err = queries.CreateList(ctx, database.CreateListParams{WorkspaceID: workspace.DefaultID, Name: role})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		members := []database.CreateListMemberParams{
+			{Role: "owner", ListID: lists[i].ID, UserID: users["bob"].ID},
+			{Role: role, ListID: lists[i].ID, UserID: users["alice"].ID},
+		}
+		for _, member := range members {
+			if _, err := queries.CreateListMember(ctx, member); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	create := func(user string, list *database.List, description string) {
+		t.Helper()
+
+		params := database.CreateTodoParams{UserID: users[user].ID, Description: description, Done: true}
+		if list != nil {
+			params.ListID = sql.NullInt64{Int64: list.ID, Valid: true}
+		}
+		if _, err := queries.CreateTodo(ctx, params); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	create("alice", nil, "alice's own")
+	create("bob", nil, "bob's own")
+	create("bob", &lists[0], "bob's in the edited list")
+	create("bob", &lists[1], "bob's in the viewed list")
+
+	deleted, err := queries.DeleteCompletedTodos(ctx, users["alice"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != 2 {
+		t.Fatalf("expected alice's todo and the one of the list alice edits to be deleted but got %d", deleted)
+	}
+
+	todos, err := queries.ListTodos(ctx, users["bob"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(todos) != 2 || todos[0].Description != "bob's own" || todos[1].Description != "bob's in the viewed list" {
+		t.Fatalf("expected bob's own todo and the one of the viewed list to be left but got %+v", todos)
+	}
+}
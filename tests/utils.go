@@ -2,75 +2,142 @@ package tests
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"net/http"
-	"time"
+	"os"
+	"path/filepath"
+	"testing"
 
+	"github.com/juancortelezzi/gogsd/pkg/config"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
 	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/server"
 )
 
-const waitForReadyTimeout = time.Second * 3
+// testAPIKey is stored as an admin key of the local user by every server the
+// tests run, whether gogsdtest or startServer runs it.
+const testAPIKey = gogsdtest.APIKey
+
+// target is a server the tests send requests to, a gogsdtest.Server or one
+// startServer runs.
+type target interface {
+	NewClient(key string) *gogsdtest.Client
+}
 
 func testLookupEnv(key string) (string, bool) {
 	switch key {
-	case "PORT":
-		return "3000", true
 	case "DATABASE_URL":
 		return ":memory:", true
+	case "BOOTSTRAP_API_KEY":
+		return testAPIKey, true
 	default:
 		return "", false
 	}
 }
 
-func getBaseUrl() string {
-	port, found := testLookupEnv("PORT")
-	if !found {
-		panic("PORT environment variable not found")
+// testConfig loads the configuration of a server the tests start from
+// lookupEnv alone. Unless lookupEnv names a port or a socket, the server
+// listens on a unix socket of its own, so tests never wait for a port
+// another one holds.
+func testConfig(t *testing.T, lookupEnv func(string) (string, bool)) config.Config {
+	t.Helper()
+
+	_, port := lookupEnv("PORT")
+	socketPath := ""
+	cfg, err := config.Load(nil, func(key string) (string, bool) {
+		if value, ok := lookupEnv(key); ok || key != "SOCKET_PATH" || port {
+			return value, ok
+		}
+		if socketPath == "" {
+			socketPath = filepath.Join(socketDir(t), "gogsd.sock")
+		}
+		return socketPath, true
+	})
+	if err != nil {
+		t.Fatal(err)
 	}
+	return cfg
+}
 
-	return "http://" + net.JoinHostPort("127.0.0.1", port)
+// socketDir returns a directory removed when the test ends. Unlike
+// t.TempDir its path is short, sockets have little room for theirs.
+func socketDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "gogsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
 }
 
-func waitForReady(ctx context.Context, logger gsdlogger.Logger, endpoint string) error {
-	client := http.Client{}
-	startTime := time.Now()
+// freeAddr returns a local TCP address nothing listens on, for the
+// listeners that can not be unix sockets.
+func freeAddr(t *testing.T) string {
+	t.Helper()
 
-	for {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-		if err != nil {
-			return fmt.Errorf("failed to create a request: %w", err)
-		}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-				if time.Since(startTime) >= waitForReadyTimeout {
-					logger.ErrorContext(ctx, "error making request", "err", err)
-					return fmt.Errorf("timeout reached while waiting for endpoint")
-				}
-				time.Sleep(time.Millisecond * 250)
-				continue
-			}
-		}
+// testServer is a server the tests run, reached through the unix socket of
+// its configuration.
+type testServer struct {
+	t          *testing.T
+	socketPath string
+	transport  *http.Transport
+	// Client is authenticated with testAPIKey.
+	Client *gogsdtest.Client
+}
 
-		resp.Body.Close()
+// newTestServer reaches the server listening on the unix socket at
+// socketPath until the test ends.
+func newTestServer(t *testing.T, socketPath string) *testServer {
+	s := &testServer{t: t, socketPath: socketPath}
+	s.transport = &http.Transport{DialContext: s.Dial}
+	s.Client = s.NewClient(testAPIKey)
+	t.Cleanup(s.transport.CloseIdleConnections)
+	return s
+}
 
-		if resp.StatusCode == http.StatusOK {
-			return nil
-		}
+// Dial connects to the server whatever address it is asked for, for the
+// transports of tests that need their own.
+func (s *testServer) Dial(ctx context.Context, _, _ string) (net.Conn, error) {
+	return (&net.Dialer{}).DialContext(ctx, "unix", s.socketPath)
+}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if time.Since(startTime) >= waitForReadyTimeout {
-				return fmt.Errorf("timeout reached while waiting for endpoint")
-			}
-			time.Sleep(time.Millisecond * 250)
-		}
+// NewClient returns a client authenticated with key, or with no
+// credentials at all when key is empty.
+func (s *testServer) NewClient(key string) *gogsdtest.Client {
+	return gogsdtest.NewClient(s.t, "http://gogsd", &http.Client{Transport: s.transport}, key)
+}
+
+// startServer serves cfg with logger until the test ends, returning once
+// the server is ready.
+func startServer(t *testing.T, logger gsdlogger.Logger, cfg config.Config, opts ...server.Option) *testServer {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := server.New(ctx, logger, cfg, opts...)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
 	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-stopped; err != nil {
+			t.Errorf("server stopped with: %v", err)
+		}
+	})
+
+	<-s.Ready()
+	return newTestServer(t, cfg.Listen.SocketPath)
 }
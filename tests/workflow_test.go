@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gogsdtest"
+)
+
+func TestWorkflowRoutes(t *testing.T) {
+	t.Parallel()
+	s := gogsdtest.New(t)
+
+	list := s.Client.CreateList("team")
+
+	var workflow struct {
+		States      []database.WorkflowState
+		Transitions []database.WorkflowTransition
+	}
+	s.Client.JSON(http.MethodPut, fmt.Sprintf("/lists/%d/workflow", list.ID), `{
+		"states": [
+			{ "name": "Backlog", "kind": "initial" },
+			{ "name": "In Progress", "kind": "active", "wipLimit": 1 },
+			{ "name": "Review", "kind": "active" },
+			{ "name": "Done", "kind": "terminal" }
+		],
+		"transitions": [
+			{ "from": "Backlog", "to": "In Progress" },
+			{ "from": "In Progress", "to": "Review" },
+			{ "from": "Review", "to": "In Progress" },
+			{ "from": "Review", "to": "Done" }
+		]
+	}`, http.StatusOK, &workflow)
+
+	if len(workflow.States) != 4 || len(workflow.Transitions) != 4 {
+		t.Fatalf("expected 4 states and 4 transitions but got %d and %d", len(workflow.States), len(workflow.Transitions))
+	}
+
+	states := map[string]int64{}
+	for _, state := range workflow.States {
+		states[state.Name] = state.ID
+	}
+
+	var todos []database.Todo
+	for _, description := range []string{"a", "b"} {
+		todo := s.NewTodo().Description(description).InList(list.ID).Create()
+		if todo.StatusID.Int64 != states["Backlog"] {
+			t.Fatalf("expected new todo to start in Backlog but got status %d", todo.StatusID.Int64)
+		}
+		todos = append(todos, todo)
+	}
+
+	transition := func(id int64, state string, expectedStatus int) database.Todo {
+		var todo database.Todo
+		resp := s.Client.Do(http.MethodPost, fmt.Sprintf("/todos/%d/transition", id), map[string]int64{"statusId": states[state]})
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("expected moving %d to %s to answer %d but got %d", id, state, expectedStatus, resp.StatusCode)
+		}
+
+		if expectedStatus == http.StatusOK {
+			decodeBody(t, resp, &todo)
+		}
+		return todo
+	}
+
+	// Backlog can not skip straight to Done
+	transition(todos[0].ID, "Done", http.StatusConflict)
+
+	transition(todos[0].ID, "In Progress", http.StatusOK)
+
+	// In Progress only holds one todo
+	transition(todos[1].ID, "In Progress", http.StatusConflict)
+
+	transition(todos[0].ID, "Review", http.StatusOK)
+	transition(todos[1].ID, "In Progress", http.StatusOK)
+
+	done := transition(todos[0].ID, "Done", http.StatusOK)
+	if !done.Done {
+		t.Fatalf("expected todo in a terminal state to be done")
+	}
+
+	var board struct {
+		List    database.List
+		Columns []struct {
+			State database.WorkflowState
+			Todos []database.Todo
+		}
+	}
+	s.Client.JSON(http.MethodGet, fmt.Sprintf("/lists/%d/board", list.ID), nil, http.StatusOK, &board)
+
+	var counts []string
+	for _, column := range board.Columns {
+		counts = append(counts, fmt.Sprintf("%s=%d", column.State.Name, len(column.Todos)))
+	}
+
+	expectedCounts := "Backlog=0 In Progress=1 Review=0 Done=1"
+	if got := strings.Join(counts, " "); got != expectedCounts {
+		t.Fatalf("expected board to be %q but got %q", expectedCounts, got)
+	}
+}
@@ -0,0 +1,467 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/juancortelezzi/gogsd/pkg/database"
+	"github.com/juancortelezzi/gogsd/pkg/gsdlogger"
+	"github.com/juancortelezzi/gogsd/pkg/workspace"
+)
+
+// requestWithHeaders sends a request with no credentials other than the ones
+// in headers.
+func requestWithHeaders(t *testing.T, s target, method, path string, headers map[string]string, body string) *http.Response {
+	t.Helper()
+
+	c := s.NewClient("")
+	for key, value := range headers {
+		c = c.WithHeader(key, value)
+	}
+	return c.Do(method, path, body)
+}
+
+func TestWorkspaceIsolation(t *testing.T) {
+	t.Parallel()
+	var s *testServer
+	{
+		lookupEnv := func(key string) (string, bool) {
+			if key == "WORKSPACE_DOMAIN" {
+				return "gsd.test", true
+			}
+			return testLookupEnv(key)
+		}
+
+		logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+		s = startServer(t, logger, testConfig(t, lookupEnv))
+	}
+
+	admin := func(method, path, body string) *http.Response {
+		return requestWithKey(t, s, method, path, testAPIKey, body)
+	}
+
+	expectStatus(t, admin(http.MethodPost, "/workspaces", `{ "slug": "acme", "name": "Acme", "maxTodos": 2 }`), http.StatusCreated)
+	expectStatus(t, admin(http.MethodPost, "/workspaces", `{ "slug": "beta", "name": "Beta" }`), http.StatusCreated)
+	expectStatus(t, admin(http.MethodPost, "/workspaces", `{ "slug": "acme", "name": "Acme again" }`), http.StatusConflict)
+	expectStatus(t, admin(http.MethodPost, "/workspaces", `{ "slug": "not.a.slug", "name": "Nope" }`), http.StatusBadRequest)
+
+	// the default workspace holds a private todo, a list and an invitation to
+	// it that nobody in acme may reach.
+	resp := admin(http.MethodPost, "/todos", `{ "description": "secret" }`)
+	expectStatus(t, resp, http.StatusCreated)
+	var secret database.Todo
+	decodeBody(t, resp, &secret)
+
+	resp = admin(http.MethodPost, "/lists", `{ "name": "plans" }`)
+	expectStatus(t, resp, http.StatusCreated)
+	var plans database.List
+	decodeBody(t, resp, &plans)
+
+	resp = admin(http.MethodPost, fmt.Sprintf("/lists/%d/invitations", plans.ID), `{ "role": "editor" }`)
+	expectStatus(t, resp, http.StatusCreated)
+	var invited struct{ Token string }
+	decodeBody(t, resp, &invited)
+
+	// user names are only unique within a workspace.
+	register := `{ "name": "bob", "password": "correct horse" }`
+	expectStatus(t, requestWithSession(t, s, http.MethodPost, "/auth/register", nil, "", register), http.StatusCreated)
+	expectStatus(t, requestWithSession(t, s, http.MethodPost, "/w/acme/auth/register", nil, "", register), http.StatusCreated)
+	expectStatus(t, requestWithSession(t, s, http.MethodPost, "/w/acme/auth/register", nil, "", register), http.StatusConflict)
+
+	resp = requestWithSession(t, s, http.MethodPost, "/w/acme/auth/login", nil, "", register)
+	expectStatus(t, resp, http.StatusOK)
+	session := sessionCookie(t, resp)
+	var logged loginResponse
+	decodeBody(t, resp, &logged)
+
+	bob := func(method, path, body string) *http.Response {
+		return requestWithSession(t, s, method, "/w/acme"+path, session, logged.CSRFToken, body)
+	}
+
+	resp = bob(http.MethodGet, "/todos", "")
+	expectStatus(t, resp, http.StatusOK)
+	var todos []database.Todo
+	decodeBody(t, resp, &todos)
+
+	if len(todos) != 0 {
+		t.Fatalf("expected acme to see no todos but got %+v", todos)
+	}
+
+	crossTenant := map[string]*http.Response{
+		"update":     bob(http.MethodPut, fmt.Sprintf("/todos/%d", secret.ID), `{ "description": "pwned" }`),
+		"blockers":   bob(http.MethodGet, fmt.Sprintf("/todos/%d/blockers", secret.ID), ""),
+		"list todos": bob(http.MethodGet, fmt.Sprintf("/lists/%d/todos", plans.ID), ""),
+		"workflow":   bob(http.MethodGet, fmt.Sprintf("/lists/%d/workflow", plans.ID), ""),
+		"members":    bob(http.MethodGet, fmt.Sprintf("/lists/%d/members", plans.ID), ""),
+		"invitation": bob(http.MethodPost, "/invitations:accept", fmt.Sprintf(`{ "token": %q }`, invited.Token)),
+	}
+	for name, resp := range crossTenant {
+		t.Run(name, func(t *testing.T) {
+			expectStatus(t, resp, http.StatusNotFound)
+		})
+	}
+
+	expectStatus(t, bob(http.MethodDelete, fmt.Sprintf("/todos/%d", secret.ID), ""), http.StatusOK)
+
+	resp = admin(http.MethodGet, "/todos", "")
+	expectStatus(t, resp, http.StatusOK)
+	decodeBody(t, resp, &todos)
+
+	if len(todos) != 1 || todos[0].ID != secret.ID || todos[0].Description != "secret" {
+		t.Fatalf("expected the secret todo to be untouched but got %+v", todos)
+	}
+
+	// credentials only work in the workspace they were issued in, however it
+	// is named.
+	wrongWorkspace := map[string]*http.Response{
+		"session in default": requestWithSession(t, s, http.MethodGet, "/todos", session, "", ""),
+		"session by header":  requestWithHeaders(t, s, http.MethodGet, "/todos", map[string]string{"Cookie": session.String(), workspace.Header: "beta"}, ""),
+		"key by path":        requestWithKey(t, s, http.MethodGet, "/w/acme/todos", testAPIKey, ""),
+		"key by subdomain":   requestWithHeaders(t, s, http.MethodGet, "/todos", map[string]string{"Authorization": "Bearer " + testAPIKey, "Host": "beta.gsd.test"}, ""),
+	}
+	for name, resp := range wrongWorkspace {
+		t.Run(name, func(t *testing.T) {
+			expectAPIError(t, resp, http.StatusUnauthorized, "unauthenticated")
+		})
+	}
+
+	resp = requestWithHeaders(t, s, http.MethodGet, "/todos", map[string]string{"Cookie": session.String(), "Host": "acme.gsd.test"}, "")
+	expectStatus(t, resp, http.StatusOK)
+
+	resp = requestWithHeaders(t, s, http.MethodGet, "/w/acme/todos", map[string]string{"Cookie": session.String(), workspace.Header: "beta"}, "")
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	expectAPIError(t, requestWithKey(t, s, http.MethodGet, "/w/nope/todos", testAPIKey, ""), http.StatusNotFound, "workspace_not_found")
+
+	// only admins of the default workspace manage workspaces.
+	expectAPIError(t, bob(http.MethodPost, "/workspaces", `{ "slug": "mine", "name": "Mine" }`), http.StatusForbidden, "forbidden")
+
+	// acme holds at most two todos, however they are created.
+	expectStatus(t, bob(http.MethodPost, "/todos", `{ "description": "one" }`), http.StatusCreated)
+	expectStatus(t, bob(http.MethodPost, "/todos", `{ "description": "two" }`), http.StatusCreated)
+	expectAPIError(t, bob(http.MethodPost, "/todos", `{ "description": "three" }`), http.StatusForbidden, "quota_exceeded")
+
+	resp = bob(http.MethodPost, "/todos:batch", `{ "operations": [{ "op": "create", "description": "three" }] }`)
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	var batch batchResponse
+	decodeBody(t, resp, &batch)
+
+	if len(batch.Results) != 1 || batch.Results[0].Status != http.StatusForbidden {
+		t.Fatalf("expected the batch create to be over quota but got %+v", batch)
+	}
+
+	resp = bob(http.MethodGet, "/workspace", "")
+	expectStatus(t, resp, http.StatusOK)
+	var usage struct {
+		Slug     string
+		MaxTodos sql.NullInt64
+		Todos    int64
+	}
+	decodeBody(t, resp, &usage)
+
+	if usage.Slug != "acme" || usage.MaxTodos.Int64 != 2 || usage.Todos != 2 {
+		t.Fatalf("expected acme to be full with 2 todos but got %+v", usage)
+	}
+
+	expectStatus(t, admin(http.MethodPut, "/workspaces/acme", `{ "name": "Acme", "maxTodos": 3 }`), http.StatusOK)
+	expectStatus(t, bob(http.MethodPost, "/todos", `{ "description": "three" }`), http.StatusCreated)
+}
+
+func TestQueriesAreScopedByWorkspace(t *testing.T) {
+	ctx := context.Background()
+	logger := gsdlogger.NewLogger(os.Stdout, slog.LevelDebug)
+
+	queries, err := database.Connect(ctx, logger, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := queries.CreateWorkspace(ctx, database.CreateWorkspaceParams{
+		Slug:     "other",
+		Name:     "Other",
+		MaxTodos: sql.NullInt64{Int64: 1, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := queries.CreateUser(ctx, database.CreateUserParams{WorkspaceID: workspace.DefaultID, Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mallory, err := queries.CreateUser(ctx, database.CreateUserParams{WorkspaceID: other.ID, Name: "mallory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := queries.CreateList(ctx, database.CreateListParams{WorkspaceID: workspace.DefaultID, Name: "alice's"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	todo, err := queries.CreateTodo(ctx, database.CreateTodoParams{
+		UserID:      alice.ID,
+		Description: "alice's todo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if todo.WorkspaceID != workspace.DefaultID {
+		t.Fatalf("expected the todo to be created in the workspace of its user but got %d", todo.WorkspaceID)
+	}
+
+	// memberships can not reach across workspaces, so nothing else can.
+	_, err = queries.CreateListMember(ctx, database.CreateListMemberParams{ListID: list.ID, UserID: mallory.ID, Role: "owner"})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected a member from another workspace to be refused but got %v", err)
+	}
+
+	_, err = queries.GetTodo(ctx, database.GetTodoParams{ID: todo.ID, UserID: mallory.ID})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected mallory to not see alice's todo but got %v", err)
+	}
+
+	_, err = queries.GetList(ctx, database.GetListParams{ID: list.ID, WorkspaceID: other.ID})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the list to not be found in the other workspace but got %v", err)
+	}
+
+	_, err = queries.CreateTodo(ctx, database.CreateTodoParams{
+		UserID:      mallory.ID,
+		Description: "into alice's list",
+		ListID:      sql.NullInt64{Int64: list.ID, Valid: true},
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected a todo in another workspace's list to be refused but got %v", err)
+	}
+
+	seq, err := queries.GetTodoChangeSeq(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = queries.CreateTodo(ctx, database.CreateTodoParams{UserID: mallory.ID, Description: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changes are numbered per workspace, so alice can not tell mallory wrote.
+	if after, err := queries.GetTodoChangeSeq(ctx, alice.ID); err != nil || after != seq {
+		t.Fatalf("expected alice's sequence to stay at %d but got %d, %v", seq, after, err)
+	}
+
+	if mallorySeq, err := queries.GetTodoChangeSeq(ctx, mallory.ID); err != nil || mallorySeq != 1 {
+		t.Fatalf("expected mallory's first change to be number 1 but got %d, %v", mallorySeq, err)
+	}
+
+	_, err = queries.CreateTodo(ctx, database.CreateTodoParams{UserID: mallory.ID, Description: "second"})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the second todo to be over quota but got %v", err)
+	}
+
+	_, err = queries.CreateListMember(ctx, database.CreateListMemberParams{ListID: list.ID, UserID: alice.ID, Role: "owner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := queries.CreateWorkflowState(ctx, database.CreateWorkflowStateParams{
+		Name:        "Done",
+		Kind:        "terminal",
+		ListID:      list.ID,
+		WorkspaceID: workspace.DefaultID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocker, err := queries.CreateTodo(ctx, database.CreateTodoParams{UserID: alice.ID, Description: "blocker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listTodo, err := queries.CreateTodo(ctx, database.CreateTodoParams{
+		UserID:      alice.ID,
+		Description: "blocked",
+		Done:        true,
+		ListID:      sql.NullInt64{Int64: list.ID, Valid: true},
+		StatusID:    sql.NullInt64{Int64: state.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = queries.CreateTodoDependency(ctx, database.CreateTodoDependencyParams{
+		TodoID:      listTodo.ID,
+		BlockerID:   blocker.ID,
+		WorkspaceID: workspace.DefaultID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the queries below run with alice's ids but the other workspace, as a
+	// caller from there guessing them would.
+	err = queries.DeleteList(ctx, database.DeleteListParams{ID: list.ID, WorkspaceID: other.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = queries.GetListMember(ctx, database.GetListMemberParams{ListID: list.ID, UserID: alice.ID, WorkspaceID: other.ID})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected alice's membership to not be found in the other workspace but got %v", err)
+	}
+
+	members, err := queries.ListListMembers(ctx, database.ListListMembersParams{ListID: list.ID, WorkspaceID: other.ID})
+	if err != nil || len(members) != 0 {
+		t.Fatalf("expected no members in the other workspace but got %v, %v", members, err)
+	}
+
+	_, err = queries.UpdateListMemberRole(ctx, database.UpdateListMemberRoleParams{
+		Role:        "viewer",
+		ListID:      list.ID,
+		UserID:      alice.ID,
+		WorkspaceID: other.ID,
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected alice's role to not be updated from the other workspace but got %v", err)
+	}
+
+	removed, err := queries.DeleteListMember(ctx, database.DeleteListMemberParams{ListID: list.ID, UserID: alice.ID, WorkspaceID: other.ID})
+	if err != nil || removed != 0 {
+		t.Fatalf("expected no member to be removed from the other workspace but got %d, %v", removed, err)
+	}
+
+	if owners, err := queries.CountListOwners(ctx, database.CountListOwnersParams{ListID: list.ID, WorkspaceID: other.ID}); err != nil || owners != 0 {
+		t.Fatalf("expected no owners in the other workspace but got %d, %v", owners, err)
+	}
+
+	_, err = queries.GetWorkflowState(ctx, database.GetWorkflowStateParams{ID: state.ID, WorkspaceID: other.ID})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the state to not be found in the other workspace but got %v", err)
+	}
+
+	states, err := queries.ListWorkflowStates(ctx, database.ListWorkflowStatesParams{ListID: list.ID, WorkspaceID: other.ID})
+	if err != nil || len(states) != 0 {
+		t.Fatalf("expected no states in the other workspace but got %v, %v", states, err)
+	}
+
+	_, err = queries.CreateWorkflowState(ctx, database.CreateWorkflowStateParams{
+		Name:        "Injected",
+		Kind:        "initial",
+		ListID:      list.ID,
+		WorkspaceID: other.ID,
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected a state in another workspace's list to be refused but got %v", err)
+	}
+
+	_, err = queries.UpdateWorkflowState(ctx, database.UpdateWorkflowStateParams{
+		Kind:        "initial",
+		ID:          state.ID,
+		WorkspaceID: other.ID,
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the state to not be updated from the other workspace but got %v", err)
+	}
+
+	err = queries.CreateWorkflowTransition(ctx, database.CreateWorkflowTransitionParams{
+		FromStateID: state.ID,
+		ToStateID:   state.ID,
+		WorkspaceID: other.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transitions, err := queries.ListWorkflowTransitions(ctx, database.ListWorkflowTransitionsParams{
+		ListID:      list.ID,
+		WorkspaceID: workspace.DefaultID,
+	})
+	if err != nil || len(transitions) != 0 {
+		t.Fatalf("expected no transition to be created from the other workspace but got %v, %v", transitions, err)
+	}
+
+	err = queries.SetStatusTodosDone(ctx, database.SetStatusTodosDoneParams{
+		StatusID:    sql.NullInt64{Int64: state.ID, Valid: true},
+		WorkspaceID: other.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := queries.CountTodosInStatus(ctx, database.CountTodosInStatusParams{
+		StatusID:    sql.NullInt64{Int64: state.ID, Valid: true},
+		WorkspaceID: other.ID,
+	})
+	if err != nil || count != 0 {
+		t.Fatalf("expected no todos in the state from the other workspace but got %d, %v", count, err)
+	}
+
+	blockers, err := queries.CountOpenTodoBlockers(ctx, database.CountOpenTodoBlockersParams{WorkspaceID: other.ID, TodoID: listTodo.ID})
+	if err != nil || blockers != 0 {
+		t.Fatalf("expected no blockers from the other workspace but got %d, %v", blockers, err)
+	}
+
+	blocked, err := queries.CountBlockedDoneTodosInList(ctx, database.CountBlockedDoneTodosInListParams{
+		ListID:      sql.NullInt64{Int64: list.ID, Valid: true},
+		WorkspaceID: other.ID,
+	})
+	if err != nil || blocked != 0 {
+		t.Fatalf("expected no blocked todos from the other workspace but got %d, %v", blocked, err)
+	}
+
+	removed, err = queries.DeleteTodoDependency(ctx, database.DeleteTodoDependencyParams{
+		TodoID:      listTodo.ID,
+		BlockerID:   blocker.ID,
+		WorkspaceID: other.ID,
+	})
+	if err != nil || removed != 0 {
+		t.Fatalf("expected no dependency to be removed from the other workspace but got %d, %v", removed, err)
+	}
+
+	err = queries.DeleteWorkflowState(ctx, database.DeleteWorkflowStateParams{ID: state.ID, WorkspaceID: other.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// and nothing of alice's moved.
+	if _, err := queries.GetList(ctx, database.GetListParams{ID: list.ID, WorkspaceID: workspace.DefaultID}); err != nil {
+		t.Fatalf("expected the list to survive a delete from the other workspace but got %v", err)
+	}
+
+	member, err := queries.GetListMember(ctx, database.GetListMemberParams{ListID: list.ID, UserID: alice.ID, WorkspaceID: workspace.DefaultID})
+	if err != nil || member.Role != "owner" {
+		t.Fatalf("expected alice to still own the list but got %v, %v", member, err)
+	}
+
+	stored, err := queries.GetWorkflowState(ctx, database.GetWorkflowStateParams{ID: state.ID, WorkspaceID: workspace.DefaultID})
+	if err != nil || stored.Kind != "terminal" {
+		t.Fatalf("expected the state to be untouched but got %v, %v", stored, err)
+	}
+
+	current, err := queries.GetTodo(ctx, database.GetTodoParams{ID: listTodo.ID, UserID: alice.ID})
+	if err != nil || !current.Done {
+		t.Fatalf("expected the todo to still be done but got %v, %v", current, err)
+	}
+
+	blockers, err = queries.CountOpenTodoBlockers(ctx, database.CountOpenTodoBlockersParams{WorkspaceID: workspace.DefaultID, TodoID: listTodo.ID})
+	if err != nil || blockers != 1 {
+		t.Fatalf("expected the todo to still be blocked but got %d, %v", blockers, err)
+	}
+
+	blocked, err = queries.CountBlockedDoneTodosInList(ctx, database.CountBlockedDoneTodosInListParams{
+		ListID:      sql.NullInt64{Int64: list.ID, Valid: true},
+		WorkspaceID: workspace.DefaultID,
+	})
+	if err != nil || blocked != 1 {
+		t.Fatalf("expected the todo to count as blocked but got %d, %v", blocked, err)
+	}
+}